@@ -3,9 +3,11 @@ package main
 import (
 	"github.com/lacodon/recoon/pkg/config"
 	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/knownhosts"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"os"
 )
 
 func initRecoon(api *store.DefaultStore, config config.Getter) error {
@@ -29,5 +31,11 @@ func initRecoon(api *store.DefaultStore, config config.Getter) error {
 		return errors.WithMessage(err, "failed to init store")
 	}
 
+	if file := os.Getenv("SSH_KNOWN_HOSTS"); file != "" {
+		if err := knownhosts.Seed(api, file); err != nil {
+			return errors.WithMessage(err, "failed to seed known hosts")
+		}
+	}
+
 	return nil
 }
@@ -2,17 +2,28 @@ package main
 
 import (
 	"context"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/compose"
 	"github.com/lacodon/recoon/pkg/config"
 	"github.com/lacodon/recoon/pkg/controller/configrepo"
 	"github.com/lacodon/recoon/pkg/controller/event"
 	"github.com/lacodon/recoon/pkg/controller/project"
 	"github.com/lacodon/recoon/pkg/controller/repository"
+	"github.com/lacodon/recoon/pkg/deploylog"
+	"github.com/lacodon/recoon/pkg/gc"
+	"github.com/lacodon/recoon/pkg/imageupdate"
+	"github.com/lacodon/recoon/pkg/knownhosts"
 	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/refwatch"
+	"github.com/lacodon/recoon/pkg/registry"
+	"github.com/lacodon/recoon/pkg/retry"
 	"github.com/lacodon/recoon/pkg/runner"
+	"github.com/lacodon/recoon/pkg/snapshot"
 	"github.com/lacodon/recoon/pkg/sshauth"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/lacodon/recoon/pkg/ui"
 	"github.com/lacodon/recoon/pkg/watcher"
+	"github.com/lacodon/recoon/pkg/webhook"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -50,29 +61,80 @@ func rootCmdRun(cmd *cobra.Command, _ []string) error {
 
 	logrus.Println(sshauth.GetPublicKeyOpenSSHFormat(cfg.GetString("ssh.keyDir")))
 
-	immediateRepoReconcileTrigger := make(chan bool)
+	composeEngine, err := compose.NewEngine(cfg.GetString("compose.engine"))
+	if err != nil {
+		return err
+	}
+	containerRuntime := compose.NewDockerRuntime()
+
+	// buffered, so that webhooks don't wait for a running pull
+	immediateRepoReconcileTrigger := make(chan puller.Request, 16)
+	immediateConfigReconcileTrigger := make(chan string, 1)
 
+	knownHosts := knownhosts.New(api, cfg.GetBool("ssh.trustOnFirstUse"))
 	apiWatcher := watcher.NewDefaultWatcher(api.EventsChan())
+	backoff := retry.NewBackoff(
+		cfg.GetDuration("retry.baseDelay"),
+		cfg.GetDuration("retry.maxDelay"),
+		cfg.GetInt("retry.maxAttempts"))
 	repoPuller := puller.NewPuller(api,
 		immediateRepoReconcileTrigger,
 		cfg.GetString("store.gitDir"),
 		cfg.GetString("ssh.keyDir"),
+		knownHosts,
 		cfg.GetDuration("appRepo.reconciliationInterval"))
 	repoConfigController := configrepo.NewController(api,
 		cfg.GetString("store.gitDir"),
 		cfg.GetString("configRepo.cloneURL"),
 		cfg.GetString("configRepo.branchName"),
 		cfg.GetDuration("configRepo.reconciliationInterval"),
-		cfg.GetString("ssh.keyDir"))
+		cfg.GetString("ssh.keyDir"),
+		knownHosts,
+		configRepoWebhookSecret(cfg),
+		immediateConfigReconcileTrigger)
 	repositoryController := repository.NewController(apiWatcher, api,
 		cfg.GetString("store.gitDir"),
-		cfg.GetString("ssh.keyDir"))
-	projectController := project.NewController(apiWatcher, api)
-	eventController := event.NewController(api)
+		cfg.GetString("ssh.keyDir"),
+		knownHosts,
+		backoff)
+	deployLogs := deploylog.New(cfg.GetString("store.deployLogDir"),
+		int64(cfg.GetInt("deployment.maxLogSizeMB"))*1024*1024,
+		cfg.GetInt("deployment.history"))
+	projectController := project.NewController(apiWatcher, api,
+		composeEngine,
+		containerRuntime,
+		deployLogs,
+		snapshot.New(cfg.GetString("snapshot.dir"), cfg.GetString("snapshot.helperImage"), containerRuntime),
+		cfg.GetString("store.exportDir"),
+		cfg.GetInt("controller.project.workers"),
+		backoff)
+	eventController := event.NewController(api, containerRuntime)
+	imageUpdater := imageupdate.NewUpdater(api,
+		registry.New(cfg.GetStringSlice("registry.insecure")),
+		cfg.GetDuration("imageUpdate.interval"))
+	collector := gc.NewCollector(api, containerRuntime,
+		cfg.GetDuration("gc.interval"),
+		gc.Options{
+			KeepImages:       cfg.GetInt("gc.keepImages"),
+			HighWaterMark:    int64(cfg.GetInt("gc.highWaterMarkGB")) * 1024 * 1024 * 1024,
+			BuildCacheMaxAge: cfg.GetDuration("gc.buildCacheMaxAge"),
+		})
 	recoonUI := ui.New(api,
 		immediateRepoReconcileTrigger,
+		immediateConfigReconcileTrigger,
 		cfg.GetInt("ui.port"),
-		cfg.GetString("ssh.keyDir"))
+		cfg.GetString("ssh.keyDir"),
+		backoff,
+		deployLogs,
+		collector)
+	webhookReceiver := webhook.NewReceiver(api,
+		cfg.GetInt("webhook.port"),
+		immediateRepoReconcileTrigger,
+		immediateConfigReconcileTrigger)
+	refWatcher := refwatch.NewWatcher(api,
+		cfg.GetBool("localRepo.watch"),
+		immediateRepoReconcileTrigger,
+		immediateConfigReconcileTrigger)
 
 	ctx, cancel := context.WithCancel(cmd.Context())
 
@@ -86,6 +148,10 @@ func rootCmdRun(cmd *cobra.Command, _ []string) error {
 	taskManager.AddTask(eventController)
 	taskManager.AddTask(apiWatcher)
 	taskManager.AddTask(repoPuller)
+	taskManager.AddTask(imageUpdater)
+	taskManager.AddTask(collector)
+	taskManager.AddTask(webhookReceiver)
+	taskManager.AddTask(refWatcher)
 	taskManager.StartAll(ctx)
 
 	select {
@@ -102,3 +168,13 @@ func rootCmdRun(cmd *cobra.Command, _ []string) error {
 
 	return nil
 }
+
+// configRepoWebhookSecret returns the reference to the secret which verifies the webhooks of the config repo if one is configured
+func configRepoWebhookSecret(cfg config.Getter) *secretv1.KeyRef {
+	name := cfg.GetString("configRepo.webhookSecret")
+	if name == "" {
+		return nil
+	}
+
+	return &secretv1.KeyRef{Name: name}
+}
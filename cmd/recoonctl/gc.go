@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove images, build cache and stopped containers which are not referenced by any project",
+	RunE:  gcCmdRun,
+}
+
+var gcDryRun bool
+
+func init() {
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "only report what would be removed")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func gcCmdRun(_ *cobra.Command, _ []string) error {
+	report, err := apiClient.GarbageCollect(gcDryRun)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("disk usage: %s", units.HumanSize(float64(report.DiskUsage)))
+	if report.HighWaterMark > 0 {
+		fmt.Printf(" of %s high-water mark", units.HumanSize(float64(report.HighWaterMark)))
+		if report.HighWaterMarkExceeded {
+			fmt.Print(" (exceeded)")
+		}
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tID\tNAME\tSIZE\tREASON\t")
+	for _, item := range report.Items {
+		id := item.ID
+		if len(id) > 19 {
+			id = id[:19]
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", item.Kind, id, item.Name, units.HumanSize(float64(item.Size)), item.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	verb := "reclaimed"
+	if report.DryRun {
+		verb = "would reclaim"
+	}
+	fmt.Printf("%s %s\n", verb, units.HumanSize(float64(report.Reclaimed)))
+
+	for _, message := range report.Errors {
+		_, _ = fmt.Fprintln(os.Stderr, message)
+	}
+
+	return nil
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"fmt"
+	"github.com/docker/go-units"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
 	"github.com/lacodon/recoon/pkg/controller/configrepo"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 )
@@ -43,6 +46,33 @@ func getCmdRun(cmd *cobra.Command, args []string) error {
 	case "container":
 		return getContainer(args)
 
+	case "event":
+		fallthrough
+	case "events":
+		return getEvent(args)
+
+	case "deployment":
+		fallthrough
+	case "deployments":
+		fallthrough
+	case "deploy":
+		return getDeployment(args)
+
+	case "snapshot":
+		fallthrough
+	case "snapshots":
+		return getSnapshot(args)
+
+	case "secret":
+		fallthrough
+	case "secrets":
+		return getSecret()
+
+	case "retry":
+		fallthrough
+	case "retries":
+		return getRetry()
+
 	default:
 		return errors.New("unknown type")
 	}
@@ -56,7 +86,7 @@ func getRepository(args []string) error {
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		_, _ = fmt.Fprintln(w, "PROJECT\tREPO\tBRANCH\tPATH\tCOMMIT\t")
+		_, _ = fmt.Fprintln(w, "PROJECT\tREPO\tBRANCH\tREF\tPATH\tCOMMIT\t")
 
 		for _, repo := range repos {
 			projectName := repo.Spec.ProjectName
@@ -64,8 +94,8 @@ func getRepository(args []string) error {
 				projectName = "RECOON-CONFIG"
 			}
 
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n",
-				projectName, repo.Spec.Url, repo.Spec.Branch, repo.Spec.Path, repo.Status.CurrentCommitId)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n",
+				projectName, repo.Spec.Url, repo.Spec.Branch, repo.Status.ResolvedRef, repo.Spec.Path, repo.Status.CurrentCommitId)
 		}
 
 		return w.Flush()
@@ -79,6 +109,16 @@ func getRepository(args []string) error {
 	out, _ := yaml.Marshal(repo)
 	fmt.Print(string(out))
 
+	if repo.Status != nil && repo.Status.DeployKey != "" {
+		fmt.Printf("\nGrant this deploy key read access to %s:\n%s\n", repo.Spec.Url, repo.Status.DeployKey)
+	}
+
+	if repo.Status != nil {
+		if cond, ok := repo.Status.Conditions[repositoryv1.ConditionConfigInvalid]; ok {
+			fmt.Printf("\nThe config is not applied until these errors are fixed:\n%s\n", strings.ReplaceAll(cond.Message, "; ", "\n"))
+		}
+	}
+
 	return nil
 }
 
@@ -90,12 +130,13 @@ func getProject(args []string) error {
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		_, _ = fmt.Fprintln(w, "PROJECT\tLAST_APPLIED_COMMIT_ID\tSTATUS\tTRANSITION_TIME\t")
+		_, _ = fmt.Fprintln(w, "PROJECT\tLAST_APPLIED_COMMIT_ID\tSTATUS\tTRANSITION_TIME\tBLOCKED_BY\t")
 
 		for _, project := range projects {
 			lastAppliedCommit := ""
 			status := "PENDING"
 			transitionTime := ""
+			blockedBy := ""
 
 			if project.Status != nil {
 				lastAppliedCommit = project.Status.LastAppliedCommitId
@@ -111,10 +152,20 @@ func getProject(args []string) error {
 				if project.Spec.CommitId != lastAppliedCommit {
 					status = "PENDING"
 				}
+
+				if cond, ok := project.Status.Conditions[projectv1.ConditionDependencyCycle]; ok {
+					status = "DEPENDENCY CYCLE"
+					transitionTime = cond.LastTransitionTime.Format(time.RFC822)
+				} else if cond, ok := project.Status.Conditions[projectv1.ConditionDependency]; ok {
+					status = "BLOCKED"
+					transitionTime = cond.LastTransitionTime.Format(time.RFC822)
+				}
+
+				blockedBy = strings.Join(project.Status.BlockedBy, ",")
 			}
 
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n",
-				project.GetName(), lastAppliedCommit, status, transitionTime)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n",
+				project.GetName(), lastAppliedCommit, status, transitionTime, blockedBy)
 		}
 
 		return w.Flush()
@@ -152,3 +203,121 @@ func getContainer(args []string) error {
 
 	return w.Flush()
 }
+
+func getEvent(args []string) error {
+	namespace := ""
+	if len(args) == 2 {
+		namespace = "project-" + args[1]
+	}
+
+	events, err := apiClient.GetEvents(namespace)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tOBJECT\tREASON\tMESSAGE\t")
+
+	for _, event := range events {
+		message := strings.SplitN(event.Message, "\n", 2)[0]
+
+		_, _ = fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\t\n",
+			event.Timestamp.Format(time.RFC822), event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, message)
+	}
+
+	return w.Flush()
+}
+
+func getDeployment(args []string) error {
+	if len(args) != 2 {
+		return errors.New("must pass project name")
+	}
+
+	deployments, err := apiClient.GetDeployments(args[1])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REVISION\tCOMMIT\tPHASE\tSTART_TIME\tDURATION\tMESSAGE\t")
+
+	for _, deployment := range deployments {
+		duration := ""
+		if deployment.Status.EndTime != nil {
+			duration = deployment.Status.EndTime.Sub(deployment.Status.StartTime).Round(time.Second).String()
+		}
+
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t\n",
+			deployment.Spec.Revision, deployment.Spec.CommitId, deployment.Status.Phase,
+			deployment.Status.StartTime.Format(time.RFC822), duration, strings.SplitN(deployment.Status.Message, "\n", 2)[0])
+	}
+
+	return w.Flush()
+}
+
+func getSnapshot(args []string) error {
+	if len(args) != 2 {
+		return errors.New("must pass project name")
+	}
+
+	snapshots, err := apiClient.GetSnapshots(args[1])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tCOMMIT\tCREATED\tVOLUMES\tSIZE\t")
+
+	for _, snapshot := range snapshots {
+		volumes := make([]string, 0, len(snapshot.Spec.Volumes))
+		size := int64(0)
+		for _, volume := range snapshot.Spec.Volumes {
+			volumes = append(volumes, volume.Name)
+			size += volume.Size
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n",
+			snapshot.Spec.ID, snapshot.Spec.CommitId, snapshot.Spec.CreatedAt.Format(time.RFC822),
+			strings.Join(volumes, ","), units.HumanSize(float64(size)))
+	}
+
+	return w.Flush()
+}
+
+func getSecret() error {
+	secrets, err := apiClient.GetSecrets()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tKEYS\t")
+
+	for _, secret := range secrets {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t\n", secret.Name, strings.Join(secret.Keys, ","))
+	}
+
+	return w.Flush()
+}
+
+func getRetry() error {
+	states, err := apiClient.GetRetryStates()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tOBJECT\tATTEMPTS\tNEXT_RETRY\tLAST_ERROR\t")
+
+	for _, state := range states {
+		nextRetry := "GAVE UP"
+		if !state.GaveUp {
+			nextRetry = state.NextRetry.Format(time.RFC822)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t\n",
+			state.VersionKind.Kind, state.NamespaceName.String(), state.Attempts, nextRetry, state.LastError)
+	}
+
+	return w.Flush()
+}
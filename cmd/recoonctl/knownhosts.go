@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var knownHostsCmd = &cobra.Command{
+	Use:   "known-hosts",
+	Short: "Manage the SSH host keys which recoon trusts when pulling git repositories",
+}
+
+var knownHostsAddCmd = &cobra.Command{
+	Use:   "add HOST [KEY...]",
+	Short: "Trust the keys of a host, e.g. github.com or [git.example.com]:2222; without keys recoon scans the host and trusts what it presents, KEY=@FILE reads keys from a file",
+	RunE:  knownHostsAddCmdRun,
+}
+
+var knownHostsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the known hosts and the fingerprints of their keys",
+	RunE:  knownHostsListCmdRun,
+}
+
+var knownHostsRemoveCmd = &cobra.Command{
+	Use:   "remove HOST",
+	Short: "Stop trusting a host",
+	RunE:  knownHostsRemoveCmdRun,
+}
+
+func init() {
+	knownHostsCmd.AddCommand(knownHostsAddCmd)
+	knownHostsCmd.AddCommand(knownHostsListCmd)
+	knownHostsCmd.AddCommand(knownHostsRemoveCmd)
+	rootCmd.AddCommand(knownHostsCmd)
+}
+
+func knownHostsAddCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return errors.New("must pass host")
+	}
+
+	keys := make([]string, 0)
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "@") {
+			keys = append(keys, arg)
+			continue
+		}
+
+		content, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+
+	knownHost, err := apiClient.SetKnownHost(args[0], keys)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range knownHost.Spec.Keys {
+		fmt.Printf("trusted %s %s\n", knownHost.GetName(), fingerprint(key))
+	}
+
+	return nil
+}
+
+func knownHostsListCmdRun(_ *cobra.Command, _ []string) error {
+	knownHosts, err := apiClient.GetKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOST\tKEY\tTRUSTED_ON_FIRST_USE\t")
+
+	for _, knownHost := range knownHosts {
+		if knownHost.Spec == nil {
+			continue
+		}
+
+		for _, key := range knownHost.Spec.Keys {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%t\t\n", knownHost.GetName(), fingerprint(key), knownHost.Spec.TrustedOnFirstUse)
+		}
+	}
+
+	return w.Flush()
+}
+
+func knownHostsRemoveCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass host")
+	}
+
+	if err := apiClient.DeleteKnownHost(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Println("OK")
+	return nil
+}
+
+// fingerprint returns the type and SHA256 fingerprint of a key in authorized_keys format
+func fingerprint(key string) string {
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return key
+	}
+
+	return parsed.Type() + " " + ssh.FingerprintSHA256(parsed)
+}
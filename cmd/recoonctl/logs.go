@@ -11,7 +11,22 @@ var logsCmd = &cobra.Command{
 	RunE:  logsCmdRun,
 }
 
+var logsDeployCmd = &cobra.Command{
+	Use:   "deploy PROJECT",
+	Short: "Get the build and up logs of a deployment of a project",
+	RunE:  logsDeployCmdRun,
+}
+
+var (
+	logsDeployFollow   bool
+	logsDeployRevision int
+)
+
 func init() {
+	logsDeployCmd.Flags().BoolVarP(&logsDeployFollow, "follow", "f", false, "follow the log until the deployment has finished")
+	logsDeployCmd.Flags().IntVarP(&logsDeployRevision, "revision", "r", 0, "revision of the deployment; defaults to the latest one")
+
+	logsCmd.AddCommand(logsDeployCmd)
 	rootCmd.AddCommand(logsCmd)
 }
 
@@ -22,3 +37,25 @@ func logsCmdRun(cmd *cobra.Command, args []string) error {
 
 	return apiClient.StreamContainerLogs(args[0])
 }
+
+func logsDeployCmdRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass project name")
+	}
+
+	revision := logsDeployRevision
+	if revision == 0 {
+		deployments, err := apiClient.GetDeployments(args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(deployments) == 0 {
+			return errors.New("project has no deployments")
+		}
+
+		revision = deployments[len(deployments)-1].Spec.Revision
+	}
+
+	return apiClient.StreamDeploymentLog(args[0], revision, logsDeployFollow)
+}
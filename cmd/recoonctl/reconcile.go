@@ -1,25 +1,118 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
 	"github.com/spf13/cobra"
+	"time"
 )
 
 var reconcileCmd = &cobra.Command{
-	Use:   "reconcile",
-	Short: "Trigger an immediate repository reconciliation",
-	RunE:  reconcileCmdRun,
+	Use:   "reconcile [repo NAME | project NAME | config]",
+	Short: "Trigger an immediate reconciliation of all repositories or of a single repository, project or the config repo",
+	Long: `Trigger an immediate reconciliation. Without arguments all app repositories are pulled. A project is
+redeployed even if its commit is unchanged. The returned request id can be polled with 'reconcile status ID'.`,
+	RunE: reconcileCmdRun,
 }
 
+var reconcileStatusCmd = &cobra.Command{
+	Use:   "status ID",
+	Short: "Get the progress of a reconcile request",
+	RunE:  reconcileStatusCmdRun,
+}
+
+var (
+	reconcileWait    bool
+	reconcileTimeout time.Duration
+)
+
 func init() {
+	reconcileCmd.PersistentFlags().BoolVarP(&reconcileWait, "wait", "w", false, "wait until the result of the request is known")
+	reconcileCmd.PersistentFlags().DurationVar(&reconcileTimeout, "timeout", 10*time.Minute, "how long to wait with --wait")
+
+	reconcileCmd.AddCommand(reconcileStatusCmd)
 	rootCmd.AddCommand(reconcileCmd)
 }
 
-func reconcileCmdRun(_ *cobra.Command, _ []string) error {
-	if err := apiClient.Reconcile(); err != nil {
+func reconcileCmdRun(_ *cobra.Command, args []string) error {
+	target, name := reconcilev1.TargetAll, ""
+	if len(args) > 0 {
+		switch args[0] {
+		case "repository":
+			fallthrough
+		case "repo":
+			target = reconcilev1.TargetRepository
+		case "project":
+			fallthrough
+		case "proj":
+			target = reconcilev1.TargetProject
+		case "config":
+			target = reconcilev1.TargetConfig
+		default:
+			return errors.New("unknown target")
+		}
+
+		if target != reconcilev1.TargetConfig {
+			if len(args) != 2 {
+				return errors.New("must pass " + target + " name")
+			}
+			name = args[1]
+		}
+	}
+
+	request, err := apiClient.Reconcile(target, name)
+	if err != nil {
 		return err
 	}
 
-	fmt.Println("OK")
+	if !reconcileWait {
+		fmt.Println(request.Name)
+		return nil
+	}
+
+	return waitReconcile(request.Name)
+}
+
+func reconcileStatusCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass request id")
+	}
+
+	if reconcileWait {
+		return waitReconcile(args[0])
+	}
+
+	request, err := apiClient.GetReconcile(args[0])
+	if err != nil {
+		return err
+	}
+
+	printReconcile(request)
 	return nil
 }
+
+func waitReconcile(id string) error {
+	request, err := apiClient.WaitReconcile(id, reconcileTimeout)
+	if err != nil {
+		return err
+	}
+
+	printReconcile(request)
+	if request.Status.Phase == reconcilev1.PhaseFailed {
+		return errors.New("reconciliation failed")
+	}
+
+	return nil
+}
+
+func printReconcile(request *reconcilev1.Reconcile) {
+	fmt.Printf("%s: %s", request.Name, request.Status.Phase)
+	if request.Status.CommitId != "" {
+		fmt.Printf(" at commit %s", request.Status.CommitId)
+	}
+	if request.Status.Message != "" {
+		fmt.Printf(" (%s)", request.Status.Message)
+	}
+	fmt.Println()
+}
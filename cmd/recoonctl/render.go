@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render PROJECT",
+	Short: "Print the compose project as it gets deployed with all files, patches and templates applied; secrets are redacted",
+	RunE:  renderCmdRun,
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+}
+
+func renderCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass project name")
+	}
+
+	rendered, err := apiClient.RenderProject(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(rendered)
+	return nil
+}
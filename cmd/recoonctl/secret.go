@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage secrets which can be used in compose templates",
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set NAME KEY=VALUE...",
+	Short: "Create a secret or set keys of an existing one; KEY=@FILE reads the value from a file",
+	RunE:  secretSetCmdRun,
+}
+
+var secretDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a secret",
+	RunE:  secretDeleteCmdRun,
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretDeleteCmd)
+	rootCmd.AddCommand(secretCmd)
+}
+
+func secretSetCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return errors.New("must pass secret name and at least one KEY=VALUE")
+	}
+
+	data := make(map[string]string, len(args)-1)
+	for _, arg := range args[1:] {
+		key, value, found := strings.Cut(arg, "=")
+		if !found || key == "" {
+			return fmt.Errorf("invalid key value pair %q", arg)
+		}
+
+		if strings.HasPrefix(value, "@") {
+			content, err := os.ReadFile(value[1:])
+			if err != nil {
+				return err
+			}
+			value = string(content)
+		}
+
+		data[key] = value
+	}
+
+	if err := apiClient.SetSecret(args[0], data); err != nil {
+		return err
+	}
+
+	fmt.Println("OK")
+	return nil
+}
+
+func secretDeleteCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass secret name")
+	}
+
+	if err := apiClient.DeleteSecret(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Println("OK")
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage the volume snapshots of projects",
+}
+
+var volumeRestoreCmd = &cobra.Command{
+	Use:   "restore PROJECT --snapshot ID",
+	Short: "Stop the project, restore its volumes from a snapshot and redeploy it",
+	RunE:  volumeRestoreCmdRun,
+}
+
+var volumeRestoreSnapshot string
+
+func init() {
+	volumeRestoreCmd.Flags().StringVar(&volumeRestoreSnapshot, "snapshot", "", "id of the snapshot to restore, see 'get snapshots PROJECT'")
+	volumeCmd.AddCommand(volumeRestoreCmd)
+	rootCmd.AddCommand(volumeCmd)
+}
+
+func volumeRestoreCmdRun(_ *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("must pass project name")
+	}
+
+	if volumeRestoreSnapshot == "" {
+		return errors.New("must pass --snapshot")
+	}
+
+	if err := apiClient.RestoreSnapshot(args[0], volumeRestoreSnapshot); err != nil {
+		return err
+	}
+
+	fmt.Printf("requested restore of snapshot %s, see 'get deployments %s' for the progress\n", volumeRestoreSnapshot, args[0])
+	return nil
+}
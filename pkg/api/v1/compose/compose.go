@@ -0,0 +1,196 @@
+package compose
+
+import "time"
+
+// strategies to replace the containers of a project with the ones of a new commit
+const (
+	// StrategyRecreate updates the containers in place
+	StrategyRecreate = "recreate"
+	// StrategyBlueGreen brings up a second set of containers and switches the network aliases once it is healthy
+	StrategyBlueGreen = "blueGreen"
+)
+
+// defaults of the blue/green strategy
+const (
+	DefaultNetwork       = "recoon"
+	DefaultHealthTimeout = 2 * time.Minute
+)
+
+// Config selects the compose files of a project and how they get loaded; all paths are relative to the path of the repository
+type Config struct {
+	// Files are merged in the given order, so later files override earlier ones; defaults to docker-compose.yml or compose.yaml
+	Files []string `json:"files,omitempty" yaml:"files"`
+	// Patches are applied in order on the model of the merged Files; mappings are merged recursively and all other
+	// values get replaced. A null value or a mapping with "$patch: delete" removes the key, "$patch: replace" replaces a mapping.
+	Patches []string `json:"patches,omitempty" yaml:"patches"`
+	// Profiles which are activated in addition to the services without a profile
+	Profiles []string `json:"profiles,omitempty" yaml:"profiles"`
+	// ProjectDir is the directory relative paths in the compose files are resolved against; defaults to the directory of the first file
+	ProjectDir string `json:"projectDir,omitempty" yaml:"projectDir"`
+	// EnvFiles are used for the variable interpolation instead of the .env file of the project directory
+	EnvFiles []string `json:"envFiles,omitempty" yaml:"envFiles"`
+	// Environment contains variables for the interpolation which take precedence over the env files and the environment of recoon
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment"`
+	// Template renders the compose files and patches as Go templates before they get loaded
+	Template bool `json:"template,omitempty" yaml:"template"`
+	// Values are available in the templates as .Values
+	Values map[string]interface{} `json:"values,omitempty" yaml:"values"`
+	// Images maps service names to the policy their image gets updated by
+	Images map[string]ImagePolicy `json:"images,omitempty" yaml:"images"`
+	// Strategy is StrategyRecreate or StrategyBlueGreen; defaults to StrategyRecreate
+	Strategy string `json:"strategy,omitempty" yaml:"strategy"`
+	// BlueGreen configures StrategyBlueGreen
+	BlueGreen *BlueGreen `json:"blueGreen,omitempty" yaml:"blueGreen"`
+}
+
+// BlueGreen runs the sets of containers as compose projects <project>-blue and <project>-green. The services of the
+// live set are reachable on Network by their aliases, so a reverse proxy on that network never sees the sets switch.
+type BlueGreen struct {
+	// Network the aliases are registered on; defaults to DefaultNetwork
+	Network string `json:"network,omitempty" yaml:"network"`
+	// Aliases maps services to their alias; defaults to <service>.<project>
+	Aliases map[string]string `json:"aliases,omitempty" yaml:"aliases"`
+	// HealthTimeout is how long the new set may take to become healthy, e.g. 5m; defaults to DefaultHealthTimeout
+	HealthTimeout string `json:"healthTimeout,omitempty" yaml:"healthTimeout"`
+}
+
+// IsBlueGreen tells whether the config selects StrategyBlueGreen
+func (c *Config) IsBlueGreen() bool {
+	return c != nil && c.Strategy == StrategyBlueGreen
+}
+
+// GetNetwork returns the network of the aliases or DefaultNetwork
+func (b *BlueGreen) GetNetwork() string {
+	if b == nil || b.Network == "" {
+		return DefaultNetwork
+	}
+
+	return b.Network
+}
+
+// GetAlias returns the alias of the service of the project
+func (b *BlueGreen) GetAlias(projectName, service string) string {
+	if b != nil {
+		if alias, ok := b.Aliases[service]; ok {
+			return alias
+		}
+	}
+
+	return service + "." + projectName
+}
+
+// GetHealthTimeout returns the parsed health timeout or DefaultHealthTimeout
+func (b *BlueGreen) GetHealthTimeout() time.Duration {
+	if b == nil {
+		return DefaultHealthTimeout
+	}
+
+	timeout, err := time.ParseDuration(b.HealthTimeout)
+	if err != nil || timeout <= 0 {
+		return DefaultHealthTimeout
+	}
+
+	return timeout
+}
+
+func (b *BlueGreen) DeepCopy() *BlueGreen {
+	if b == nil {
+		return nil
+	}
+
+	n := &BlueGreen{
+		Network:       b.Network,
+		HealthTimeout: b.HealthTimeout,
+	}
+
+	if b.Aliases != nil {
+		n.Aliases = make(map[string]string, len(b.Aliases))
+		for service, alias := range b.Aliases {
+			n.Aliases[service] = alias
+		}
+	}
+
+	return n
+}
+
+// ImagePolicy selects the tag of the image of a service from its registry. Of the tags matching both Semver and
+// Pattern, the highest is deployed; without both, the tag of the compose file is redeployed if its digest changes.
+type ImagePolicy struct {
+	// Semver is a range of semantic versions like ">=1.2.0 <2.0.0", "^1.2" or "~1.2.3"
+	Semver string `json:"semver,omitempty" yaml:"semver"`
+	// Pattern is a regular expression the tags have to match; tags which are no semantic versions are compared lexically
+	Pattern string `json:"pattern,omitempty" yaml:"pattern"`
+}
+
+func (c *Config) DeepCopy() *Config {
+	if c == nil {
+		return nil
+	}
+
+	n := &Config{
+		ProjectDir: c.ProjectDir,
+		Template:   c.Template,
+		Strategy:   c.Strategy,
+		BlueGreen:  c.BlueGreen.DeepCopy(),
+	}
+
+	if c.Values != nil {
+		n.Values = deepCopyValue(c.Values).(map[string]interface{})
+	}
+
+	if c.Images != nil {
+		n.Images = make(map[string]ImagePolicy, len(c.Images))
+		for service, policy := range c.Images {
+			n.Images[service] = policy
+		}
+	}
+
+	if c.Files != nil {
+		n.Files = make([]string, len(c.Files))
+		copy(n.Files, c.Files)
+	}
+
+	if c.Patches != nil {
+		n.Patches = make([]string, len(c.Patches))
+		copy(n.Patches, c.Patches)
+	}
+
+	if c.Profiles != nil {
+		n.Profiles = make([]string, len(c.Profiles))
+		copy(n.Profiles, c.Profiles)
+	}
+
+	if c.EnvFiles != nil {
+		n.EnvFiles = make([]string, len(c.EnvFiles))
+		copy(n.EnvFiles, c.EnvFiles)
+	}
+
+	if c.Environment != nil {
+		n.Environment = make(map[string]string, len(c.Environment))
+		for key, value := range c.Environment {
+			n.Environment[key] = value
+		}
+	}
+
+	return n
+}
+
+// deepCopyValue copies the maps and slices of a decoded YAML or JSON value
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		n := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			n[key] = deepCopyValue(nested)
+		}
+		return n
+	case []interface{}:
+		n := make([]interface{}, len(v))
+		for i, nested := range v {
+			n[i] = deepCopyValue(nested)
+		}
+		return n
+	default:
+		return value
+	}
+}
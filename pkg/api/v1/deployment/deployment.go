@@ -0,0 +1,88 @@
+package deployment
+
+import (
+	"fmt"
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+	"time"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Deployment"}
+
+func init() {
+	schema.Register(VersionKind, &Deployment{})
+}
+
+// Phase is the state of a deploy attempt
+type Phase string
+
+const (
+	PhaseRunning   Phase = "Running"
+	PhaseSucceeded Phase = "Succeeded"
+	PhaseFailed    Phase = "Failed"
+)
+
+// Deployment records a single deploy attempt of a project; the build and up output is stored in the deploy log
+type Deployment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   *Spec   `json:"spec,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type Spec struct {
+	Project  metav1.ObjectRef `json:"project"`
+	CommitId string           `json:"commitId"`
+	// Revision counts the deploy attempts of the project starting at 1
+	Revision int `json:"revision"`
+}
+
+type Status struct {
+	Phase     Phase      `json:"phase"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	// Message is the error of a failed deployment
+	Message string `json:"message,omitempty"`
+}
+
+// MakeName returns the name of the deployment with the given revision of the project
+func MakeName(projectName string, revision int) string {
+	return fmt.Sprintf("%s.%d", projectName, revision)
+}
+
+// IsFinished reports whether the deployment has succeeded or failed
+func (d *Deployment) IsFinished() bool {
+	return d.Status != nil && d.Status.Phase != PhaseRunning
+}
+
+func (d *Deployment) DeepCopy() api.Object {
+	n := &Deployment{
+		TypeMeta:   d.TypeMeta.DeepCopy(),
+		ObjectMeta: d.ObjectMeta.DeepCopy(),
+	}
+
+	if d.Spec != nil {
+		n.Spec = &Spec{
+			Project:  d.Spec.Project.DeepCopy(),
+			CommitId: d.Spec.CommitId,
+			Revision: d.Spec.Revision,
+		}
+	}
+
+	if d.Status != nil {
+		n.Status = &Status{
+			Phase:     d.Status.Phase,
+			StartTime: d.Status.StartTime,
+			Message:   d.Status.Message,
+		}
+
+		if d.Status.EndTime != nil {
+			endTime := *d.Status.EndTime
+			n.Status.EndTime = &endTime
+		}
+	}
+
+	return n
+}
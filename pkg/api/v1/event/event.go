@@ -0,0 +1,40 @@
+package event
+
+import (
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+	"time"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Event"}
+
+func init() {
+	schema.Register(VersionKind, &Event{})
+}
+
+// Event records something noteworthy which happened to another object
+type Event struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	// InvolvedObject is the object this event is about
+	InvolvedObject metav1.ObjectRef `json:"involvedObject"`
+	// Reason is a short, machine readable description of the event
+	Reason string `json:"reason"`
+	// Message is the human readable description of the event
+	Message string `json:"message,omitempty"`
+	// Timestamp when the event occurred
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (e *Event) DeepCopy() api.Object {
+	return &Event{
+		TypeMeta:       e.TypeMeta.DeepCopy(),
+		ObjectMeta:     e.ObjectMeta.DeepCopy(),
+		InvolvedObject: e.InvolvedObject.DeepCopy(),
+		Reason:         e.Reason,
+		Message:        e.Message,
+		Timestamp:      e.Timestamp,
+	}
+}
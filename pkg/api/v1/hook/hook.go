@@ -0,0 +1,105 @@
+package hook
+
+import "time"
+
+type FailurePolicy string
+
+const (
+	// FailurePolicyAbort stops the deployment and reports a failure
+	FailurePolicyAbort FailurePolicy = "abort"
+	// FailurePolicyRollback redeploys the last applied commit
+	FailurePolicyRollback FailurePolicy = "rollback"
+	// FailurePolicyIgnore only records the failure and continues
+	FailurePolicyIgnore FailurePolicy = "ignore"
+)
+
+// DefaultTimeout is used for hooks without a valid timeout
+const DefaultTimeout = 5 * time.Minute
+
+// Hook is a one-shot command which runs before or after docker compose up
+type Hook struct {
+	// Name of the hook used in events and conditions
+	Name string `json:"name" yaml:"name"`
+	// Service of the compose project to run the command in; mutually exclusive with Image
+	Service string `json:"service,omitempty" yaml:"service"`
+	// Image to run the command in a standalone container; mutually exclusive with Service
+	Image string `json:"image,omitempty" yaml:"image"`
+	// Command overrides the default command of Service or Image
+	Command []string `json:"command,omitempty" yaml:"command"`
+	// Timeout for the hook, e.g. 30s; defaults to DefaultTimeout
+	Timeout string `json:"timeout,omitempty" yaml:"timeout"`
+	// FailurePolicy defines what happens if the hook fails; defaults to abort
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty" yaml:"failurePolicy"`
+}
+
+// GetTimeout returns the parsed timeout of the hook or DefaultTimeout
+func (h Hook) GetTimeout() time.Duration {
+	timeout, err := time.ParseDuration(h.Timeout)
+	if err != nil || timeout <= 0 {
+		return DefaultTimeout
+	}
+
+	return timeout
+}
+
+// GetFailurePolicy returns the failure policy of the hook or FailurePolicyAbort
+func (h Hook) GetFailurePolicy() FailurePolicy {
+	switch h.FailurePolicy {
+	case FailurePolicyRollback, FailurePolicyIgnore:
+		return h.FailurePolicy
+	default:
+		return FailurePolicyAbort
+	}
+}
+
+func (h Hook) DeepCopy() Hook {
+	n := h
+
+	if h.Command != nil {
+		n.Command = make([]string, len(h.Command))
+		copy(n.Command, h.Command)
+	}
+
+	return n
+}
+
+type Hooks struct {
+	// PreDeploy hooks run before docker compose up, e.g. database migrations
+	PreDeploy []Hook `json:"preDeploy,omitempty" yaml:"preDeploy"`
+	// PostDeploy hooks run after a successful docker compose up, e.g. smoke tests
+	PostDeploy []Hook `json:"postDeploy,omitempty" yaml:"postDeploy"`
+}
+
+// Append returns the hooks of h followed by the hooks of other
+func (h *Hooks) Append(other *Hooks) *Hooks {
+	n := h.DeepCopy()
+	if n == nil {
+		n = &Hooks{}
+	}
+
+	if other != nil {
+		o := other.DeepCopy()
+		n.PreDeploy = append(n.PreDeploy, o.PreDeploy...)
+		n.PostDeploy = append(n.PostDeploy, o.PostDeploy...)
+	}
+
+	return n
+}
+
+func (h *Hooks) DeepCopy() *Hooks {
+	if h == nil {
+		return nil
+	}
+
+	n := &Hooks{}
+
+	for _, hook := range h.PreDeploy {
+		n.PreDeploy = append(n.PreDeploy, hook.DeepCopy())
+	}
+
+	for _, hook := range h.PostDeploy {
+		n.PostDeploy = append(n.PostDeploy, hook.DeepCopy())
+	}
+
+	return n
+}
@@ -0,0 +1,52 @@
+package knownhost
+
+import (
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "KnownHost"}
+
+func init() {
+	schema.Register(VersionKind, &KnownHost{})
+}
+
+// Namespace of all known hosts
+const Namespace = "recoon-system"
+
+// KnownHost lists the trusted SSH host keys of a git host; its name is the host in known_hosts notation, e.g.
+// github.com or [git.example.com]:2222
+type KnownHost struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec *Spec `json:"spec,omitempty"`
+}
+
+type Spec struct {
+	// Keys are the host keys in authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+	Keys []string `json:"keys,omitempty"`
+	// TrustedOnFirstUse tells that the keys were accepted without verification on the first connection
+	TrustedOnFirstUse bool `json:"trustedOnFirstUse,omitempty"`
+}
+
+func (k *KnownHost) DeepCopy() api.Object {
+	n := &KnownHost{
+		TypeMeta:   k.TypeMeta.DeepCopy(),
+		ObjectMeta: k.ObjectMeta.DeepCopy(),
+	}
+
+	if k.Spec != nil {
+		n.Spec = &Spec{
+			TrustedOnFirstUse: k.Spec.TrustedOnFirstUse,
+		}
+
+		if k.Spec.Keys != nil {
+			n.Spec.Keys = make([]string, len(k.Spec.Keys))
+			copy(n.Spec.Keys, k.Spec.Keys)
+		}
+	}
+
+	return n
+}
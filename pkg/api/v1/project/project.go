@@ -2,8 +2,12 @@ package project
 
 import (
 	"github.com/lacodon/recoon/pkg/api"
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
 	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	hookv1 "github.com/lacodon/recoon/pkg/api/v1/hook"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
 	"github.com/lacodon/recoon/pkg/schema"
 )
 
@@ -17,6 +21,15 @@ const (
 	ConditionSuccess conditionv1.Type = "ComposeSuccess"
 	ConditionFailure conditionv1.Type = "ComposeFailure"
 	ConditionSchema  conditionv1.Type = "ComposeSchema"
+	ConditionHook    conditionv1.Type = "HookFailure"
+	// ConditionRetryExhausted is set if the project failed too often; it will only be retried on changes
+	ConditionRetryExhausted conditionv1.Type = "RetryExhausted"
+	// ConditionDependency is set while the project waits for its dependencies to become ready
+	ConditionDependency conditionv1.Type = "DependencyBlocked"
+	// ConditionDependencyCycle is set if the dependencies of the project form a cycle
+	ConditionDependencyCycle conditionv1.Type = "DependencyCycle"
+	// ConditionUnverified is set if the commit is not signed by a trusted key and therefore not deployed
+	ConditionUnverified conditionv1.Type = "SignatureUnverified"
 )
 
 type Project struct {
@@ -28,16 +41,52 @@ type Project struct {
 }
 
 type Spec struct {
-	LocalPath   string           `json:"localPath,omitempty"`
-	Repo        metav1.ObjectRef `json:"repo,omitempty"`
-	CommitId    string           `json:"commitId,omitempty"`
-	ComposePath string           `json:"composePath"`
+	LocalPath   string              `json:"localPath,omitempty"`
+	Repo        metav1.ObjectRef    `json:"repo,omitempty"`
+	CommitId    string              `json:"commitId,omitempty"`
+	ComposePath string              `json:"composePath"`
+	Hooks       *hookv1.Hooks       `json:"hooks,omitempty"`
+	DependsOn   []string            `json:"dependsOn,omitempty"`
+	Compose     *composev1.Config   `json:"compose,omitempty"`
+	Snapshots   *snapshotv1.Policy  `json:"snapshots,omitempty"`
+	Verify      *signaturev1.Policy `json:"verify,omitempty"`
+	// Labels are added to the containers of the project
+	Labels map[string]string `json:"labels,omitempty"`
+	// RestoreSnapshot requests to restore the volumes from the snapshot with this id; it is reset once it is done
+	RestoreSnapshot string `json:"restoreSnapshot,omitempty"`
+	// ReconcileRequest is the id of a request to redeploy the project even if its commit is unchanged; it is reset
+	// once the deployment is done
+	ReconcileRequest string `json:"reconcileRequest,omitempty"`
 }
 
 type Status struct {
 	Conditions          conditionv1.Conditions `json:"conditions,omitempty"`
 	LastAppliedCommitId string                 `json:"lastAppliedCommitId"`
 	ContainerCount      int                    `json:"containerCount"`
+	RolledBackCommitId  string                 `json:"rolledBackCommitId,omitempty"`
+	BlockedBy           []string               `json:"blockedBy,omitempty"`
+	// ConfigHash identifies the loaded compose project of the last deployment including rendered values and secrets
+	ConfigHash string `json:"configHash,omitempty"`
+	// LastSnapshot is the id of the snapshot taken before the last deployment of a new commit
+	LastSnapshot string `json:"lastSnapshot,omitempty"`
+	// ActiveColor is the blue/green set which is live, either blue or green; it is empty for recreated projects
+	ActiveColor string `json:"activeColor,omitempty"`
+	// Images maps service names to the image references including digest which the image update selected
+	Images map[string]string `json:"images,omitempty"`
+}
+
+// IsReady reports whether the current commit of the project has been deployed successfully
+func (p *Project) IsReady() bool {
+	if p.Spec == nil || p.Status == nil {
+		return false
+	}
+
+	if p.Status.LastAppliedCommitId != p.Spec.CommitId {
+		return false
+	}
+
+	_, ok := p.Status.Conditions[ConditionSuccess]
+	return ok
 }
 
 func (p *Project) DeepCopy() api.Object {
@@ -48,10 +97,28 @@ func (p *Project) DeepCopy() api.Object {
 
 	if p.Spec != nil {
 		n.Spec = &Spec{
-			LocalPath:   p.Spec.LocalPath,
-			Repo:        p.Spec.Repo.DeepCopy(),
-			CommitId:    p.Spec.CommitId,
-			ComposePath: p.Spec.ComposePath,
+			LocalPath:        p.Spec.LocalPath,
+			Repo:             p.Spec.Repo.DeepCopy(),
+			CommitId:         p.Spec.CommitId,
+			ComposePath:      p.Spec.ComposePath,
+			Hooks:            p.Spec.Hooks.DeepCopy(),
+			Compose:          p.Spec.Compose.DeepCopy(),
+			Snapshots:        p.Spec.Snapshots.DeepCopy(),
+			Verify:           p.Spec.Verify.DeepCopy(),
+			RestoreSnapshot:  p.Spec.RestoreSnapshot,
+			ReconcileRequest: p.Spec.ReconcileRequest,
+		}
+
+		if p.Spec.DependsOn != nil {
+			n.Spec.DependsOn = make([]string, len(p.Spec.DependsOn))
+			copy(n.Spec.DependsOn, p.Spec.DependsOn)
+		}
+
+		if p.Spec.Labels != nil {
+			n.Spec.Labels = make(map[string]string, len(p.Spec.Labels))
+			for key, value := range p.Spec.Labels {
+				n.Spec.Labels[key] = value
+			}
 		}
 	}
 
@@ -60,6 +127,22 @@ func (p *Project) DeepCopy() api.Object {
 			Conditions:          p.Status.Conditions.DeepCopy(),
 			LastAppliedCommitId: p.Status.LastAppliedCommitId,
 			ContainerCount:      p.Status.ContainerCount,
+			RolledBackCommitId:  p.Status.RolledBackCommitId,
+			ConfigHash:          p.Status.ConfigHash,
+			LastSnapshot:        p.Status.LastSnapshot,
+			ActiveColor:         p.Status.ActiveColor,
+		}
+
+		if p.Status.Images != nil {
+			n.Status.Images = make(map[string]string, len(p.Status.Images))
+			for service, image := range p.Status.Images {
+				n.Status.Images[service] = image
+			}
+		}
+
+		if p.Status.BlockedBy != nil {
+			n.Status.BlockedBy = make([]string, len(p.Status.BlockedBy))
+			copy(n.Status.BlockedBy, p.Status.BlockedBy)
 		}
 	}
 
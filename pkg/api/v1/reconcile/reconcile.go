@@ -0,0 +1,100 @@
+package reconcile
+
+import (
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+	"time"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Reconcile"}
+
+func init() {
+	schema.Register(VersionKind, &Reconcile{})
+}
+
+// Namespace of all reconcile requests
+const Namespace = "recoon-system"
+
+// targets of a reconcile request
+const (
+	// TargetAll pulls all app repositories
+	TargetAll = ""
+	// TargetRepository pulls a single app repository
+	TargetRepository = "repository"
+	// TargetProject redeploys a project even if its commit is unchanged
+	TargetProject = "project"
+	// TargetConfig pulls the config repo
+	TargetConfig = "config"
+)
+
+// Phase is the progress of a reconcile request
+type Phase string
+
+const (
+	PhasePending   Phase = "Pending"
+	PhaseRunning   Phase = "Running"
+	PhaseSucceeded Phase = "Succeeded"
+	PhaseFailed    Phase = "Failed"
+)
+
+// Reconcile is a request for an immediate reconciliation; its name is the request id
+type Reconcile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   *Spec   `json:"spec,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type Spec struct {
+	// Target is one of TargetAll, TargetRepository, TargetProject or TargetConfig
+	Target string `json:"target"`
+	// Name of the repository or project
+	Name string `json:"name,omitempty"`
+}
+
+type Status struct {
+	Phase     Phase      `json:"phase"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	// CommitId is the commit which got pulled or deployed
+	CommitId string `json:"commitId,omitempty"`
+	// Message is the error of a failed request
+	Message string `json:"message,omitempty"`
+}
+
+// IsFinished reports whether the request has succeeded or failed
+func (r *Reconcile) IsFinished() bool {
+	return r.Status != nil && (r.Status.Phase == PhaseSucceeded || r.Status.Phase == PhaseFailed)
+}
+
+func (r *Reconcile) DeepCopy() api.Object {
+	n := &Reconcile{
+		TypeMeta:   r.TypeMeta.DeepCopy(),
+		ObjectMeta: r.ObjectMeta.DeepCopy(),
+	}
+
+	if r.Spec != nil {
+		n.Spec = &Spec{
+			Target: r.Spec.Target,
+			Name:   r.Spec.Name,
+		}
+	}
+
+	if r.Status != nil {
+		n.Status = &Status{
+			Phase:     r.Status.Phase,
+			CreatedAt: r.Status.CreatedAt,
+			CommitId:  r.Status.CommitId,
+			Message:   r.Status.Message,
+		}
+
+		if r.Status.EndTime != nil {
+			endTime := *r.Status.EndTime
+			n.Status.EndTime = &endTime
+		}
+	}
+
+	return n
+}
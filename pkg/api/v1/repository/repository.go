@@ -2,9 +2,18 @@ package repository
 
 import (
 	"github.com/lacodon/recoon/pkg/api"
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
 	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	hookv1 "github.com/lacodon/recoon/pkg/api/v1/hook"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
 	"github.com/lacodon/recoon/pkg/schema"
+	"path"
+	"sort"
+	"strings"
+	"time"
 )
 
 var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Repository"}
@@ -13,6 +22,13 @@ func init() {
 	schema.Register(VersionKind, &Repository{})
 }
 
+const (
+	// ConditionRetryExhausted is set if the repository failed too often; it will only be retried on changes
+	ConditionRetryExhausted conditionv1.Type = "RetryExhausted"
+	// ConditionConfigInvalid is set on the config repo if its .recoon.config.yml can't be applied
+	ConditionConfigInvalid conditionv1.Type = "ConfigInvalid"
+)
+
 type Repository struct {
 	metav1.TypeMeta   `json:",inline" yaml:",inline"`
 	metav1.ObjectMeta `json:"metadata" yaml:"metadata"`
@@ -28,8 +44,145 @@ type Spec struct {
 	Url string `json:"url,omitempty"`
 	// Branch which should be reconciled
 	Branch string `json:"branch,omitempty"`
+	// Ref selects a tag or commit to deploy instead of the head of Branch
+	Ref *RefSelector `json:"ref,omitempty"`
+	// Credentials authenticate against Url; without them the global SSH key is used for SSH urls
+	Credentials *Credentials `json:"credentials,omitempty"`
+	// Depth limits the fetched history to the last Depth commits; 0 fetches the full history
+	Depth int `json:"depth,omitempty"`
+	// SparseCheckout only checks out Path and IncludePaths
+	SparseCheckout bool `json:"sparseCheckout,omitempty"`
+	// HostKeys pin the SSH host keys of Url in authorized_keys format; without them the known hosts are used
+	HostKeys []string `json:"hostKeys,omitempty"`
 	// Path where the docker-compose.yml can be found
 	Path string `json:"path,omitempty"`
+	// Overlay is the name of the environment this repository is deployed as; it is part of the object name
+	Overlay string `json:"overlay,omitempty"`
+	// IncludePaths limit the change detection to these paths; defaults to Path
+	IncludePaths []string `json:"includePaths,omitempty"`
+	// Hooks which run before and after the project gets deployed
+	Hooks *hookv1.Hooks `json:"hooks,omitempty"`
+	// DependsOn contains the project names which have to be ready before this project gets deployed
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Compose selects the compose files, profiles and env files below Path
+	Compose *composev1.Config `json:"compose,omitempty"`
+	// Snapshots enables snapshots of the volumes before a new commit gets deployed
+	Snapshots *snapshotv1.Policy `json:"snapshots,omitempty"`
+	// WebhookSecret verifies the push webhooks of the repository; without it, webhooks are rejected
+	WebhookSecret *secretv1.KeyRef `json:"webhookSecret,omitempty"`
+	// Verify lists the keys which have to sign a commit before it gets deployed
+	Verify *signaturev1.Policy `json:"verify,omitempty"`
+	// Interval overrides the reconciliation interval of the app repos for this repository, e.g. 5m
+	Interval string `json:"interval,omitempty"`
+	// Suspend stops pulling and deploying the repository until it is unset again
+	Suspend bool `json:"suspend,omitempty"`
+	// Labels are added to the containers of the project
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// GetInterval returns the parsed interval or defaultInterval if it is unset or invalid
+func (s *Spec) GetInterval(defaultInterval time.Duration) time.Duration {
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil || interval <= 0 {
+		return defaultInterval
+	}
+
+	return interval
+}
+
+// RefSelector selects the commit to deploy by tag, semver range over tags or commit SHA; only one field may be set
+type RefSelector struct {
+	// Tag is a fixed tag, e.g. v1.2.3
+	Tag string `json:"tag,omitempty" yaml:"tag"`
+	// Semver selects the highest tag in the range, e.g. ">=1.2 <2"; a leading v of the tags is ignored
+	Semver string `json:"semver,omitempty" yaml:"semver"`
+	// Commit is a fixed commit SHA or an unambiguous prefix of it
+	Commit string `json:"commit,omitempty" yaml:"commit"`
+}
+
+// String describes the selector, e.g. "semver >=1.2 <2"
+func (r *RefSelector) String() string {
+	switch {
+	case r == nil:
+		return ""
+	case r.Tag != "":
+		return "tag " + r.Tag
+	case r.Semver != "":
+		return "semver " + r.Semver
+	case r.Commit != "":
+		return "commit " + r.Commit
+	default:
+		return ""
+	}
+}
+
+func (r *RefSelector) DeepCopy() *RefSelector {
+	if r == nil {
+		return nil
+	}
+
+	n := *r
+	return &n
+}
+
+// Credentials reference the secret which authenticates the repository
+type Credentials struct {
+	// Secret contains an sshPrivateKey, a token or a username and password
+	Secret string `json:"secret" yaml:"secret"`
+	// GenerateDeployKey creates an SSH deploy key in Secret if it has none yet
+	GenerateDeployKey bool `json:"generateDeployKey,omitempty" yaml:"generateDeployKey"`
+}
+
+func (c *Credentials) DeepCopy() *Credentials {
+	if c == nil {
+		return nil
+	}
+
+	n := *c
+	return &n
+}
+
+// GetIncludePaths returns the paths which are relevant for the change detection of this repository
+func (s *Spec) GetIncludePaths() []string {
+	if len(s.IncludePaths) > 0 {
+		return s.IncludePaths
+	}
+
+	return []string{s.Path}
+}
+
+// GetSparseCheckoutDirectories returns the sorted directories relative to the repository root which are checked out
+// or nil if the whole repository is checked out
+func (s *Spec) GetSparseCheckoutDirectories() []string {
+	if !s.SparseCheckout {
+		return nil
+	}
+
+	dirs := make([]string, 0)
+	for _, p := range append([]string{s.Path}, s.GetIncludePaths()...) {
+		dir := strings.Trim(path.Clean("/"+p), "/")
+		if dir == "" {
+			// the root contains everything
+			return nil
+		}
+
+		if !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+func contains(list []string, s string) bool {
+	for _, el := range list {
+		if el == s {
+			return true
+		}
+	}
+
+	return false
 }
 
 type Status struct {
@@ -40,6 +193,10 @@ type Status struct {
 	LocalPath string `json:"localPath,omitempty"`
 	// CurrentCommitId is the id of the currently checked out git commit
 	CurrentCommitId string `json:"currentCommitId,omitempty"`
+	// ResolvedRef is the branch or tag which the current commit got selected by, e.g. refs/tags/v1.2.3
+	ResolvedRef string `json:"resolvedRef,omitempty"`
+	// DeployKey is the public key of the generated deploy key in authorized_keys format
+	DeployKey string `json:"deployKey,omitempty"`
 }
 
 func (r *Repository) DeepCopy() api.Object {
@@ -50,10 +207,44 @@ func (r *Repository) DeepCopy() api.Object {
 
 	if r.Spec != nil {
 		n.Spec = &Spec{
-			ProjectName: r.Spec.ProjectName,
-			Url:         r.Spec.Url,
-			Branch:      r.Spec.Branch,
-			Path:        r.Spec.Path,
+			ProjectName:    r.Spec.ProjectName,
+			Url:            r.Spec.Url,
+			Branch:         r.Spec.Branch,
+			Ref:            r.Spec.Ref.DeepCopy(),
+			Credentials:    r.Spec.Credentials.DeepCopy(),
+			Depth:          r.Spec.Depth,
+			SparseCheckout: r.Spec.SparseCheckout,
+			Path:           r.Spec.Path,
+			Overlay:        r.Spec.Overlay,
+			Hooks:          r.Spec.Hooks.DeepCopy(),
+			Compose:        r.Spec.Compose.DeepCopy(),
+			Snapshots:      r.Spec.Snapshots.DeepCopy(),
+			WebhookSecret:  r.Spec.WebhookSecret.DeepCopy(),
+			Verify:         r.Spec.Verify.DeepCopy(),
+			Interval:       r.Spec.Interval,
+			Suspend:        r.Spec.Suspend,
+		}
+
+		if r.Spec.IncludePaths != nil {
+			n.Spec.IncludePaths = make([]string, len(r.Spec.IncludePaths))
+			copy(n.Spec.IncludePaths, r.Spec.IncludePaths)
+		}
+
+		if r.Spec.HostKeys != nil {
+			n.Spec.HostKeys = make([]string, len(r.Spec.HostKeys))
+			copy(n.Spec.HostKeys, r.Spec.HostKeys)
+		}
+
+		if r.Spec.DependsOn != nil {
+			n.Spec.DependsOn = make([]string, len(r.Spec.DependsOn))
+			copy(n.Spec.DependsOn, r.Spec.DependsOn)
+		}
+
+		if r.Spec.Labels != nil {
+			n.Spec.Labels = make(map[string]string, len(r.Spec.Labels))
+			for key, value := range r.Spec.Labels {
+				n.Spec.Labels[key] = value
+			}
 		}
 	}
 
@@ -62,6 +253,8 @@ func (r *Repository) DeepCopy() api.Object {
 			Conditions:      r.Status.Conditions.DeepCopy(),
 			LocalPath:       r.Status.LocalPath,
 			CurrentCommitId: r.Status.CurrentCommitId,
+			ResolvedRef:     r.Status.ResolvedRef,
+			DeployKey:       r.Status.DeployKey,
 		}
 	}
 
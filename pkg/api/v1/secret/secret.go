@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+	"sort"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Secret"}
+
+// Namespace contains all secrets
+const Namespace = "default"
+
+func init() {
+	schema.Register(VersionKind, &Secret{})
+}
+
+// Secret holds sensitive values which must not be committed to a git repository
+type Secret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec *Spec `json:"spec,omitempty"`
+}
+
+type Spec struct {
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// KeyRef references the value of a key of a secret
+type KeyRef struct {
+	Name string `json:"name" yaml:"name"`
+	// Key defaults to DefaultKey
+	Key string `json:"key,omitempty" yaml:"key"`
+}
+
+// DefaultKey is used by key references without key
+const DefaultKey = "token"
+
+// GetKey returns the key of the reference or DefaultKey
+func (r *KeyRef) GetKey() string {
+	if r.Key == "" {
+		return DefaultKey
+	}
+
+	return r.Key
+}
+
+func (r *KeyRef) DeepCopy() *KeyRef {
+	if r == nil {
+		return nil
+	}
+
+	n := *r
+	return &n
+}
+
+// Value returns the value of key or false if it isn't set
+func (s *Secret) Value(key string) (string, bool) {
+	if s.Spec == nil {
+		return "", false
+	}
+
+	value, ok := s.Spec.Data[key]
+	return value, ok
+}
+
+// Keys returns the sorted keys of the secret data
+func (s *Secret) Keys() []string {
+	keys := make([]string, 0)
+	if s.Spec == nil {
+		return keys
+	}
+
+	for key := range s.Spec.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (s *Secret) DeepCopy() api.Object {
+	n := &Secret{
+		TypeMeta:   s.TypeMeta.DeepCopy(),
+		ObjectMeta: s.ObjectMeta.DeepCopy(),
+	}
+
+	if s.Spec != nil {
+		n.Spec = &Spec{}
+
+		if s.Spec.Data != nil {
+			n.Spec.Data = make(map[string]string, len(s.Spec.Data))
+			for k, v := range s.Spec.Data {
+				n.Spec.Data[k] = v
+			}
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,35 @@
+package signature
+
+// Policy lists the keys which are trusted to sign the commits of a repository; commits which are not signed by one
+// of them are not deployed
+type Policy struct {
+	// OpenPGPKeys are ASCII armored public keys
+	OpenPGPKeys []string `json:"openpgpKeys,omitempty" yaml:"openpgpKeys"`
+	// SSHKeys are public keys in authorized_keys format, e.g. "ssh-ed25519 AAAA... alice"
+	SSHKeys []string `json:"sshKeys,omitempty" yaml:"sshKeys"`
+}
+
+// IsEmpty reports whether no key is trusted, which disables the verification
+func (p *Policy) IsEmpty() bool {
+	return p == nil || len(p.OpenPGPKeys) == 0 && len(p.SSHKeys) == 0
+}
+
+func (p *Policy) DeepCopy() *Policy {
+	if p == nil {
+		return nil
+	}
+
+	n := &Policy{}
+
+	if p.OpenPGPKeys != nil {
+		n.OpenPGPKeys = make([]string, len(p.OpenPGPKeys))
+		copy(n.OpenPGPKeys, p.OpenPGPKeys)
+	}
+
+	if p.SSHKeys != nil {
+		n.SSHKeys = make([]string, len(p.SSHKeys))
+		copy(n.SSHKeys, p.SSHKeys)
+	}
+
+	return n
+}
@@ -0,0 +1,114 @@
+package snapshot
+
+import (
+	"fmt"
+	"github.com/lacodon/recoon/pkg/api"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/schema"
+	"time"
+)
+
+var VersionKind = metav1.VersionKind{Version: "v1", Kind: "Snapshot"}
+
+func init() {
+	schema.Register(VersionKind, &Snapshot{})
+}
+
+// DefaultKeep is the number of snapshots which are kept per project if the policy doesn't set it
+const DefaultKeep = 5
+
+// Policy enables snapshots of the named volumes of a project before a new commit gets deployed
+type Policy struct {
+	// Volumes are the keys of the volumes in the compose files; defaults to all volumes of the project
+	Volumes []string `json:"volumes,omitempty" yaml:"volumes"`
+	// Keep is the number of snapshots which are kept; defaults to DefaultKeep
+	Keep int `json:"keep,omitempty" yaml:"keep"`
+	// RestoreOnRollback restores the snapshot of the deployment if a failed hook rolls it back
+	RestoreOnRollback bool `json:"restoreOnRollback,omitempty" yaml:"restoreOnRollback"`
+}
+
+// GetKeep returns Keep or DefaultKeep if it isn't set
+func (p *Policy) GetKeep() int {
+	if p.Keep < 1 {
+		return DefaultKeep
+	}
+	return p.Keep
+}
+
+func (p *Policy) DeepCopy() *Policy {
+	if p == nil {
+		return nil
+	}
+
+	n := &Policy{
+		Keep:              p.Keep,
+		RestoreOnRollback: p.RestoreOnRollback,
+	}
+
+	if p.Volumes != nil {
+		n.Volumes = make([]string, len(p.Volumes))
+		copy(n.Volumes, p.Volumes)
+	}
+
+	return n
+}
+
+// Snapshot records the archives of the volumes of a project which are stored in the snapshot directory
+type Snapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec *Spec `json:"spec,omitempty"`
+}
+
+type Spec struct {
+	Project metav1.ObjectRef `json:"project"`
+	// ID identifies the snapshot within the project
+	ID string `json:"id"`
+	// CommitId is the commit which was deployed when the snapshot was taken
+	CommitId  string    `json:"commitId"`
+	Volumes   []Volume  `json:"volumes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Volume is the archive of a single docker volume
+type Volume struct {
+	// Name of the docker volume
+	Name string `json:"name"`
+	// File is the name of the archive in the directory of the snapshot
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+// MakeName returns the name of the snapshot with the given id of the project
+func MakeName(projectName, id string) string {
+	return fmt.Sprintf("%s.%s", projectName, id)
+}
+
+// MakeID returns the id of a snapshot taken at the given time
+func MakeID(t time.Time) string {
+	return t.UTC().Format("20060102-150405.000")
+}
+
+func (s *Snapshot) DeepCopy() api.Object {
+	n := &Snapshot{
+		TypeMeta:   s.TypeMeta.DeepCopy(),
+		ObjectMeta: s.ObjectMeta.DeepCopy(),
+	}
+
+	if s.Spec != nil {
+		n.Spec = &Spec{
+			Project:   s.Spec.Project.DeepCopy(),
+			ID:        s.Spec.ID,
+			CommitId:  s.Spec.CommitId,
+			CreatedAt: s.Spec.CreatedAt,
+		}
+
+		if s.Spec.Volumes != nil {
+			n.Spec.Volumes = make([]Volume, len(s.Spec.Volumes))
+			copy(n.Spec.Volumes, s.Spec.Volumes)
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"fmt"
+	deploymentv1 "github.com/lacodon/recoon/pkg/api/v1/deployment"
+	"github.com/lacodon/recoon/pkg/ui/handler"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+func (c *Client) GetDeployments(projectName string) ([]*deploymentv1.Deployment, error) {
+	resp, err := c.client.R().SetResult([]*deploymentv1.Deployment{}).Get("/deployment/" + url.PathEscape(projectName))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]*deploymentv1.Deployment), nil
+}
+
+// StreamDeploymentLog prints the log of the deployment and keeps polling for new output until it is finished if follow is set
+func (c *Client) StreamDeploymentLog(projectName string, revision int, follow bool) error {
+	offset := int64(0)
+
+	for {
+		resp, err := c.client.R().
+			SetResult(&handler.DeploymentLog{}).
+			SetQueryParam("offset", strconv.FormatInt(offset, 10)).
+			Get(fmt.Sprintf("/deployment/%s/%d/log", url.PathEscape(projectName), revision))
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode() != http.StatusOK {
+			return fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+		}
+
+		log := resp.Result().(*handler.DeploymentLog)
+		_, _ = fmt.Fprint(os.Stdout, log.Content)
+		offset = log.Offset
+
+		if !follow || log.Finished {
+			return nil
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
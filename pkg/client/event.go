@@ -0,0 +1,26 @@
+package client
+
+import (
+	"fmt"
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) GetEvents(namespace string) ([]*eventv1.Event, error) {
+	suffix := ""
+	if namespace != "" {
+		suffix = "/" + url.PathEscape(namespace)
+	}
+
+	resp, err := c.client.R().SetResult([]*eventv1.Event{}).Get("/event" + suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]*eventv1.Event), nil
+}
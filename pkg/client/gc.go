@@ -0,0 +1,28 @@
+package client
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/lacodon/recoon/pkg/gc"
+	"net/http"
+)
+
+// GarbageCollect runs the garbage collection; in a dry run it only reports what would be removed
+func (c *Client) GarbageCollect(dryRun bool) (*gc.Report, error) {
+	var resp *resty.Response
+	var err error
+	if dryRun {
+		resp, err = c.client.R().SetResult(&gc.Report{}).Get("/gc")
+	} else {
+		resp, err = c.client.R().SetResult(&gc.Report{}).Post("/gc")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return resp.Result().(*gc.Report), nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"fmt"
+	knownhostv1 "github.com/lacodon/recoon/pkg/api/v1/knownhost"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) GetKnownHosts() ([]*knownhostv1.KnownHost, error) {
+	resp, err := c.client.R().SetResult([]*knownhostv1.KnownHost{}).Get("/knownhost")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]*knownhostv1.KnownHost), nil
+}
+
+// SetKnownHost replaces the trusted keys of the host; without keys, recoon scans the host for its keys
+func (c *Client) SetKnownHost(host string, keys []string) (*knownhostv1.KnownHost, error) {
+	if keys == nil {
+		keys = make([]string, 0)
+	}
+
+	resp, err := c.client.R().SetBody(keys).SetResult(&knownhostv1.KnownHost{}).Put("/knownhost/" + url.PathEscape(host))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return resp.Result().(*knownhostv1.KnownHost), nil
+}
+
+func (c *Client) DeleteKnownHost(host string) error {
+	resp, err := c.client.R().Delete("/knownhost/" + url.PathEscape(host))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return nil
+}
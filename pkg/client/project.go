@@ -32,3 +32,17 @@ func (c *Client) GetProject(name string) (*projectv1.Project, error) {
 
 	return resp.Result().(*projectv1.Project), nil
 }
+
+// RenderProject returns the compose project as it gets deployed with all files, patches and templates applied
+func (c *Client) RenderProject(name string) (string, error) {
+	resp, err := c.client.R().Get(fmt.Sprintf("/project/project-%s/%s/render", url.PathEscape(name), url.PathEscape(name)))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return string(resp.Body()), nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Reconcile requests an immediate reconciliation of the target, see reconcilev1.Spec
+func (c *Client) Reconcile(target, name string) (*reconcilev1.Reconcile, error) {
+	resp, err := c.client.R().
+		SetBody(&reconcilev1.Spec{Target: target, Name: name}).
+		SetResult(&reconcilev1.Reconcile{}).
+		Post("/reconcile")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return resp.Result().(*reconcilev1.Reconcile), nil
+}
+
+func (c *Client) GetReconcile(id string) (*reconcilev1.Reconcile, error) {
+	resp, err := c.client.R().SetResult(&reconcilev1.Reconcile{}).Get("/reconcile/" + url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return resp.Result().(*reconcilev1.Reconcile), nil
+}
+
+// WaitReconcile polls the reconcile request until it is finished or the timeout has passed
+func (c *Client) WaitReconcile(id string, timeout time.Duration) (*reconcilev1.Reconcile, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		request, err := c.GetReconcile(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if request.IsFinished() {
+			return request, nil
+		}
+
+		if time.Now().After(deadline) {
+			return request, fmt.Errorf("request %s is still %s after %s", id, request.Status.Phase, timeout)
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
@@ -0,0 +1,20 @@
+package client
+
+import (
+	"fmt"
+	"github.com/lacodon/recoon/pkg/retry"
+	"net/http"
+)
+
+func (c *Client) GetRetryStates() ([]retry.State, error) {
+	resp, err := c.client.R().SetResult([]retry.State{}).Get("/retry")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]retry.State), nil
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"fmt"
+	"github.com/lacodon/recoon/pkg/ui/handler"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) GetSecrets() ([]handler.SecretInfo, error) {
+	resp, err := c.client.R().SetResult([]handler.SecretInfo{}).Get("/secret")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]handler.SecretInfo), nil
+}
+
+// SetSecret creates the secret or sets the given keys of an existing one
+func (c *Client) SetSecret(name string, data map[string]string) error {
+	resp, err := c.client.R().SetBody(data).Put("/secret/" + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteSecret(name string) error {
+	resp, err := c.client.R().Delete("/secret/" + url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
+	"net/http"
+	"net/url"
+)
+
+func (c *Client) GetSnapshots(projectName string) ([]*snapshotv1.Snapshot, error) {
+	resp, err := c.client.R().SetResult([]*snapshotv1.Snapshot{}).Get("/snapshot/" + url.PathEscape(projectName))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return *resp.Result().(*[]*snapshotv1.Snapshot), nil
+}
+
+// RestoreSnapshot requests to stop the project, restore its volumes from the snapshot and redeploy it
+func (c *Client) RestoreSnapshot(projectName, id string) error {
+	resp, err := c.client.R().Post(fmt.Sprintf("/snapshot/%s/%s/restore", url.PathEscape(projectName), url.PathEscape(id)))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-cmd/cmd"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strings"
+)
+
+type cliEngine struct{}
+
+// NewCLIEngine returns an Engine which shells out to the docker compose CLI plugin
+func NewCLIEngine() Engine {
+	return &cliEngine{}
+}
+
+func (e *cliEngine) Up(ctx context.Context, opts Options) (*Result, error) {
+	opts, cleanup, err := renderPatched(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	buildCmd := newStreamingCmd("docker", append(composeArgs(opts), "build", "--pull", "--progress", "plain")...)
+	buildCmd.Dir = opts.WorkingDir
+	if output, err := runStreaming(ctx, buildCmd, "docker-compose build", opts.output()); err != nil {
+		return nil, withOutput(err, output)
+	}
+
+	upCmd := newStreamingCmd("docker", append(composeArgs(opts), "up", "-d", "--quiet-pull", "--remove-orphans")...)
+	upCmd.Dir = opts.WorkingDir
+	if output, err := runStreaming(ctx, upCmd, "docker-compose up", opts.output()); err != nil {
+		return nil, withOutput(err, output)
+	}
+
+	logrus.WithField("project", opts.ProjectName).Debug("successfully ran docker-compose up")
+
+	// the CLI doesn't report what it did, so the result is derived from the running containers
+	containers, err := Status(ctx, opts.ProjectName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	byService := make(map[string]int)
+	for _, container := range containers {
+		service := container.Labels[LabelService]
+		idx, ok := byService[service]
+		if !ok {
+			idx = len(result.Services)
+			byService[service] = idx
+			result.Services = append(result.Services, ServiceResult{Service: service, Action: ActionApplied})
+		}
+		result.Services[idx].ContainerIDs = append(result.Services[idx].ContainerIDs, container.ID)
+	}
+
+	return result, nil
+}
+
+func (e *cliEngine) Down(ctx context.Context, opts Options) error {
+	// without its files, down still finds all containers and networks by the project name
+	args := []string{"compose", "-p", opts.ProjectName}
+	if filesExist(append([]string{opts.WorkingDir}, opts.resolve(opts.ConfigFiles)...)) {
+		if rendered, cleanup, err := renderPatched(opts); err == nil {
+			defer cleanup()
+			args = composeArgs(rendered)
+		}
+	}
+
+	downCmd := cmd.NewCmd("docker", append(args, "down", "--remove-orphans", "--rmi", "all")...)
+	if output, err := runOneShot(ctx, downCmd, "docker-compose down"); err != nil {
+		return withOutput(err, output)
+	}
+
+	logrus.WithField("project", opts.ProjectName).Debug("successfully ran docker-compose down")
+	return nil
+}
+
+func (e *cliEngine) Run(ctx context.Context, opts Options, service string, command []string) (string, error) {
+	opts, cleanup, err := renderPatched(opts)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	args := append(append(composeArgs(opts), "run", "--rm", "-T", service), command...)
+
+	runCmd := cmd.NewCmd("docker", args...)
+	runCmd.Dir = opts.WorkingDir
+
+	return runOneShot(ctx, runCmd, "docker-compose run")
+}
+
+func (e *cliEngine) RunImage(ctx context.Context, image string, command []string) (string, error) {
+	args := append([]string{"run", "--rm", image}, command...)
+
+	return runOneShot(ctx, cmd.NewCmd("docker", args...), "docker run")
+}
+
+// composeArgs returns the arguments of docker compose which select the project and its files
+func composeArgs(opts Options) []string {
+	args := []string{"compose", "-p", opts.ProjectName}
+	if opts.WorkingDir != "" {
+		args = append(args, "--project-directory", opts.WorkingDir)
+	}
+	for _, file := range opts.resolve(opts.ConfigFiles) {
+		args = append(args, "-f", file)
+	}
+	for _, profile := range opts.Profiles {
+		args = append(args, "--profile", profile)
+	}
+	for _, envFile := range opts.resolve(opts.EnvFiles) {
+		args = append(args, "--env-file", envFile)
+	}
+
+	return args
+}
+
+// renderPatched writes the patched, rendered or interpolated project to a temporary compose file because the CLI
+// supports none of them
+func renderPatched(opts Options) (Options, func(), error) {
+	if len(opts.Patches) == 0 && opts.Render == nil && len(opts.Images) == 0 && len(opts.Labels) == 0 &&
+		len(opts.Environment) == 0 {
+		return opts, func() {}, nil
+	}
+
+	project, err := LoadProject(opts)
+	if err != nil {
+		return opts, nil, err
+	}
+
+	data, err := project.MarshalYAML()
+	if err != nil {
+		return opts, nil, errors.WithMessage(err, "failed to marshal compose project")
+	}
+
+	file, err := os.CreateTemp("", "recoon-"+opts.ProjectName+"-*.yml")
+	if err != nil {
+		return opts, nil, err
+	}
+	cleanup := func() { _ = os.Remove(file.Name()) }
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return opts, nil, errors.WithMessage(err, "failed to write compose file")
+	}
+
+	opts.ConfigFiles = []string{file.Name()}
+	opts.Patches = nil
+	opts.Render = nil
+	opts.Images = nil
+	opts.Labels = nil
+	opts.Environment = nil
+	return opts, cleanup, nil
+}
+
+func filesExist(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newStreamingCmd(name string, args ...string) *cmd.Cmd {
+	return cmd.NewCmdOptions(cmd.Options{Buffered: true, Streaming: true}, name, args...)
+}
+
+// runStreaming runs a command created by newStreamingCmd and copies its output line by line to out
+func runStreaming(ctx context.Context, streamingCmd *cmd.Cmd, description string, out io.Writer) (string, error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// both channels are closed once the command has finished
+		stdout, stderr := streamingCmd.Stdout, streamingCmd.Stderr
+		for stdout != nil || stderr != nil {
+			select {
+			case line, ok := <-stdout:
+				if !ok {
+					stdout = nil
+					continue
+				}
+				_, _ = fmt.Fprintln(out, line)
+			case line, ok := <-stderr:
+				if !ok {
+					stderr = nil
+					continue
+				}
+				_, _ = fmt.Fprintln(out, line)
+			}
+		}
+	}()
+
+	output, err := runOneShot(ctx, streamingCmd, description)
+	<-done
+
+	return output, err
+}
+
+func runOneShot(ctx context.Context, oneShotCmd *cmd.Cmd, description string) (string, error) {
+	statusChan := oneShotCmd.Start()
+
+	var status cmd.Status
+	select {
+	case status = <-statusChan:
+	case <-ctx.Done():
+		_ = oneShotCmd.Stop()
+		status = <-statusChan
+		status.Error = errors.WithMessage(ctx.Err(), "aborted")
+	}
+
+	output := strings.Join(append(status.Stdout, status.Stderr...), "\n")
+	if status.Error != nil {
+		return output, errors.WithMessage(status.Error, "error during "+description)
+	}
+
+	if status.Exit != 0 {
+		return output, fmt.Errorf("error during %s: exit code %d", description, status.Exit)
+	}
+
+	return output, nil
+}
+
+func withOutput(err error, output string) error {
+	return fmt.Errorf("%w ;;; %s", err, output)
+}
@@ -4,86 +4,142 @@ import (
 	"context"
 	"fmt"
 	dockertypes "github.com/docker/docker/api/types"
-	dockerfilters "github.com/docker/docker/api/types/filters"
 	dockerclient "github.com/docker/docker/client"
-	"github.com/go-cmd/cmd"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"io"
-	"strings"
+	"path/filepath"
 )
 
-func Up(projectName, directory string) error {
-	buildCmd := cmd.NewCmd("docker", "compose", "build", "--pull", "--progress", "plain")
-	buildCmd.Dir = directory
-	buildChan := buildCmd.Start()
-	buildEvent := <-buildChan
-	if buildEvent.Exit != 0 {
-		return fmt.Errorf("error during docker-compose build: %s ;;; %s", strings.Join(buildEvent.Stdout, "\n"), strings.Join(buildEvent.Stderr, "\n"))
-	}
+const (
+	// EngineNative loads compose files with compose-go and talks to the Docker Engine API directly
+	EngineNative = "native"
+	// EngineCLI shells out to the docker compose CLI plugin
+	EngineCLI = "cli"
+)
+
+// Options describe the compose project to operate on
+type Options struct {
+	// ProjectName is the compose project name used to label all resources
+	ProjectName string
+	// WorkingDir is the project directory which relative paths are resolved against
+	WorkingDir string
+	// ConfigFiles are merged in order; defaults to the compose file in WorkingDir
+	ConfigFiles []string
+	// Patches are applied in order on the model of the merged ConfigFiles, see applyPatches
+	Patches []string
+	// Profiles to activate in addition to the services without a profile
+	Profiles []string
+	// EnvFiles replace the .env file of WorkingDir for the variable interpolation
+	EnvFiles []string
+	// Environment contains variables for the interpolation which take precedence over EnvFiles
+	Environment map[string]string
+	// Render transforms the content of the compose files and patches before they get parsed if set
+	Render RenderFunc
+	// Images replace the image of the services with the given names, e.g. with the result of an image update
+	Images map[string]string
+	// Labels are added to every service, e.g. LabelOwner
+	Labels map[string]string
+	// Output receives the progress of build and up if set
+	Output io.Writer
+}
 
-	composeCmd := cmd.NewCmd("docker", "compose", "-p", projectName, "up", "-d", "--quiet-pull", "--remove-orphans")
-	composeCmd.Dir = directory
-	composeChan := composeCmd.Start()
-	finalEvent := <-composeChan
-	if finalEvent.Exit != 0 {
-		return fmt.Errorf("error during docker-compose up: %s ;;; %s", strings.Join(finalEvent.Stdout, "\n"), strings.Join(finalEvent.Stderr, "\n"))
+// RenderFunc returns the rendered content of the file with the given name
+type RenderFunc func(name string, content []byte) ([]byte, error)
+
+func (o Options) output() io.Writer {
+	if o.Output == nil {
+		return io.Discard
 	}
 
-	logrus.WithField("project", projectName).Debug("successfully ran docker-compose up")
-	return nil
+	return o.Output
 }
 
-func Down(projectName string) error {
-	composeCmd := cmd.NewCmd("docker", "compose", "-p", projectName, "down", "--remove-orphans", "--rmi", "all")
-	composeChan := composeCmd.Start()
-	finalEvent := <-composeChan
-	if finalEvent.Exit != 0 {
-		return fmt.Errorf("error during docker-compose down: %s ;;; %s", strings.Join(finalEvent.Stdout, "\n"), strings.Join(finalEvent.Stderr, "\n"))
+// environment returns Environment as KEY=VALUE pairs
+func (o Options) environment() []string {
+	env := make([]string, 0, len(o.Environment))
+	for key, value := range o.Environment {
+		env = append(env, key+"="+value)
 	}
-	logrus.WithField("project", projectName).Debug("successfully ran docker-compose down")
-	return nil
+
+	return env
 }
 
-func Status(ctx context.Context, projectName string) ([]dockertypes.Container, error) {
-	client, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
-	if err != nil {
-		return nil, errors.WithMessage(err, "failed to connect to docker socket")
+// resolve makes the paths absolute using WorkingDir as base
+func (o Options) resolve(paths []string) []string {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(o.WorkingDir, path)
+		}
+		resolved = append(resolved, path)
 	}
 
-	var filters dockerfilters.Args
-	if projectName != "" {
-		filters = dockerfilters.NewArgs(dockerfilters.Arg("label", fmt.Sprintf("com.docker.compose.project=%s", projectName)))
+	return resolved
+}
+
+// ServiceResult is the outcome of applying a single service
+type ServiceResult struct {
+	Service string `json:"service"`
+	// Action is what has been done with the containers of the service, e.g. created, recreated or unchanged
+	Action       string   `json:"action"`
+	ContainerIDs []string `json:"containerIds,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Result is the outcome of Engine.Up
+type Result struct {
+	Services []ServiceResult `json:"services"`
+}
+
+// ContainerCount returns the number of containers of all services
+func (r *Result) ContainerCount() int {
+	count := 0
+	for _, service := range r.Services {
+		count += len(service.ContainerIDs)
 	}
 
-	return client.ContainerList(ctx, dockertypes.ContainerListOptions{
-		All:     true,
-		Filters: filters,
-	})
+	return count
 }
 
-func Logs(ctx context.Context, containerId string, since string, tail string) (string, error) {
-	if tail == "" {
-		tail = "all"
+// Engine applies compose projects to the container runtime
+type Engine interface {
+	// Up builds, pulls and (re)creates all services of the project and removes orphaned containers
+	Up(ctx context.Context, opts Options) (*Result, error)
+	// Down removes all containers, networks and images of the project
+	Down(ctx context.Context, opts Options) error
+	// Run runs the command in a one-shot container of the given service and returns its output
+	Run(ctx context.Context, opts Options, service string, command []string) (string, error)
+	// RunImage runs the command in a one-shot container of the given image and returns its output
+	RunImage(ctx context.Context, image string, command []string) (string, error)
+}
+
+// NewEngine returns the engine with the given name
+func NewEngine(name string) (Engine, error) {
+	switch name {
+	case EngineCLI, "":
+		return NewCLIEngine(), nil
+	case EngineNative:
+		return NewNativeEngine(), nil
+	default:
+		return nil, fmt.Errorf("unknown compose engine %q", name)
 	}
+}
 
+func newDockerClient() (*dockerclient.Client, error) {
 	client, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
 	if err != nil {
-		return "nil", errors.WithMessage(err, "failed to connect to docker socket")
+		return nil, errors.WithMessage(err, "failed to connect to docker socket")
 	}
 
-	reader, err := client.ContainerLogs(ctx, containerId, dockertypes.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Since:      since,
-		Timestamps: true,
-		Tail:       tail,
-	})
-	if err != nil {
-		return "", err
-	}
-	defer reader.Close()
+	return client, nil
+}
 
-	logs, err := io.ReadAll(reader)
-	return string(logs), err
+// Status lists the containers of the project or of all projects if projectName is empty
+func Status(ctx context.Context, projectName string) ([]dockertypes.Container, error) {
+	return NewDockerRuntime().Status(ctx, projectName)
+}
+
+// Logs returns the logs of the container
+func Logs(ctx context.Context, containerId string, since string, tail string) (string, error) {
+	return NewDockerRuntime().Logs(ctx, containerId, since, tail)
 }
@@ -0,0 +1,329 @@
+package compose
+
+import (
+	"fmt"
+	composetypes "github.com/compose-spec/compose-go/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// makeContainerConfig converts the compose service into the engine API configuration. The first network is part
+// of the NetworkingConfig, all others have to be connected after the container has been created.
+func makeContainerConfig(project *composetypes.Project, service composetypes.ServiceConfig, image string, number int) (*container.Config, *container.HostConfig, *network.NetworkingConfig, map[string]*network.EndpointSettings) {
+	labels := map[string]string{
+		LabelProject:         project.Name,
+		LabelService:         service.Name,
+		LabelContainerNumber: strconv.Itoa(number),
+		LabelOneOff:          "False",
+		LabelWorkingDir:      project.WorkingDir,
+	}
+	for k, v := range service.Labels {
+		labels[k] = v
+	}
+
+	exposedPorts, portBindings := makePorts(service)
+
+	config := &container.Config{
+		Hostname:     service.Hostname,
+		Domainname:   service.DomainName,
+		User:         service.User,
+		ExposedPorts: exposedPorts,
+		Tty:          service.Tty,
+		OpenStdin:    service.StdinOpen,
+		Env:          makeEnv(service.Environment),
+		Image:        image,
+		WorkingDir:   service.WorkingDir,
+		Labels:       labels,
+		StopSignal:   service.StopSignal,
+		Healthcheck:  makeHealthcheck(service.HealthCheck),
+	}
+
+	if service.Command != nil {
+		config.Cmd = strslice.StrSlice(service.Command)
+	}
+
+	if service.Entrypoint != nil {
+		config.Entrypoint = strslice.StrSlice(service.Entrypoint)
+	}
+
+	if service.StopGracePeriod != nil {
+		timeout := int(time.Duration(*service.StopGracePeriod).Seconds())
+		config.StopTimeout = &timeout
+	}
+
+	binds, mounts := makeMounts(project, service)
+
+	hostConfig := &container.HostConfig{
+		Binds:          binds,
+		Mounts:         mounts,
+		PortBindings:   portBindings,
+		RestartPolicy:  makeRestartPolicy(service.Restart),
+		CapAdd:         service.CapAdd,
+		CapDrop:        service.CapDrop,
+		DNS:            service.DNS,
+		DNSOptions:     service.DNSOpts,
+		DNSSearch:      service.DNSSearch,
+		ExtraHosts:     makeExtraHosts(service.ExtraHosts),
+		GroupAdd:       service.GroupAdd,
+		IpcMode:        container.IpcMode(service.Ipc),
+		PidMode:        container.PidMode(service.Pid),
+		Privileged:     service.Privileged,
+		ReadonlyRootfs: service.ReadOnly,
+		SecurityOpt:    service.SecurityOpt,
+		Tmpfs:          makeTmpfs(service.Tmpfs),
+		Sysctls:        service.Sysctls,
+		Init:           service.Init,
+		Runtime:        service.Runtime,
+		ShmSize:        int64(service.ShmSize),
+		Resources: container.Resources{
+			Memory:            int64(service.MemLimit),
+			MemoryReservation: int64(service.MemReservation),
+			NanoCPUs:          int64(service.CPUS * 1e9),
+			CPUShares:         service.CPUShares,
+			PidsLimit:         makePidsLimit(service.PidsLimit),
+		},
+	}
+
+	if service.Logging != nil {
+		hostConfig.LogConfig = container.LogConfig{
+			Type:   service.Logging.Driver,
+			Config: service.Logging.Options,
+		}
+	}
+
+	if service.NetworkMode != "" {
+		hostConfig.NetworkMode = container.NetworkMode(service.NetworkMode)
+		return config, hostConfig, nil, nil
+	}
+
+	var networkingConfig *network.NetworkingConfig
+	extraNetworks := make(map[string]*network.EndpointSettings)
+	for i, key := range networksByPriority(service) {
+		name := key
+		if config, ok := project.Networks[key]; ok {
+			name = config.Name
+		}
+
+		endpoint := &network.EndpointSettings{
+			Aliases: []string{service.Name},
+		}
+		if serviceNetwork := service.Networks[key]; serviceNetwork != nil {
+			endpoint.Aliases = append(endpoint.Aliases, serviceNetwork.Aliases...)
+			if serviceNetwork.Ipv4Address != "" || serviceNetwork.Ipv6Address != "" {
+				endpoint.IPAMConfig = &network.EndpointIPAMConfig{
+					IPv4Address: serviceNetwork.Ipv4Address,
+					IPv6Address: serviceNetwork.Ipv6Address,
+				}
+			}
+		}
+
+		if i == 0 {
+			hostConfig.NetworkMode = container.NetworkMode(name)
+			networkingConfig = &network.NetworkingConfig{
+				EndpointsConfig: map[string]*network.EndpointSettings{name: endpoint},
+			}
+			continue
+		}
+
+		extraNetworks[name] = endpoint
+	}
+
+	return config, hostConfig, networkingConfig, extraNetworks
+}
+
+// networksByPriority returns the network keys of the service, highest priority first
+func networksByPriority(service composetypes.ServiceConfig) []string {
+	keys := make([]string, 0, len(service.Networks))
+	for key := range service.Networks {
+		keys = append(keys, key)
+	}
+
+	priority := func(key string) int {
+		if config := service.Networks[key]; config != nil {
+			return config.Priority
+		}
+		return 0
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if priority(keys[i]) != priority(keys[j]) {
+			return priority(keys[i]) > priority(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+func makeEnv(environment composetypes.MappingWithEquals) []string {
+	env := make([]string, 0, len(environment))
+	for key, value := range environment {
+		// variables without value are not set at all
+		if value == nil {
+			continue
+		}
+		env = append(env, key+"="+*value)
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+func makePorts(service composetypes.ServiceConfig) (nat.PortSet, nat.PortMap) {
+	exposedPorts := nat.PortSet{}
+	portBindings := nat.PortMap{}
+
+	for _, expose := range service.Expose {
+		port := expose
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		exposedPorts[nat.Port(port)] = struct{}{}
+	}
+
+	for _, config := range service.Ports {
+		protocol := config.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		port := nat.Port(fmt.Sprintf("%d/%s", config.Target, protocol))
+		exposedPorts[port] = struct{}{}
+		portBindings[port] = append(portBindings[port], nat.PortBinding{
+			HostIP:   config.HostIP,
+			HostPort: config.Published,
+		})
+	}
+
+	return exposedPorts, portBindings
+}
+
+// makeMounts returns bind mounts in the binds format, because in contrast to mounts missing host paths get created
+func makeMounts(project *composetypes.Project, service composetypes.ServiceConfig) ([]string, []mount.Mount) {
+	var binds []string
+	var mounts []mount.Mount
+
+	for _, config := range service.Volumes {
+		switch config.Type {
+		case composetypes.VolumeTypeBind:
+			bind := config.Source + ":" + config.Target
+			var options []string
+			if config.ReadOnly {
+				options = append(options, "ro")
+			}
+			if config.Bind != nil && config.Bind.SELinux != "" {
+				options = append(options, config.Bind.SELinux)
+			}
+			if config.Bind != nil && config.Bind.Propagation != "" {
+				options = append(options, config.Bind.Propagation)
+			}
+			if len(options) > 0 {
+				bind += ":" + strings.Join(options, ",")
+			}
+			binds = append(binds, bind)
+		case composetypes.VolumeTypeVolume:
+			source := config.Source
+			if volume, ok := project.Volumes[config.Source]; ok {
+				source = volume.Name
+			}
+			m := mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   source,
+				Target:   config.Target,
+				ReadOnly: config.ReadOnly,
+			}
+			if config.Volume != nil {
+				m.VolumeOptions = &mount.VolumeOptions{NoCopy: config.Volume.NoCopy}
+			}
+			mounts = append(mounts, m)
+		case composetypes.VolumeTypeTmpfs:
+			m := mount.Mount{
+				Type:   mount.TypeTmpfs,
+				Target: config.Target,
+			}
+			if config.Tmpfs != nil {
+				m.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: int64(config.Tmpfs.Size)}
+			}
+			mounts = append(mounts, m)
+		}
+	}
+
+	return binds, mounts
+}
+
+func makeRestartPolicy(restart string) container.RestartPolicy {
+	name, retries, _ := strings.Cut(restart, ":")
+	policy := container.RestartPolicy{Name: name}
+	if retries != "" {
+		policy.MaximumRetryCount, _ = strconv.Atoi(retries)
+	}
+
+	return policy
+}
+
+func makeExtraHosts(hosts composetypes.HostsList) []string {
+	extraHosts := make([]string, 0, len(hosts))
+	for host, ip := range hosts {
+		extraHosts = append(extraHosts, host+":"+ip)
+	}
+	sort.Strings(extraHosts)
+
+	return extraHosts
+}
+
+func makeTmpfs(tmpfs composetypes.StringList) map[string]string {
+	if len(tmpfs) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(tmpfs))
+	for _, entry := range tmpfs {
+		path, options, _ := strings.Cut(entry, ":")
+		result[path] = options
+	}
+
+	return result
+}
+
+func makeHealthcheck(healthcheck *composetypes.HealthCheckConfig) *container.HealthConfig {
+	if healthcheck == nil {
+		return nil
+	}
+
+	if healthcheck.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}
+	}
+
+	config := &container.HealthConfig{
+		Test: healthcheck.Test,
+	}
+	if healthcheck.Interval != nil {
+		config.Interval = time.Duration(*healthcheck.Interval)
+	}
+	if healthcheck.Timeout != nil {
+		config.Timeout = time.Duration(*healthcheck.Timeout)
+	}
+	if healthcheck.StartPeriod != nil {
+		config.StartPeriod = time.Duration(*healthcheck.StartPeriod)
+	}
+	if healthcheck.Retries != nil {
+		config.Retries = int(*healthcheck.Retries)
+	}
+
+	return config
+}
+
+func makePidsLimit(limit int64) *int64 {
+	if limit == 0 {
+		return nil
+	}
+
+	return &limit
+}
@@ -0,0 +1,625 @@
+// Package fake provides an in-process compose.Engine and compose.ContainerRuntime which simulate containers,
+// their state transitions and the resulting docker events without a docker daemon.
+package fake
+
+import (
+	"context"
+	"fmt"
+	composetypes "github.com/compose-spec/compose-go/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/lacodon/recoon/pkg/compose"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// container states as reported by docker
+const (
+	StateCreated = "created"
+	StateRunning = "running"
+	StateExited  = "exited"
+)
+
+// Call is a recorded call of an engine method
+type Call struct {
+	Method      string
+	ProjectName string
+	WorkingDir  string
+	ConfigFiles []string
+	Profiles    []string
+	Service     string
+	Image       string
+	Command     []string
+	Binds       []string
+}
+
+// Backend implements compose.Engine and compose.ContainerRuntime
+type Backend struct {
+	mu         sync.Mutex
+	containers map[string]*dockertypes.Container
+	nextId     int
+	calls      []Call
+	// errors holds the error which is returned by the next calls of a method for a project
+	errors      map[string]error
+	outputs     map[string]string
+	subscribers map[chan events.Message]bool
+	images      map[string]*dockertypes.ImageSummary
+	buildCache  []*dockertypes.BuildCache
+	// volumes maps the volume names to their project
+	volumes map[string]string
+	// networks maps the network names to the aliases of the attached containers
+	networks map[string]map[string][]string
+	// health is the health of the containers which are started in a project
+	health map[string]string
+}
+
+var _ compose.Engine = &Backend{}
+var _ compose.ContainerRuntime = &Backend{}
+
+func New() *Backend {
+	return &Backend{
+		containers:  make(map[string]*dockertypes.Container),
+		errors:      make(map[string]error),
+		outputs:     make(map[string]string),
+		subscribers: make(map[chan events.Message]bool),
+		images:      make(map[string]*dockertypes.ImageSummary),
+		volumes:     make(map[string]string),
+		networks:    make(map[string]map[string][]string),
+		health:      make(map[string]string),
+	}
+}
+
+// AddImage adds an image to the host; images of containers are identified by "sha256:" and the image reference
+func (b *Backend) AddImage(id string, repoTags []string, labels map[string]string, size int64, created time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.images[id] = &dockertypes.ImageSummary{
+		ID:       id,
+		RepoTags: repoTags,
+		Labels:   labels,
+		Size:     size,
+		Created:  created.Unix(),
+	}
+}
+
+// AddBuildCache adds a build cache record to the host
+func (b *Backend) AddBuildCache(id string, size int64, lastUsed time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buildCache = append(b.buildCache, &dockertypes.BuildCache{
+		ID:         id,
+		Size:       size,
+		LastUsedAt: &lastUsed,
+	})
+}
+
+// Images returns the ids of all images of the host
+func (b *Backend) Images() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]string, 0, len(b.images))
+	for id := range b.images {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// CreateContainer creates a stopped container of the project, e.g. one which is left over by a deleted project
+func (b *Backend) CreateContainer(projectName, service, image string, labels map[string]string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.create(projectName, service, image, labels).ID
+}
+
+// SetHealth sets the health of the containers which are started in the project from now on
+func (b *Backend) SetHealth(projectName, health string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.health[projectName] = health
+}
+
+// NetworkAliases returns the aliases of the containers attached to the network by container id
+func (b *Backend) NetworkAliases(name string) map[string][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	aliases := make(map[string][]string, len(b.networks[name]))
+	for id, containerAliases := range b.networks[name] {
+		aliases[id] = containerAliases
+	}
+
+	return aliases
+}
+
+// SetError lets all following calls of method (Up, Down, Run, RunImage, RunHelper or EnsureNetwork) for the project fail; nil resets it.
+// The project of RunImage and RunHelper is the image.
+func (b *Backend) SetError(method, projectName string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := method + "/" + projectName
+	if err == nil {
+		delete(b.errors, key)
+		return
+	}
+	b.errors[key] = err
+}
+
+// SetOutput sets the output of Run for the service or of RunImage for the image
+func (b *Backend) SetOutput(serviceOrImage, output string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.outputs[serviceOrImage] = output
+}
+
+// Calls returns all recorded calls of the method for the project; an empty method matches all methods
+func (b *Backend) Calls(method, projectName string) []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	calls := make([]Call, 0)
+	for _, call := range b.calls {
+		if (method == "" || call.Method == method) && call.ProjectName == projectName {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Containers returns a copy of the containers of the project sorted by name
+func (b *Backend) Containers(projectName string) []dockertypes.Container {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.list(projectName)
+}
+
+// Kill lets the container exit like a crashed process
+func (b *Backend) Kill(containerId string) {
+	b.transition(containerId, StateExited, "die")
+}
+
+// Stop stops the container like docker stop
+func (b *Backend) Stop(containerId string) {
+	b.transition(containerId, StateExited, "die", "stop")
+}
+
+// Remove removes the container like docker rm -f
+func (b *Backend) Remove(containerId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(containerId)
+}
+
+func (b *Backend) Up(_ context.Context, opts compose.Options) (*compose.Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "Up", ProjectName: opts.ProjectName, WorkingDir: opts.WorkingDir, ConfigFiles: opts.ConfigFiles, Profiles: opts.Profiles})
+	if err := b.errors["Up/"+opts.ProjectName]; err != nil {
+		return nil, err
+	}
+
+	project, err := compose.LoadProject(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*dockertypes.Container)
+	for id, c := range b.containers {
+		if c.Labels[compose.LabelProject] == opts.ProjectName {
+			existing[c.Labels[compose.LabelService]] = b.containers[id]
+		}
+	}
+
+	for _, volume := range project.Volumes {
+		if !volume.External.External {
+			b.volumes[volume.Name] = opts.ProjectName
+		}
+	}
+
+	result := &compose.Result{}
+	err = project.WithServices(nil, func(service composetypes.ServiceConfig) error {
+		serviceResult := compose.ServiceResult{Service: service.Name, Action: compose.ActionUnchanged}
+
+		c, ok := existing[service.Name]
+		switch {
+		case ok && c.Image != service.Image:
+			b.remove(c.ID)
+			c = b.create(opts.ProjectName, service.Name, service.Image, service.Labels)
+			serviceResult.Action = compose.ActionRecreated
+		case !ok:
+			c = b.create(opts.ProjectName, service.Name, service.Image, service.Labels)
+			serviceResult.Action = compose.ActionCreated
+		}
+
+		if c.State != StateRunning {
+			b.start(c)
+		}
+
+		serviceResult.ContainerIDs = []string{c.ID}
+		result.Services = append(result.Services, serviceResult)
+		if opts.Output != nil {
+			_, _ = fmt.Fprintf(opts.Output, "service %s: %s\n", service.Name, serviceResult.Action)
+		}
+		delete(existing, service.Name)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// orphans
+	for _, c := range existing {
+		b.remove(c.ID)
+	}
+
+	return result, nil
+}
+
+func (b *Backend) Down(_ context.Context, opts compose.Options) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectName := opts.ProjectName
+	b.calls = append(b.calls, Call{Method: "Down", ProjectName: projectName, WorkingDir: opts.WorkingDir, ConfigFiles: opts.ConfigFiles, Profiles: opts.Profiles})
+	if err := b.errors["Down/"+projectName]; err != nil {
+		return err
+	}
+
+	for _, c := range b.list(projectName) {
+		b.remove(c.ID)
+	}
+
+	return nil
+}
+
+func (b *Backend) Run(_ context.Context, opts compose.Options, service string, command []string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "Run", ProjectName: opts.ProjectName, WorkingDir: opts.WorkingDir, ConfigFiles: opts.ConfigFiles, Profiles: opts.Profiles, Service: service, Command: command})
+
+	return b.outputs[service], b.errors["Run/"+opts.ProjectName]
+}
+
+func (b *Backend) RunImage(_ context.Context, image string, command []string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "RunImage", ProjectName: image, Image: image, Command: command})
+
+	return b.outputs[image], b.errors["RunImage/"+image]
+}
+
+func (b *Backend) Status(_ context.Context, projectName string) ([]dockertypes.Container, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.list(projectName), nil
+}
+
+func (b *Backend) Logs(_ context.Context, containerId, _, _ string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.containers[containerId]; !ok {
+		return "", fmt.Errorf("no such container: %s", containerId)
+	}
+
+	return "", nil
+}
+
+func (b *Backend) StartContainer(_ context.Context, containerId string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.containers[containerId]
+	if !ok {
+		return fmt.Errorf("no such container: %s", containerId)
+	}
+
+	if c.State != StateRunning {
+		b.start(c)
+	}
+
+	return nil
+}
+
+func (b *Backend) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	messages := make(chan events.Message, 100)
+	b.subscribers[messages] = true
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, messages)
+	}()
+
+	return messages, make(chan error)
+}
+
+func (b *Backend) DiskUsage(_ context.Context) (dockertypes.DiskUsage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage := dockertypes.DiskUsage{}
+	for _, image := range b.images {
+		summary := *image
+		for _, c := range b.containers {
+			if c.ImageID == image.ID {
+				summary.Containers++
+			}
+		}
+		usage.LayersSize += image.Size
+		usage.Images = append(usage.Images, &summary)
+	}
+
+	for _, c := range b.list("") {
+		c := c
+		usage.Containers = append(usage.Containers, &c)
+	}
+
+	for _, record := range b.buildCache {
+		n := *record
+		usage.BuildCache = append(usage.BuildCache, &n)
+	}
+
+	return usage, nil
+}
+
+func (b *Backend) RemoveImage(_ context.Context, imageId string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "RemoveImage", ProjectName: imageId, Image: imageId})
+	if _, ok := b.images[imageId]; !ok {
+		return fmt.Errorf("no such image: %s", imageId)
+	}
+
+	for _, c := range b.containers {
+		if c.ImageID == imageId {
+			return fmt.Errorf("image %s is used by container %s", imageId, c.ID)
+		}
+	}
+
+	delete(b.images, imageId)
+	return nil
+}
+
+func (b *Backend) RemoveContainer(_ context.Context, containerId string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.containers[containerId]
+	if !ok {
+		return fmt.Errorf("no such container: %s", containerId)
+	}
+
+	if c.State == StateRunning {
+		return fmt.Errorf("container %s is running", containerId)
+	}
+
+	b.remove(containerId)
+	return nil
+}
+
+func (b *Backend) PruneBuildCache(_ context.Context, unusedFor time.Duration) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "PruneBuildCache"})
+
+	reclaimed := uint64(0)
+	kept := make([]*dockertypes.BuildCache, 0, len(b.buildCache))
+	for _, record := range b.buildCache {
+		if record.InUse || (unusedFor > 0 && time.Since(*record.LastUsedAt) < unusedFor) {
+			kept = append(kept, record)
+			continue
+		}
+		reclaimed += uint64(record.Size)
+	}
+	b.buildCache = kept
+
+	return reclaimed, nil
+}
+
+func (b *Backend) ListVolumes(_ context.Context, projectName string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0)
+	for name, project := range b.volumes {
+		if project == projectName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (b *Backend) RunHelper(_ context.Context, image string, command []string, binds []string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "RunHelper", ProjectName: image, Image: image, Command: command, Binds: binds})
+
+	return b.outputs[image], b.errors["RunHelper/"+image]
+}
+
+func (b *Backend) EnsureNetwork(_ context.Context, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.calls = append(b.calls, Call{Method: "EnsureNetwork", ProjectName: name})
+	if err := b.errors["EnsureNetwork/"+name]; err != nil {
+		return err
+	}
+
+	if _, ok := b.networks[name]; !ok {
+		b.networks[name] = make(map[string][]string)
+	}
+
+	return nil
+}
+
+func (b *Backend) ConnectNetwork(_ context.Context, name, containerId string, aliases []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	attached, ok := b.networks[name]
+	if !ok {
+		return fmt.Errorf("network %s not found", name)
+	}
+	if _, ok := b.containers[containerId]; !ok {
+		return fmt.Errorf("container %s not found", containerId)
+	}
+
+	attached[containerId] = aliases
+	return nil
+}
+
+func (b *Backend) DisconnectNetwork(_ context.Context, name, containerId string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	attached, ok := b.networks[name]
+	if !ok {
+		return fmt.Errorf("network %s not found", name)
+	}
+
+	delete(attached, containerId)
+	return nil
+}
+
+func (b *Backend) list(projectName string) []dockertypes.Container {
+	containers := make([]dockertypes.Container, 0)
+	for _, c := range b.containers {
+		if projectName == "" || c.Labels[compose.LabelProject] == projectName {
+			containers = append(containers, *c)
+		}
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Names[0] < containers[j].Names[0]
+	})
+
+	return containers
+}
+
+func (b *Backend) create(projectName, service, image string, labels map[string]string) *dockertypes.Container {
+	b.nextId++
+	c := &dockertypes.Container{
+		ID:      fmt.Sprintf("%064d", b.nextId),
+		Names:   []string{fmt.Sprintf("/%s-%s-1", projectName, service)},
+		Image:   image,
+		ImageID: "sha256:" + image,
+		Created: time.Now().Unix(),
+		State:   StateCreated,
+		Status:  "Created",
+		Labels: map[string]string{
+			compose.LabelProject:         projectName,
+			compose.LabelService:         service,
+			compose.LabelContainerNumber: strconv.Itoa(1),
+			compose.LabelOneOff:          "False",
+		},
+	}
+	for k, v := range labels {
+		c.Labels[k] = v
+	}
+	b.containers[c.ID] = c
+	b.emit(c, "create")
+
+	return c
+}
+
+func (b *Backend) start(c *dockertypes.Container) {
+	c.State = StateRunning
+	c.Status = "Up"
+	if health := b.health[c.Labels[compose.LabelProject]]; health != "" {
+		c.Status = fmt.Sprintf("Up (%s)", health)
+		if health == compose.HealthStarting {
+			c.Status = "Up (health: starting)"
+		}
+	}
+	b.emit(c, "start")
+}
+
+func (b *Backend) remove(containerId string) {
+	c, ok := b.containers[containerId]
+	if !ok {
+		return
+	}
+
+	if c.State == StateRunning {
+		c.State = StateExited
+		b.emit(c, "die")
+	}
+
+	delete(b.containers, containerId)
+	for _, attached := range b.networks {
+		delete(attached, containerId)
+	}
+	b.emit(c, "destroy")
+}
+
+func (b *Backend) transition(containerId, state string, actions ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.containers[containerId]
+	if !ok {
+		return
+	}
+
+	c.State = state
+	c.Status = "Exited (137)"
+	for _, action := range actions {
+		b.emit(c, action)
+	}
+}
+
+func (b *Backend) emit(c *dockertypes.Container, action string) {
+	attributes := make(map[string]string, len(c.Labels)+1)
+	for k, v := range c.Labels {
+		attributes[k] = v
+	}
+	attributes["image"] = c.Image
+
+	message := events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         c.ID,
+			Attributes: attributes,
+		},
+		Time:     time.Now().Unix(),
+		TimeNano: time.Now().UnixNano(),
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- message:
+		default:
+			// slow subscribers lose events like with a real daemon under load
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package compose
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	composetypes "github.com/compose-spec/compose-go/types"
+	dockertypes "github.com/docker/docker/api/types"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/lacodon/recoon/pkg/registry"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// inlineDockerfile is the name of the Dockerfile added to the build context for dockerfile_inline
+const inlineDockerfile = ".recoon.inline.Dockerfile"
+
+type image struct {
+	// ref is the reference used to create containers
+	ref string
+	// id is the content addressable id of the image
+	id string
+}
+
+// ensureImage builds or pulls the image of the service
+func ensureImage(ctx context.Context, client *dockerclient.Client, project *composetypes.Project, service composetypes.ServiceConfig, out io.Writer) (image, error) {
+	if service.Build == nil {
+		return ensurePulled(ctx, client, service.Image, service.PullPolicy, out)
+	}
+
+	ref := service.Image
+	if ref == "" {
+		ref = project.Name + "-" + service.Name
+	}
+
+	_, _ = fmt.Fprintf(out, "building image %s of service %s\n", ref, service.Name)
+	if err := buildImage(ctx, client, ref, service.Build, out); err != nil {
+		return image{}, errors.WithMessagef(err, "failed to build image %s", ref)
+	}
+
+	return inspectImage(ctx, client, ref)
+}
+
+// ensurePulled pulls the image according to the pull policy
+func ensurePulled(ctx context.Context, client *dockerclient.Client, ref, pullPolicy string, out io.Writer) (image, error) {
+	if ref == "" {
+		return image{}, errors.New("neither image nor build is set")
+	}
+
+	if pullPolicy != composetypes.PullPolicyAlways {
+		existing, err := inspectImage(ctx, client, ref)
+		if err == nil {
+			return existing, nil
+		}
+		if !dockerclient.IsErrNotFound(errors.Cause(err)) {
+			return image{}, err
+		}
+		if pullPolicy == composetypes.PullPolicyNever {
+			return image{}, fmt.Errorf("image %s is missing and pull policy is never", ref)
+		}
+	}
+
+	_, _ = fmt.Fprintf(out, "pulling image %s\n", ref)
+	reader, err := client.ImagePull(ctx, ref, dockertypes.ImagePullOptions{
+		RegistryAuth: registryAuth(ref),
+	})
+	if err != nil {
+		return image{}, errors.WithMessagef(err, "failed to pull image %s", ref)
+	}
+	defer reader.Close()
+
+	if err := readJSONStream(reader, out); err != nil {
+		return image{}, errors.WithMessagef(err, "failed to pull image %s", ref)
+	}
+
+	return inspectImage(ctx, client, ref)
+}
+
+func inspectImage(ctx context.Context, client *dockerclient.Client, ref string) (image, error) {
+	inspect, _, err := client.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return image{}, errors.WithMessagef(err, "failed to inspect image %s", ref)
+	}
+
+	return image{ref: ref, id: inspect.ID}, nil
+}
+
+func buildImage(ctx context.Context, client *dockerclient.Client, ref string, build *composetypes.BuildConfig, out io.Writer) error {
+	dockerfile := build.Dockerfile
+	if build.DockerfileInline != "" {
+		dockerfile = inlineDockerfile
+	}
+
+	buildContext := makeBuildContext(build.Context, build.DockerfileInline)
+	defer buildContext.Close()
+
+	labels := make(map[string]string, len(build.Labels))
+	for k, v := range build.Labels {
+		labels[k] = v
+	}
+
+	response, err := client.ImageBuild(ctx, buildContext, dockertypes.ImageBuildOptions{
+		Tags:        append([]string{ref}, build.Tags...),
+		Dockerfile:  dockerfile,
+		BuildArgs:   build.Args,
+		Labels:      labels,
+		Target:      build.Target,
+		NetworkMode: build.Network,
+		ExtraHosts:  makeExtraHosts(build.ExtraHosts),
+		CacheFrom:   build.CacheFrom,
+		NoCache:     build.NoCache,
+		PullParent:  true,
+		Remove:      true,
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return readJSONStream(response.Body, out)
+}
+
+// makeBuildContext streams the directory as tar archive and skips all files matched by the .dockerignore
+func makeBuildContext(directory, inlineDockerfileContent string) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(writeBuildContext(writer, directory, inlineDockerfileContent))
+	}()
+
+	return reader
+}
+
+func writeBuildContext(w io.Writer, directory, inlineDockerfileContent string) error {
+	ignored, err := readDockerignore(directory)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(directory, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if ignored != nil {
+			skip, err := ignored.MatchesOrParentMatches(rel)
+			if err != nil {
+				return err
+			}
+
+			if skip {
+				// exceptions like !dir/keep may still match files below an ignored directory
+				if info.IsDir() && !ignored.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if inlineDockerfileContent != "" {
+		err := tw.WriteHeader(&tar.Header{
+			Name: inlineDockerfile,
+			Mode: 0644,
+			Size: int64(len(inlineDockerfileContent)),
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := tw.Write([]byte(inlineDockerfileContent)); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// readDockerignore returns the matcher of the .dockerignore in directory or nil if there is none
+func readDockerignore(directory string) (*patternmatcher.PatternMatcher, error) {
+	file, err := os.Open(filepath.Join(directory, ".dockerignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns, err := ignorefile.ReadAll(file)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to read .dockerignore")
+	}
+
+	matcher, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid .dockerignore")
+	}
+
+	return matcher, nil
+}
+
+type jsonMessage struct {
+	Stream   string `json:"stream"`
+	Status   string `json:"status"`
+	ID       string `json:"id"`
+	Progress string `json:"progress"`
+	Error    string `json:"error"`
+}
+
+// readJSONStream copies the progress stream of a build or pull to out and returns the reported error
+func readJSONStream(reader io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		message := jsonMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+
+		switch {
+		case message.Stream != "":
+			_, _ = io.WriteString(out, message.Stream)
+		case message.Status != "" && message.Progress == "":
+			// download progress bars would flood the output
+			if message.ID != "" {
+				_, _ = fmt.Fprintf(out, "%s: %s\n", message.ID, message.Status)
+			} else {
+				_, _ = fmt.Fprintln(out, message.Status)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// registryAuth returns the encoded credentials from the docker config file for the registry of the image
+func registryAuth(ref string) string {
+	credentials, ok := registry.LookupCredentials(registry.Host(ref))
+	if !ok {
+		return ""
+	}
+
+	encoded, err := json.Marshal(dockertypes.AuthConfig{
+		Username:      credentials.Username,
+		Password:      credentials.Password,
+		ServerAddress: credentials.ServerAddress,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return base64.URLEncoding.EncodeToString(encoded)
+}
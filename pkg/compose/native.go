@@ -0,0 +1,754 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	composecli "github.com/compose-spec/compose-go/cli"
+	composetypes "github.com/compose-spec/compose-go/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// labels which are set on all resources, compatible with the docker compose CLI
+const (
+	LabelProject         = "com.docker.compose.project"
+	LabelService         = "com.docker.compose.service"
+	LabelContainerNumber = "com.docker.compose.container-number"
+	LabelOneOff          = "com.docker.compose.oneoff"
+	LabelConfigHash      = "com.docker.compose.config-hash"
+	LabelNetwork         = "com.docker.compose.network"
+	LabelVolume          = "com.docker.compose.volume"
+	LabelWorkingDir      = "com.docker.compose.project.working_dir"
+)
+
+// LabelOwner marks the containers and built images of recoon with their recoon project, which differs from the compose
+// project name of a blue/green set
+const LabelOwner = "io.recoon.project"
+
+// actions reported in ServiceResult
+const (
+	ActionCreated   = "created"
+	ActionRecreated = "recreated"
+	ActionUnchanged = "unchanged"
+	ActionApplied   = "applied"
+	ActionFailed    = "failed"
+)
+
+// dependencyTimeout is the maximal time to wait for a dependency to become healthy or complete
+const dependencyTimeout = 5 * time.Minute
+
+type nativeEngine struct{}
+
+// NewNativeEngine returns an Engine which loads compose files with compose-go and applies them through the Docker Engine API
+func NewNativeEngine() Engine {
+	return &nativeEngine{}
+}
+
+// LoadProject loads and validates the compose project in opts.WorkingDir
+func LoadProject(opts Options) (*composetypes.Project, error) {
+	configFiles := opts.resolve(opts.ConfigFiles)
+
+	optionFns := []composecli.ProjectOptionsFn{
+		composecli.WithName(opts.ProjectName),
+		composecli.WithWorkingDirectory(opts.WorkingDir),
+		composecli.WithOsEnv,
+		composecli.WithEnvFiles(opts.resolve(opts.EnvFiles)...),
+		composecli.WithDotEnv,
+		composecli.WithEnv(opts.environment()),
+		composecli.WithProfiles(opts.Profiles),
+	}
+	if len(configFiles) == 0 {
+		optionFns = append(optionFns, composecli.WithDefaultConfigPath)
+	}
+
+	projectOptions, err := composecli.NewProjectOptions(configFiles, optionFns...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid compose options")
+	}
+
+	// the default config path lookup also searches the parent directories
+	if len(configFiles) == 0 && (len(projectOptions.ConfigPaths) == 0 || filepath.Dir(projectOptions.ConfigPaths[0]) != projectOptions.WorkingDir) {
+		return nil, fmt.Errorf("no compose file found in %s", opts.WorkingDir)
+	}
+
+	var project *composetypes.Project
+	if opts.Render != nil {
+		project, err = loadRendered(projectOptions, opts)
+	} else {
+		project, err = composecli.ProjectFromOptions(projectOptions)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load compose project")
+	}
+
+	if len(opts.Patches) > 0 {
+		if project, err = applyPatches(project, opts.resolve(opts.Patches), projectOptions.Environment, opts.Profiles, opts.Render); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, service := range project.Services {
+		if image, ok := opts.Images[service.Name]; ok {
+			project.Services[i].Image = image
+		}
+
+		if len(opts.Labels) > 0 && project.Services[i].Labels == nil {
+			project.Services[i].Labels = make(composetypes.Labels, len(opts.Labels))
+		}
+		for k, v := range opts.Labels {
+			project.Services[i].Labels[k] = v
+		}
+
+		if build := project.Services[i].Build; build != nil && len(opts.Labels) > 0 {
+			if build.Labels == nil {
+				build.Labels = make(composetypes.Labels, len(opts.Labels))
+			}
+			for k, v := range opts.Labels {
+				build.Labels[k] = v
+			}
+		}
+	}
+
+	return project, nil
+}
+
+func (e *nativeEngine) Up(ctx context.Context, opts Options) (*Result, error) {
+	project, err := LoadProject(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if err := ensureNetworks(ctx, client, project); err != nil {
+		return nil, err
+	}
+
+	if err := ensureVolumes(ctx, client, project); err != nil {
+		return nil, err
+	}
+
+	out := opts.output()
+
+	result := &Result{}
+	err = project.WithServices(nil, func(service composetypes.ServiceConfig) error {
+		serviceResult := applyService(ctx, client, project, service, out)
+		result.Services = append(result.Services, serviceResult)
+		_, _ = fmt.Fprintf(out, "service %s: %s\n", service.Name, serviceResult.Action)
+		if serviceResult.Error != "" {
+			return fmt.Errorf("service %s: %s", service.Name, serviceResult.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, errors.WithMessage(err, "failed to apply services")
+	}
+
+	if err := removeOrphans(ctx, client, project); err != nil {
+		return result, err
+	}
+
+	logrus.WithField("project", project.Name).Debug("successfully applied compose project")
+	return result, nil
+}
+
+func (e *nativeEngine) Down(ctx context.Context, opts Options) error {
+	// all resources are found by their labels, so the compose files are not required anymore
+	projectName := opts.ProjectName
+
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	containers, err := listContainers(ctx, client, projectName)
+	if err != nil {
+		return err
+	}
+
+	images := make(map[string]bool)
+	for _, c := range containers {
+		images[c.Image] = true
+		if err := removeContainer(ctx, client, c.ID); err != nil {
+			return err
+		}
+	}
+
+	networks, err := client.NetworkList(ctx, dockertypes.NetworkListOptions{Filters: projectFilter(projectName)})
+	if err != nil {
+		return errors.WithMessage(err, "failed to list networks")
+	}
+
+	for _, n := range networks {
+		if err := client.NetworkRemove(ctx, n.ID); err != nil {
+			return errors.WithMessagef(err, "failed to remove network %s", n.Name)
+		}
+	}
+
+	for image := range images {
+		if _, err := client.ImageRemove(ctx, image, dockertypes.ImageRemoveOptions{}); err != nil && !dockerclient.IsErrNotFound(err) {
+			// the image might still be used by other projects
+			logrus.WithError(err).WithField("image", image).Debug("failed to remove image")
+		}
+	}
+
+	logrus.WithField("project", projectName).Debug("successfully removed compose project")
+	return nil
+}
+
+func (e *nativeEngine) Run(ctx context.Context, opts Options, serviceName string, command []string) (string, error) {
+	project, err := LoadProject(opts)
+	if err != nil {
+		return "", err
+	}
+
+	service, err := project.GetService(serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if err := ensureNetworks(ctx, client, project); err != nil {
+		return "", err
+	}
+
+	if err := ensureVolumes(ctx, client, project); err != nil {
+		return "", err
+	}
+
+	// like docker compose run, the dependencies of the service have to be up
+	err = project.WithServices(service.GetDependencies(), func(dependency composetypes.ServiceConfig) error {
+		if result := applyService(ctx, client, project, dependency, io.Discard); result.Error != "" {
+			return fmt.Errorf("dependency %s: %s", dependency.Name, result.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	image, err := ensureImage(ctx, client, project, service, io.Discard)
+	if err != nil {
+		return "", err
+	}
+
+	if len(command) > 0 {
+		service.Command = command
+	}
+
+	config, hostConfig, networkingConfig, extraNetworks := makeContainerConfig(project, service, image.ref, 0)
+	config.Labels[LabelOneOff] = "True"
+	hostConfig.RestartPolicy = container.RestartPolicy{}
+	hostConfig.PortBindings = nil
+
+	name := fmt.Sprintf("%s-%s-run-%s", project.Name, service.Name, randomSuffix())
+
+	return runContainer(ctx, client, name, config, hostConfig, networkingConfig, extraNetworks)
+}
+
+func (e *nativeEngine) RunImage(ctx context.Context, image string, command []string) (string, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if _, err := ensurePulled(ctx, client, image, composetypes.PullPolicyMissing, io.Discard); err != nil {
+		return "", err
+	}
+
+	config := &container.Config{
+		Image: image,
+		Cmd:   command,
+	}
+
+	return runContainer(ctx, client, "", config, &container.HostConfig{}, nil, nil)
+}
+
+// applyService makes sure that the containers of the service are up to date and running
+func applyService(ctx context.Context, client *dockerclient.Client, project *composetypes.Project, service composetypes.ServiceConfig, out io.Writer) ServiceResult {
+	result := ServiceResult{
+		Service: service.Name,
+		Action:  ActionUnchanged,
+	}
+
+	fail := func(err error) ServiceResult {
+		result.Action = ActionFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	if err := waitForDependencies(ctx, client, project, service); err != nil {
+		return fail(err)
+	}
+
+	image, err := ensureImage(ctx, client, project, service, out)
+	if err != nil {
+		return fail(err)
+	}
+
+	hash, err := configHash(service, image.id)
+	if err != nil {
+		return fail(err)
+	}
+
+	existing, err := listServiceContainers(ctx, client, project.Name, service.Name)
+	if err != nil {
+		return fail(err)
+	}
+
+	replicas := 1
+	if service.Deploy != nil && service.Deploy.Replicas != nil {
+		replicas = int(*service.Deploy.Replicas)
+	}
+
+	byNumber := make(map[int]dockertypes.Container, len(existing))
+	for _, c := range existing {
+		number, _ := strconv.Atoi(c.Labels[LabelContainerNumber])
+		if number < 1 || number > replicas {
+			if err := removeContainer(ctx, client, c.ID); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		byNumber[number] = c
+	}
+
+	for number := 1; number <= replicas; number++ {
+		c, exists := byNumber[number]
+		if exists && c.Labels[LabelConfigHash] == hash {
+			if c.State != "running" {
+				if err := client.ContainerStart(ctx, c.ID, dockertypes.ContainerStartOptions{}); err != nil {
+					return fail(errors.WithMessage(err, "failed to start container"))
+				}
+			}
+			result.ContainerIDs = append(result.ContainerIDs, c.ID)
+			continue
+		}
+
+		if exists {
+			if err := removeContainer(ctx, client, c.ID); err != nil {
+				return fail(err)
+			}
+			result.Action = ActionRecreated
+		} else if result.Action == ActionUnchanged {
+			result.Action = ActionCreated
+		}
+
+		id, err := createContainer(ctx, client, project, service, image.ref, hash, number)
+		if err != nil {
+			return fail(err)
+		}
+		result.ContainerIDs = append(result.ContainerIDs, id)
+	}
+
+	return result
+}
+
+func createContainer(ctx context.Context, client *dockerclient.Client, project *composetypes.Project, service composetypes.ServiceConfig, image, hash string, number int) (string, error) {
+	config, hostConfig, networkingConfig, extraNetworks := makeContainerConfig(project, service, image, number)
+	config.Labels[LabelConfigHash] = hash
+
+	name := service.ContainerName
+	if name == "" {
+		name = fmt.Sprintf("%s-%s-%d", project.Name, service.Name, number)
+	}
+
+	created, err := client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed to create container %s", name)
+	}
+
+	if err := connectNetworks(ctx, client, created.ID, extraNetworks); err != nil {
+		return created.ID, err
+	}
+
+	if err := client.ContainerStart(ctx, created.ID, dockertypes.ContainerStartOptions{}); err != nil {
+		return created.ID, errors.WithMessagef(err, "failed to start container %s", name)
+	}
+
+	return created.ID, nil
+}
+
+func connectNetworks(ctx context.Context, client *dockerclient.Client, containerId string, networks map[string]*network.EndpointSettings) error {
+	// the engine API only allows a single network on creation, the others have to be connected afterwards
+	for name, endpoint := range networks {
+		if err := client.NetworkConnect(ctx, name, containerId, endpoint); err != nil {
+			return errors.WithMessagef(err, "failed to connect container to network %s", name)
+		}
+	}
+
+	return nil
+}
+
+// runContainer runs a one-shot container, returns its output and removes it afterwards
+func runContainer(ctx context.Context, client *dockerclient.Client, name string, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, extraNetworks map[string]*network.EndpointSettings) (string, error) {
+	created, err := client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to create container")
+	}
+
+	defer func() {
+		// ctx might already be done
+		if err := removeContainer(context.Background(), client, created.ID); err != nil {
+			logrus.WithError(err).WithField("container", created.ID).Warn("failed to remove one-shot container")
+		}
+	}()
+
+	if err := connectNetworks(ctx, client, created.ID, extraNetworks); err != nil {
+		return "", err
+	}
+
+	waitChan, errChan := client.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+
+	if err := client.ContainerStart(ctx, created.ID, dockertypes.ContainerStartOptions{}); err != nil {
+		return "", errors.WithMessage(err, "failed to start container")
+	}
+
+	var exitCode int64
+	select {
+	case response := <-waitChan:
+		exitCode = response.StatusCode
+		if response.Error != nil {
+			err = errors.New(response.Error.Message)
+		}
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = errors.WithMessage(ctx.Err(), "aborted")
+	}
+
+	output := containerOutput(client, created.ID)
+	if err != nil {
+		return output, errors.WithMessage(err, "error during docker run")
+	}
+
+	if exitCode != 0 {
+		return output, fmt.Errorf("error during docker run: exit code %d", exitCode)
+	}
+
+	return output, nil
+}
+
+func containerOutput(client *dockerclient.Client, containerId string) string {
+	reader, err := client.ContainerLogs(context.Background(), containerId, dockertypes.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+
+	output := &bytes.Buffer{}
+	_, _ = stdcopy.StdCopy(output, output, reader)
+
+	return output.String()
+}
+
+// waitForDependencies waits until the dependencies of the service fulfill their depends_on conditions
+func waitForDependencies(ctx context.Context, client *dockerclient.Client, project *composetypes.Project, service composetypes.ServiceConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, dependencyTimeout)
+	defer cancel()
+
+	for dependency, config := range service.DependsOn {
+		if config.Condition != composetypes.ServiceConditionHealthy && config.Condition != composetypes.ServiceConditionCompletedSuccessfully {
+			continue
+		}
+
+		for {
+			fulfilled, err := dependencyFulfilled(ctx, client, project.Name, dependency, config.Condition)
+			if err != nil {
+				return err
+			}
+
+			if fulfilled {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("dependency %s did not reach %s: %s", dependency, config.Condition, ctx.Err())
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+	return nil
+}
+
+func dependencyFulfilled(ctx context.Context, client *dockerclient.Client, projectName, dependency, condition string) (bool, error) {
+	containers, err := listServiceContainers(ctx, client, projectName, dependency)
+	if err != nil {
+		return false, err
+	}
+
+	if len(containers) == 0 {
+		return false, nil
+	}
+
+	for _, c := range containers {
+		inspect, err := client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return false, errors.WithMessage(err, "failed to inspect container")
+		}
+
+		switch condition {
+		case composetypes.ServiceConditionHealthy:
+			if inspect.State.Health == nil {
+				return false, fmt.Errorf("dependency %s has no healthcheck", dependency)
+			}
+			if inspect.State.Health.Status == dockertypes.Unhealthy {
+				return false, fmt.Errorf("dependency %s is unhealthy", dependency)
+			}
+			if inspect.State.Health.Status != dockertypes.Healthy {
+				return false, nil
+			}
+		case composetypes.ServiceConditionCompletedSuccessfully:
+			if inspect.State.Running {
+				return false, nil
+			}
+			if inspect.State.ExitCode != 0 {
+				return false, fmt.Errorf("dependency %s exited with code %d", dependency, inspect.State.ExitCode)
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func ensureNetworks(ctx context.Context, client *dockerclient.Client, project *composetypes.Project) error {
+	for key, config := range project.Networks {
+		existing, err := client.NetworkList(ctx, dockertypes.NetworkListOptions{
+			Filters: dockerfilters.NewArgs(dockerfilters.Arg("name", config.Name)),
+		})
+		if err != nil {
+			return errors.WithMessage(err, "failed to list networks")
+		}
+
+		found := false
+		for _, n := range existing {
+			// the name filter also matches substrings
+			if n.Name == config.Name {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		if config.External.External {
+			return fmt.Errorf("external network %s not found", config.Name)
+		}
+
+		labels := map[string]string{
+			LabelProject: project.Name,
+			LabelNetwork: key,
+		}
+		for k, v := range config.Labels {
+			labels[k] = v
+		}
+
+		create := dockertypes.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         config.Driver,
+			Options:        config.DriverOpts,
+			Internal:       config.Internal,
+			Attachable:     config.Attachable,
+			EnableIPv6:     config.EnableIPv6,
+			Labels:         labels,
+		}
+
+		if config.Ipam.Driver != "" || len(config.Ipam.Config) > 0 {
+			create.IPAM = &network.IPAM{Driver: config.Ipam.Driver}
+			for _, pool := range config.Ipam.Config {
+				create.IPAM.Config = append(create.IPAM.Config, network.IPAMConfig{
+					Subnet:     pool.Subnet,
+					Gateway:    pool.Gateway,
+					IPRange:    pool.IPRange,
+					AuxAddress: pool.AuxiliaryAddresses,
+				})
+			}
+		}
+
+		if _, err := client.NetworkCreate(ctx, config.Name, create); err != nil {
+			return errors.WithMessagef(err, "failed to create network %s", config.Name)
+		}
+	}
+
+	return nil
+}
+
+func ensureVolumes(ctx context.Context, client *dockerclient.Client, project *composetypes.Project) error {
+	for key, config := range project.Volumes {
+		existing, err := client.VolumeList(ctx, dockerfilters.NewArgs(dockerfilters.Arg("name", config.Name)))
+		if err != nil {
+			return errors.WithMessage(err, "failed to list volumes")
+		}
+
+		found := false
+		for _, v := range existing.Volumes {
+			if v.Name == config.Name {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		if config.External.External {
+			return fmt.Errorf("external volume %s not found", config.Name)
+		}
+
+		labels := map[string]string{
+			LabelProject: project.Name,
+			LabelVolume:  key,
+		}
+		for k, v := range config.Labels {
+			labels[k] = v
+		}
+
+		_, err = client.VolumeCreate(ctx, volume.CreateOptions{
+			Name:       config.Name,
+			Driver:     config.Driver,
+			DriverOpts: config.DriverOpts,
+			Labels:     labels,
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "failed to create volume %s", config.Name)
+		}
+	}
+
+	return nil
+}
+
+// removeOrphans removes all containers of the project whose service doesn't exist anymore
+func removeOrphans(ctx context.Context, client *dockerclient.Client, project *composetypes.Project) error {
+	containers, err := listContainers(ctx, client, project.Name)
+	if err != nil {
+		return err
+	}
+
+	services := make(map[string]bool)
+	for _, name := range project.ServiceNames() {
+		services[name] = true
+	}
+
+	for _, c := range containers {
+		if services[c.Labels[LabelService]] || c.Labels[LabelOneOff] == "True" {
+			continue
+		}
+
+		logrus.WithField("project", project.Name).WithField("container", c.ID).Debug("remove orphaned container")
+		if err := removeContainer(ctx, client, c.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listContainers(ctx context.Context, client *dockerclient.Client, projectName string) ([]dockertypes.Container, error) {
+	containers, err := client.ContainerList(ctx, dockertypes.ContainerListOptions{
+		All:     true,
+		Filters: projectFilter(projectName),
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to list containers")
+	}
+
+	return containers, nil
+}
+
+func listServiceContainers(ctx context.Context, client *dockerclient.Client, projectName, service string) ([]dockertypes.Container, error) {
+	filters := projectFilter(projectName)
+	filters.Add("label", fmt.Sprintf("%s=%s", LabelService, service))
+	filters.Add("label", fmt.Sprintf("%s=False", LabelOneOff))
+
+	containers, err := client.ContainerList(ctx, dockertypes.ContainerListOptions{
+		All:     true,
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to list containers")
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containerNumber(containers[i]) < containerNumber(containers[j])
+	})
+
+	return containers, nil
+}
+
+// containerNumber returns the replica number of the container or 0 if it has none
+func containerNumber(container dockertypes.Container) int {
+	number, _ := strconv.Atoi(container.Labels[LabelContainerNumber])
+	return number
+}
+
+func removeContainer(ctx context.Context, client *dockerclient.Client, containerId string) error {
+	if err := client.ContainerStop(ctx, containerId, container.StopOptions{}); err != nil && !dockerclient.IsErrNotFound(err) {
+		return errors.WithMessagef(err, "failed to stop container %s", containerId)
+	}
+
+	err := client.ContainerRemove(ctx, containerId, dockertypes.ContainerRemoveOptions{Force: true})
+	if err != nil && !dockerclient.IsErrNotFound(err) {
+		return errors.WithMessagef(err, "failed to remove container %s", containerId)
+	}
+
+	return nil
+}
+
+func projectFilter(projectName string) dockerfilters.Args {
+	return dockerfilters.NewArgs(dockerfilters.Arg("label", fmt.Sprintf("%s=%s", LabelProject, projectName)))
+}
+
+// configHash changes whenever the container of the service has to be recreated
+func configHash(service composetypes.ServiceConfig, imageId string) (string, error) {
+	data, err := json.Marshal(service)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to marshal service config")
+	}
+
+	sum := sha256.New()
+	sum.Write(data)
+	sum.Write([]byte(imageId))
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package compose_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/lacodon/recoon/pkg/compose"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadProject", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should load the compose file of the working dir with the given project name", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:latest
+    ports:
+      - "8080:80"
+    depends_on:
+      - db
+  db:
+    image: postgres:15
+    volumes:
+      - data:/var/lib/postgresql/data
+volumes:
+  data:
+`), 0644)).To(Succeed())
+
+		project, err := compose.LoadProject(compose.Options{ProjectName: "my-app", WorkingDir: dir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.Name).To(Equal("my-app"))
+		Expect(project.ServiceNames()).To(ConsistOf("web", "db"))
+		Expect(project.Volumes["data"].Name).To(Equal("my-app_data"))
+		Expect(project.Networks).To(HaveKey("default"))
+	})
+
+	It("should merge override files and apply profiles and env files", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "base.yml"), []byte(`
+services:
+  web:
+    image: nginx:${NGINX_VERSION}
+  debug:
+    image: busybox
+    profiles: ["debug"]
+`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "prod.yml"), []byte(`
+services:
+  web:
+    environment:
+      STAGE: prod
+`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "prod.env"), []byte("NGINX_VERSION=1.23\n"), 0644)).To(Succeed())
+
+		project, err := compose.LoadProject(compose.Options{
+			ProjectName: "my-app",
+			WorkingDir:  dir,
+			ConfigFiles: []string{"base.yml", "prod.yml"},
+			EnvFiles:    []string{"prod.env"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.ServiceNames()).To(ConsistOf("web"))
+
+		web, err := project.GetService("web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(web.Image).To(Equal("nginx:1.23"))
+		Expect(web.Environment).To(HaveKey("STAGE"))
+
+		project, err = compose.LoadProject(compose.Options{
+			ProjectName: "my-app",
+			WorkingDir:  dir,
+			ConfigFiles: []string{"base.yml"},
+			Profiles:    []string{"debug"},
+			EnvFiles:    []string{"prod.env"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.ServiceNames()).To(ConsistOf("web", "debug"))
+	})
+
+	It("should fail without compose file", func() {
+		_, err := compose.LoadProject(compose.Options{ProjectName: "my-app", WorkingDir: dir})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail for invalid compose files", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    ports: "not a list"
+`), 0644)).To(Succeed())
+
+		_, err := compose.LoadProject(compose.Options{ProjectName: "my-app", WorkingDir: dir})
+		Expect(err).To(HaveOccurred())
+	})
+})
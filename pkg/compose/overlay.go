@@ -0,0 +1,174 @@
+package compose
+
+import (
+	"fmt"
+	"github.com/compose-spec/compose-go/loader"
+	"github.com/compose-spec/compose-go/template"
+	composetypes "github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// patchDirective is the key which controls how a mapping of a patch is applied
+const patchDirective = "$patch"
+
+// applyPatches applies the patches in order on the model of the loaded project and loads the result again.
+// In contrast to the merge of multiple compose files, lists like ports are replaced and not appended.
+func applyPatches(project *composetypes.Project, patches []string, environment map[string]string, profiles []string, render RenderFunc) (*composetypes.Project, error) {
+	data, err := project.MarshalYAML()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to marshal compose project")
+	}
+
+	var model interface{}
+	if err := yaml.Unmarshal(data, &model); err != nil {
+		return nil, errors.WithMessage(err, "failed to unmarshal compose project")
+	}
+
+	for _, patchFile := range patches {
+		patch, err := readPatch(patchFile, environment, render)
+		if err != nil {
+			return nil, err
+		}
+
+		model = mergePatch(model, patch)
+	}
+
+	merged, err := yaml.Marshal(model)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to marshal patched compose project")
+	}
+
+	patched, err := loader.Load(composetypes.ConfigDetails{
+		WorkingDir:  project.WorkingDir,
+		ConfigFiles: []composetypes.ConfigFile{{Filename: project.ComposeFiles[0], Content: merged}},
+		Environment: environment,
+	}, loader.WithProfiles(profiles), func(options *loader.Options) {
+		// the base project is interpolated already and the patches by readPatch
+		options.SkipInterpolation = true
+		options.ResolvePaths = true
+		options.SetProjectName(project.Name, true)
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load patched compose project")
+	}
+
+	patched.ComposeFiles = append(project.ComposeFiles, patches...)
+	return patched, nil
+}
+
+func readPatch(patchFile string, environment map[string]string, render RenderFunc) (interface{}, error) {
+	data, err := os.ReadFile(patchFile)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to read patch")
+	}
+
+	if render != nil {
+		if data, err = render(patchFile, data); err != nil {
+			return nil, errors.WithMessagef(err, "failed to render patch %s", patchFile)
+		}
+	}
+
+	var patch interface{}
+	if err := yaml.Unmarshal(data, &patch); err != nil {
+		return nil, errors.WithMessagef(err, "failed to unmarshal patch %s", patchFile)
+	}
+
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("patch %s is not a mapping", patchFile)
+	}
+
+	// like compose, only values get interpolated which keeps the $patch directives intact
+	patch, err = interpolate(patch, func(name string) (string, bool) {
+		value, ok := environment[name]
+		return value, ok
+	})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to interpolate patch %s", patchFile)
+	}
+
+	return patch, nil
+}
+
+func interpolate(value interface{}, mapping template.Mapping) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return template.Substitute(v, mapping)
+	case map[string]interface{}:
+		for key, nested := range v {
+			interpolated, err := interpolate(nested, mapping)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = interpolated
+		}
+	case []interface{}:
+		for i, nested := range v {
+			interpolated, err := interpolate(nested, mapping)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = interpolated
+		}
+	}
+
+	return value, nil
+}
+
+// mergePatch merges mappings recursively and replaces all other values of base by the ones of patch.
+// A null value removes the key; a mapping with "$patch: delete" removes it as well and one with
+// "$patch: replace" replaces the base mapping instead of being merged into it.
+func mergePatch(base, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	baseMap, ok := base.(map[string]interface{})
+	if !ok || patchMap[patchDirective] == "replace" {
+		return withoutDirectives(patchMap)
+	}
+
+	merged := make(map[string]interface{}, len(baseMap)+len(patchMap))
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+
+	for key, value := range patchMap {
+		if key == patchDirective {
+			continue
+		}
+
+		if value == nil || isDeleteDirective(value) {
+			delete(merged, key)
+			continue
+		}
+
+		merged[key] = mergePatch(merged[key], value)
+	}
+
+	return merged
+}
+
+func isDeleteDirective(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	return ok && m[patchDirective] == "delete"
+}
+
+// withoutDirectives removes the patch directives from the mapping and all nested mappings
+func withoutDirectives(m map[string]interface{}) map[string]interface{} {
+	n := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if key == patchDirective || value == nil || isDeleteDirective(value) {
+			continue
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = withoutDirectives(nested)
+		}
+		n[key] = value
+	}
+
+	return n
+}
@@ -0,0 +1,92 @@
+package compose_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/lacodon/recoon/pkg/compose"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Patches", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+
+		Expect(os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:1.23
+    ports:
+      - "8080:80"
+    environment:
+      LOG_LEVEL: info
+      STAGE: base
+  debug:
+    image: busybox
+    volumes:
+      - ./data:/data
+`), 0644)).To(Succeed())
+	})
+
+	It("should merge mappings, replace lists and remove deleted keys", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "overlays"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "overlays", "prod.yml"), []byte(`
+services:
+  web:
+    image: nginx:${NGINX_VERSION}
+    ports:
+      - "80:80"
+    environment:
+      STAGE: prod
+  debug:
+    $patch: delete
+`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, ".env"), []byte("NGINX_VERSION=1.24\n"), 0644)).To(Succeed())
+
+		project, err := compose.LoadProject(compose.Options{
+			ProjectName: "my-app-prod",
+			WorkingDir:  dir,
+			Patches:     []string{"overlays/prod.yml"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.Name).To(Equal("my-app-prod"))
+		Expect(project.ServiceNames()).To(ConsistOf("web"))
+
+		web, err := project.GetService("web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(web.Image).To(Equal("nginx:1.24"))
+		Expect(web.Ports).To(HaveLen(1))
+		Expect(web.Ports[0].Published).To(Equal("80"))
+		Expect(*web.Environment["LOG_LEVEL"]).To(Equal("info"))
+		Expect(*web.Environment["STAGE"]).To(Equal("prod"))
+	})
+
+	It("should replace mappings with the replace directive", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "staging.yml"), []byte(`
+services:
+  web:
+    environment:
+      $patch: replace
+      STAGE: staging
+`), 0644)).To(Succeed())
+
+		project, err := compose.LoadProject(compose.Options{
+			ProjectName: "my-app-staging",
+			WorkingDir:  dir,
+			Patches:     []string{"staging.yml"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		web, err := project.GetService("web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(web.Environment).To(HaveLen(1))
+		Expect(*web.Environment["STAGE"]).To(Equal("staging"))
+
+		debug, err := project.GetService("debug")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(debug.Volumes[0].Source).To(Equal(filepath.Join(dir, "data")))
+	})
+})
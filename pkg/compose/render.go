@@ -0,0 +1,53 @@
+package compose
+
+import (
+	composecli "github.com/compose-spec/compose-go/cli"
+	"github.com/compose-spec/compose-go/loader"
+	composetypes "github.com/compose-spec/compose-go/types"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// loadRendered loads the project like composecli.ProjectFromOptions but renders every compose file with opts.Render first
+func loadRendered(projectOptions *composecli.ProjectOptions, opts Options) (*composetypes.Project, error) {
+	workingDir, err := projectOptions.GetWorkingDir()
+	if err != nil {
+		return nil, err
+	}
+
+	configFiles := make([]composetypes.ConfigFile, 0, len(projectOptions.ConfigPaths))
+	for _, path := range projectOptions.ConfigPaths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		rendered, err := opts.Render(path, content)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to render %s", filepath.Base(path))
+		}
+
+		configFiles = append(configFiles, composetypes.ConfigFile{Filename: path, Content: rendered})
+	}
+
+	projectName := opts.ProjectName
+	if projectName == "" {
+		projectName = loader.NormalizeProjectName(filepath.Base(workingDir))
+	}
+
+	project, err := loader.Load(composetypes.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: configFiles,
+		Environment: projectOptions.Environment,
+	}, loader.WithProfiles(opts.Profiles), func(options *loader.Options) {
+		options.ResolvePaths = true
+		options.SetProjectName(projectName, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	project.ComposeFiles = projectOptions.ConfigPaths
+	return project, nil
+}
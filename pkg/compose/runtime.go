@@ -0,0 +1,321 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	composetypes "github.com/compose-spec/compose-go/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	dockerfilters "github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContainerRuntime gives access to the containers created by an Engine and the images and build cache of the host
+type ContainerRuntime interface {
+	// Status lists the containers of the project or of all projects if projectName is empty
+	Status(ctx context.Context, projectName string) ([]dockertypes.Container, error)
+	// Logs returns the logs of the container
+	Logs(ctx context.Context, containerId, since, tail string) (string, error)
+	// StartContainer starts an existing container
+	StartContainer(ctx context.Context, containerId string) error
+	// Events streams the events of the runtime until ctx is done
+	Events(ctx context.Context) (<-chan events.Message, <-chan error)
+	// DiskUsage lists the images, containers and build cache records with their sizes
+	DiskUsage(ctx context.Context) (dockertypes.DiskUsage, error)
+	// RemoveImage removes the image with all its tags
+	RemoveImage(ctx context.Context, imageId string) error
+	// RemoveContainer removes a stopped container
+	RemoveContainer(ctx context.Context, containerId string) error
+	// PruneBuildCache removes the build cache which hasn't been used for unusedFor or all unused build cache if it is zero
+	PruneBuildCache(ctx context.Context, unusedFor time.Duration) (uint64, error)
+	// ListVolumes returns the names of the volumes created for the project
+	ListVolumes(ctx context.Context, projectName string) ([]string, error)
+	// RunHelper runs the command in a standalone container of image with the given binds like volume:/path:ro
+	// and returns its output
+	RunHelper(ctx context.Context, image string, command []string, binds []string) (string, error)
+	// EnsureNetwork creates the attachable bridge network if it doesn't exist
+	EnsureNetwork(ctx context.Context, name string) error
+	// ConnectNetwork attaches the container to the network under the given aliases
+	ConnectNetwork(ctx context.Context, name, containerId string, aliases []string) error
+	// DisconnectNetwork detaches the container from the network
+	DisconnectNetwork(ctx context.Context, name, containerId string) error
+}
+
+// container health as reported in the status of a container
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Owner returns the recoon project of a container with the given labels
+func Owner(labels map[string]string) string {
+	if owner, ok := labels[LabelOwner]; ok {
+		return owner
+	}
+
+	return labels[LabelProject]
+}
+
+// Health returns the health of the container from its status like "Up 5 seconds (health: starting)"; it is empty
+// if the container has no healthcheck
+func Health(c dockertypes.Container) string {
+	switch {
+	case strings.HasSuffix(c.Status, "(health: starting)"):
+		return HealthStarting
+	case strings.HasSuffix(c.Status, "(unhealthy)"):
+		return HealthUnhealthy
+	case strings.HasSuffix(c.Status, "(healthy)"):
+		return HealthHealthy
+	default:
+		return ""
+	}
+}
+
+type dockerRuntime struct{}
+
+// NewDockerRuntime returns a ContainerRuntime which talks to the local docker daemon
+func NewDockerRuntime() ContainerRuntime {
+	return &dockerRuntime{}
+}
+
+func (r *dockerRuntime) Status(ctx context.Context, projectName string) ([]dockertypes.Container, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var filters dockerfilters.Args
+	if projectName != "" {
+		filters = dockerfilters.NewArgs(dockerfilters.Arg("label", fmt.Sprintf("%s=%s", LabelProject, projectName)))
+	}
+
+	return client.ContainerList(ctx, dockertypes.ContainerListOptions{
+		All:     true,
+		Filters: filters,
+	})
+}
+
+func (r *dockerRuntime) Logs(ctx context.Context, containerId, since, tail string) (string, error) {
+	if tail == "" {
+		tail = "all"
+	}
+
+	client, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	reader, err := client.ContainerLogs(ctx, containerId, dockertypes.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      since,
+		Timestamps: true,
+		Tail:       tail,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	logs, err := io.ReadAll(reader)
+	return string(logs), err
+}
+
+func (r *dockerRuntime) StartContainer(ctx context.Context, containerId string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.ContainerStart(ctx, containerId, dockertypes.ContainerStartOptions{})
+}
+
+func (r *dockerRuntime) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	client, err := newDockerClient()
+	if err != nil {
+		errChan := make(chan error, 1)
+		errChan <- err
+		return make(chan events.Message), errChan
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	eventsChan, clientErrChan := client.Events(ctx, dockertypes.EventsOptions{})
+
+	// the client is only needed as long as the stream is alive
+	errChan := make(chan error, 1)
+	go func() {
+		defer client.Close()
+		defer cancel()
+
+		select {
+		case err := <-clientErrChan:
+			errChan <- err
+		case <-ctx.Done():
+		}
+	}()
+
+	return eventsChan, errChan
+}
+
+func (r *dockerRuntime) DiskUsage(ctx context.Context) (dockertypes.DiskUsage, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return dockertypes.DiskUsage{}, err
+	}
+	defer client.Close()
+
+	return client.DiskUsage(ctx, dockertypes.DiskUsageOptions{
+		Types: []dockertypes.DiskUsageObject{
+			dockertypes.ImageObject,
+			dockertypes.ContainerObject,
+			dockertypes.BuildCacheObject,
+		},
+	})
+}
+
+func (r *dockerRuntime) RemoveImage(ctx context.Context, imageId string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// force is required to remove all tags of an image at once
+	_, err = client.ImageRemove(ctx, imageId, dockertypes.ImageRemoveOptions{
+		Force:         true,
+		PruneChildren: true,
+	})
+	return err
+}
+
+func (r *dockerRuntime) RemoveContainer(ctx context.Context, containerId string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.ContainerRemove(ctx, containerId, dockertypes.ContainerRemoveOptions{})
+}
+
+func (r *dockerRuntime) PruneBuildCache(ctx context.Context, unusedFor time.Duration) (uint64, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	options := dockertypes.BuildCachePruneOptions{All: true}
+	if unusedFor > 0 {
+		options.Filters = dockerfilters.NewArgs(dockerfilters.Arg("until", unusedFor.String()))
+	}
+
+	report, err := client.BuildCachePrune(ctx, options)
+	if err != nil {
+		return 0, err
+	}
+
+	return report.SpaceReclaimed, nil
+}
+
+func (r *dockerRuntime) ListVolumes(ctx context.Context, projectName string) ([]string, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	list, err := client.VolumeList(ctx, projectFilter(projectName))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(list.Volumes))
+	for _, v := range list.Volumes {
+		names = append(names, v.Name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (r *dockerRuntime) RunHelper(ctx context.Context, image string, command []string, binds []string) (string, error) {
+	client, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	if _, err := ensurePulled(ctx, client, image, composetypes.PullPolicyMissing, io.Discard); err != nil {
+		return "", err
+	}
+
+	config := &container.Config{
+		Image: image,
+		Cmd:   command,
+	}
+
+	return runContainer(ctx, client, "", config, &container.HostConfig{Binds: binds}, nil, nil)
+}
+
+func (r *dockerRuntime) EnsureNetwork(ctx context.Context, name string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	existing, err := client.NetworkList(ctx, dockertypes.NetworkListOptions{
+		Filters: dockerfilters.NewArgs(dockerfilters.Arg("name", name)),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "failed to list networks")
+	}
+
+	for _, n := range existing {
+		// the name filter also matches substrings
+		if n.Name == name {
+			return nil
+		}
+	}
+
+	if _, err := client.NetworkCreate(ctx, name, dockertypes.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Attachable:     true,
+	}); err != nil {
+		return errors.WithMessagef(err, "failed to create network %s", name)
+	}
+
+	return nil
+}
+
+func (r *dockerRuntime) ConnectNetwork(ctx context.Context, name, containerId string, aliases []string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.NetworkConnect(ctx, name, containerId, &network.EndpointSettings{Aliases: aliases})
+}
+
+func (r *dockerRuntime) DisconnectNetwork(ctx context.Context, name, containerId string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.NetworkDisconnect(ctx, name, containerId, true)
+}
@@ -8,7 +8,9 @@ import (
 type Getter interface {
 	GetString(key string) string
 	GetInt(key string) int
+	GetBool(key string) bool
 	GetDuration(key string) time.Duration
+	GetStringSlice(key string) []string
 	Sub(key string) *viper.Viper
 }
 
@@ -22,10 +24,30 @@ func Setup() (Getter, error) {
 	viper.SetDefault("appRepo.reconciliationInterval", 1*time.Hour)
 	viper.SetDefault("configRepo.branchName", "main")
 	viper.SetDefault("configRepo.reconciliationInterval", 30*time.Minute)
+	viper.SetDefault("compose.engine", "cli")
+	viper.SetDefault("controller.project.workers", 4)
+	viper.SetDefault("deployment.history", 20)
+	viper.SetDefault("deployment.maxLogSizeMB", 10)
+	viper.SetDefault("gc.interval", 1*time.Hour)
+	viper.SetDefault("gc.keepImages", 3)
+	viper.SetDefault("gc.highWaterMarkGB", 0)
+	viper.SetDefault("gc.buildCacheMaxAge", 7*24*time.Hour)
+	viper.SetDefault("imageUpdate.interval", 10*time.Minute)
+	viper.SetDefault("localRepo.watch", true)
+	viper.SetDefault("registry.insecure", []string{})
+	viper.SetDefault("retry.baseDelay", 5*time.Second)
+	viper.SetDefault("retry.maxDelay", 5*time.Minute)
+	viper.SetDefault("retry.maxAttempts", 10)
+	viper.SetDefault("snapshot.dir", "/var/lib/recoon/snapshots")
+	viper.SetDefault("snapshot.helperImage", "busybox:1.36")
 	viper.SetDefault("ssh.keyDir", "/var/lib/recoon")
+	viper.SetDefault("ssh.trustOnFirstUse", false)
 	viper.SetDefault("store.databaseFile", "/var/lib/recoon/bbolt.db")
+	viper.SetDefault("store.deployLogDir", "/var/lib/recoon/logs")
+	viper.SetDefault("store.exportDir", "/var/lib/recoon/exports")
 	viper.SetDefault("store.gitDir", "/var/lib/recoon/repos")
 	viper.SetDefault("ui.port", 3680)
+	viper.SetDefault("webhook.port", 0)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
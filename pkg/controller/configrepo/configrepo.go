@@ -2,12 +2,17 @@ package configrepo
 
 import (
 	"context"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
 	"github.com/lacodon/recoon/pkg/gitrepo"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/reconcile"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"reflect"
 	"time"
 )
 
@@ -20,11 +25,17 @@ type Controller struct {
 	reconciliationInterval time.Duration
 	localGitDir            string
 	sshKeyDir              string
+	knownHosts             *knownhosts.KnownHosts
+	webhookSecret          *secretv1.KeyRef
+	immediateReconcile     <-chan string
+	requests               *reconcile.Tracker
 
 	repo gitrepo.GitRepository
 }
 
-func NewController(api store.GetterSetter, localGitDir, cloneURL, branchName string, reconciliationInterval time.Duration, sshKeyDir string) *Controller {
+// NewController returns a controller which pulls the config repo every reconciliationInterval or when triggered by
+// immediateReconcile, which receives the id of the reconcile request or an empty string for untracked requests
+func NewController(api store.GetterSetter, localGitDir, cloneURL, branchName string, reconciliationInterval time.Duration, sshKeyDir string, knownHosts *knownhosts.KnownHosts, webhookSecret *secretv1.KeyRef, immediateReconcile <-chan string) *Controller {
 	return &Controller{
 		cloneURL:               cloneURL,
 		branchName:             branchName,
@@ -32,27 +43,46 @@ func NewController(api store.GetterSetter, localGitDir, cloneURL, branchName str
 		reconciliationInterval: reconciliationInterval,
 		localGitDir:            localGitDir,
 		sshKeyDir:              sshKeyDir,
+		knownHosts:             knownHosts,
+		webhookSecret:          webhookSecret,
+		immediateReconcile:     immediateReconcile,
+		requests:               reconcile.New(api),
 	}
 }
 
 func (c *Controller) Run(ctx context.Context) error {
 	var err error
-	c.repo, err = gitrepo.NewGitRepository(ctx, c.localGitDir, c.cloneURL, c.branchName, c.sshKeyDir)
+	// the repository object may not exist before the first clone, so events refer to it by name
+	involved := &repositoryv1.Repository{
+		TypeMeta:   metav1.TypeMeta{Version: repositoryv1.VersionKind.Version, Kind: repositoryv1.VersionKind.Kind},
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigRepoName, Namespace: "recoon-system"},
+	}
+	c.repo, err = gitrepo.NewGitRepository(ctx, c.localGitDir, c.cloneURL, c.branchName, c.sshKeyDir,
+		gitrepo.WithHostKeyCallback(c.knownHosts.HostKeyCallback(involved, nil)))
 	if err != nil {
 		return errors.WithMessage(err, "failed to initialize config repo")
 	}
 
+	requestId := ""
 	for {
-		if err := c.runOnce(ctx); err != nil {
+		err := c.runOnce(ctx)
+		if err != nil {
 			logrus.WithError(err).Warn("failed to update config repo")
 		}
+		c.requests.Finish(requestId, c.repo.GetCurrentCommitId(), err)
+		requestId = ""
 
 		timer := time.NewTimer(c.reconciliationInterval)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return nil
 		case <-timer.C:
 			continue
+		case requestId = <-c.immediateReconcile:
+			timer.Stop()
+			logrus.Info("got immediate config repo reconcile event")
+			c.requests.Start(requestId)
 		}
 	}
 }
@@ -73,10 +103,7 @@ func (c *Controller) runOnce(ctx context.Context) error {
 					Name:      ConfigRepoName,
 					Namespace: "recoon-system",
 				},
-				Spec: &repositoryv1.Spec{
-					Url:    c.cloneURL,
-					Branch: c.branchName,
-				},
+				Spec: c.makeSpec(),
 				Status: &repositoryv1.Status{
 					LocalPath:       c.repo.GetLocalPath(),
 					CurrentCommitId: c.repo.GetCurrentCommitId(),
@@ -93,18 +120,31 @@ func (c *Controller) runOnce(ctx context.Context) error {
 		}
 	}
 
-	if apiRepo.Status.CurrentCommitId != c.repo.GetCurrentCommitId() {
-		apiRepo.Spec = &repositoryv1.Spec{
-			Url:    c.cloneURL,
-			Branch: c.branchName,
-		}
-		apiRepo.Status = &repositoryv1.Status{
+	if apiRepo.Status == nil || apiRepo.Status.CurrentCommitId != c.repo.GetCurrentCommitId() || !reflect.DeepEqual(apiRepo.Spec, c.makeSpec()) {
+		status := &repositoryv1.Status{
 			LocalPath:       c.repo.GetLocalPath(),
 			CurrentCommitId: c.repo.GetCurrentCommitId(),
 		}
+		// the errors of the config file stay until the new commit got parsed
+		if apiRepo.Status != nil {
+			if cond, ok := apiRepo.Status.Conditions[repositoryv1.ConditionConfigInvalid]; ok {
+				status.Conditions = conditionv1.Conditions{repositoryv1.ConditionConfigInvalid: cond}
+			}
+		}
+
+		apiRepo.Spec = c.makeSpec()
+		apiRepo.Status = status
 
 		return c.api.Update(apiRepo)
 	}
 
 	return nil
 }
+
+func (c *Controller) makeSpec() *repositoryv1.Spec {
+	return &repositoryv1.Spec{
+		Url:           c.cloneURL,
+		Branch:        c.branchName,
+		WebhookSecret: c.webhookSecret.DeepCopy(),
+	}
+}
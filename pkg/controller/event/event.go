@@ -2,11 +2,10 @@ package event
 
 import (
 	"context"
-	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
-	dockerclient "github.com/docker/docker/client"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -14,22 +13,19 @@ import (
 )
 
 type Controller struct {
-	api store.GetterSetter
+	api     store.GetterSetter
+	runtime compose.ContainerRuntime
 }
 
-func NewController(api store.GetterSetter) *Controller {
+func NewController(api store.GetterSetter, runtime compose.ContainerRuntime) *Controller {
 	return &Controller{
-		api: api,
+		api:     api,
+		runtime: runtime,
 	}
 }
 
 func (c *Controller) Run(ctx context.Context) error {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
-	if err != nil {
-		return errors.WithMessage(err, "failed to connect to docker daemon")
-	}
-
-	eventsCh, errCh := cli.Events(ctx, dockertypes.EventsOptions{})
+	eventsCh, errCh := c.runtime.Events(ctx)
 
 	for {
 		select {
@@ -46,7 +42,7 @@ func (c *Controller) Run(ctx context.Context) error {
 				WithField("actor", event.Actor.ID).
 				Debug("new event")
 
-			projectName := event.Actor.Attributes["com.docker.compose.project"]
+			projectName := compose.Owner(event.Actor.Attributes)
 
 			switch event.Action {
 			case "die":
@@ -67,29 +63,37 @@ func (c *Controller) Run(ctx context.Context) error {
 		case err := <-errCh:
 			logrus.WithError(err).Error("got error from docker events channel; restart channel")
 			time.Sleep(2 * time.Second)
-			eventsCh, errCh = cli.Events(ctx, dockertypes.EventsOptions{})
+			eventsCh, errCh = c.runtime.Events(ctx)
 		}
 	}
 }
 
 func (c *Controller) triggerReconcile(projectName string) error {
-	project := &projectv1.Project{}
-	if err := c.api.Get(metav1.NamespaceName{
-		Name:      projectName,
-		Namespace: "project-" + projectName,
-	}, project); err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			// project deleted, don't reconcile
-			return nil
+	var err error
+	// the project controller may update the project concurrently, so retry with the latest version
+	for attempt := 0; attempt < 3; attempt++ {
+		project := &projectv1.Project{}
+		if err = c.api.Get(metav1.NamespaceName{
+			Name:      projectName,
+			Namespace: "project-" + projectName,
+		}, project); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				// project deleted, don't reconcile
+				return nil
+			}
+			return err
+		}
+
+		if err = c.api.Update(project); !errors.Is(err, store.ErrObjectChanged) {
+			return err
 		}
-		return err
 	}
 
-	return c.api.Update(project)
+	return err
 }
 
 func (c *Controller) restartContainer(ctx context.Context, actor events.Actor) {
-	projectName := actor.Attributes["com.docker.compose.project"]
+	projectName := compose.Owner(actor.Attributes)
 
 	// load project to make sure restart is really required
 	project := &projectv1.Project{}
@@ -100,6 +104,5 @@ func (c *Controller) restartContainer(ctx context.Context, actor events.Actor) {
 		return
 	}
 
-	client, _ := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithAPIVersionNegotiation())
-	_ = client.ContainerStart(ctx, actor.ID, dockertypes.ContainerStartOptions{})
+	_ = c.runtime.StartContainer(ctx, actor.ID)
 }
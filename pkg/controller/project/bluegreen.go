@@ -0,0 +1,167 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	dockertypes "github.com/docker/docker/api/types"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"time"
+)
+
+// colors of the blue/green sets
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+)
+
+// healthPollInterval is how often the health of a new blue/green set is checked
+const healthPollInterval = time.Second
+
+// upBlueGreen brings up the other set of the project next to the live one, waits until it is healthy and moves the
+// network aliases to it before the old set is torn down. If anything fails, the new set is removed and the old one
+// keeps running.
+func (c *Controller) upBlueGreen(ctx context.Context, project *projectv1.Project, opts compose.Options) (*compose.Result, error) {
+	config := project.Spec.Compose.BlueGreen
+	out := opts.Output
+	if out == nil {
+		out = io.Discard
+	}
+
+	composeProject, err := compose.LoadProject(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// both sets run at the same time, so they can't bind the same host ports
+	for _, service := range composeProject.Services {
+		for _, port := range service.Ports {
+			if port.Published != "" {
+				return nil, fmt.Errorf("service %s publishes port %s which blue/green deployments can't bind twice; use the %s network instead", service.Name, port.Published, config.GetNetwork())
+			}
+		}
+	}
+
+	live := opts
+	color := colorBlue
+	if project.Status.ActiveColor == colorBlue {
+		color = colorGreen
+	}
+	opts.ProjectName = project.Name + "-" + color
+
+	network := config.GetNetwork()
+	if err := c.runtime.EnsureNetwork(ctx, network); err != nil {
+		return nil, err
+	}
+
+	_, _ = fmt.Fprintf(out, "bringing up %s set next to %s\n", opts.ProjectName, live.ProjectName)
+
+	result, err := c.composeUp(ctx, project, opts)
+	if err == nil {
+		_, _ = fmt.Fprintf(out, "waiting up to %s for %s to become healthy\n", config.GetHealthTimeout(), opts.ProjectName)
+		err = c.waitHealthy(ctx, opts.ProjectName, config.GetHealthTimeout())
+	}
+	if err == nil {
+		err = c.connectAliases(ctx, project, opts.ProjectName, network)
+	}
+	if err != nil {
+		c.tearDown(ctx, opts)
+		return result, errors.WithMessagef(err, "%s set failed, %s keeps running", color, live.ProjectName)
+	}
+
+	// the aliases resolve to both sets for a moment, so no request hits a missing alias
+	oldContainers, err := c.runtime.Status(ctx, live.ProjectName)
+	if err != nil {
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to list the containers of the old set")
+	}
+	for _, container := range oldContainers {
+		_ = c.runtime.DisconnectNetwork(ctx, network, container.ID)
+	}
+
+	project.Status.ActiveColor = color
+	_, _ = fmt.Fprintf(out, "switched network %s to %s\n", network, opts.ProjectName)
+	c.recorder.Record(project, "Switched", fmt.Sprintf("switched from %s to %s", live.ProjectName, opts.ProjectName))
+
+	c.tearDown(ctx, live)
+	return result, nil
+}
+
+// waitHealthy waits until all containers of the compose project run and pass their healthchecks
+func (c *Controller) waitHealthy(ctx context.Context, projectName string, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	for {
+		containers, err := c.runtime.Status(ctx, projectName)
+		if err != nil {
+			return err
+		}
+
+		healthy := true
+		for _, container := range containers {
+			if container.State != "running" {
+				return fmt.Errorf("container %s is %s", containerName(container), container.State)
+			}
+
+			switch compose.Health(container) {
+			case compose.HealthUnhealthy:
+				return fmt.Errorf("container %s is unhealthy", containerName(container))
+			case compose.HealthStarting:
+				healthy = false
+			}
+		}
+
+		if healthy {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("not healthy after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// connectAliases attaches the containers of the compose project to the network under the aliases of their services
+func (c *Controller) connectAliases(ctx context.Context, project *projectv1.Project, projectName, network string) error {
+	containers, err := c.runtime.Status(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		alias := project.Spec.Compose.BlueGreen.GetAlias(project.Name, container.Labels[compose.LabelService])
+		if err := c.runtime.ConnectNetwork(ctx, network, container.ID, []string{alias}); err != nil {
+			return errors.WithMessagef(err, "failed to connect container %s to network %s", containerName(container), network)
+		}
+	}
+
+	return nil
+}
+
+// tearDown removes a set of containers which is not live (anymore)
+func (c *Controller) tearDown(ctx context.Context, opts compose.Options) {
+	if err := c.engine.Down(ctx, opts); err != nil {
+		logrus.WithError(err).WithField("project", opts.ProjectName).Warn("failed to tear down set")
+		if opts.Output != nil {
+			_, _ = fmt.Fprintf(opts.Output, "failed to tear down %s: %s\n", opts.ProjectName, err.Error())
+		}
+	}
+}
+
+func containerName(container dockertypes.Container) string {
+	if len(container.Names) == 0 {
+		return container.ID
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/")
+}
@@ -2,14 +2,19 @@ package project
 
 import (
 	"context"
-	composecli "github.com/compose-spec/compose-go/cli"
+	"fmt"
 	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	hookv1 "github.com/lacodon/recoon/pkg/api/v1/hook"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
 	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/gitrepo"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -32,7 +37,11 @@ func (c *Controller) handleProjectCreateUpdate(ctx context.Context, event store.
 		}
 	}
 
-	projectContainers, err := compose.Status(ctx, project.Name)
+	if project.Spec.RestoreSnapshot != "" {
+		return c.handleRestoreRequest(ctx, project)
+	}
+
+	projectContainers, err := c.runtime.Status(ctx, ComposeProjectName(project))
 	if err != nil {
 		return err
 	}
@@ -45,7 +54,7 @@ func (c *Controller) handleProjectCreateUpdate(ctx context.Context, event store.
 		}
 	}
 
-	if project.Status.LastAppliedCommitId != project.Spec.CommitId {
+	if project.Status.LastAppliedCommitId != project.Spec.CommitId && project.Status.RolledBackCommitId != project.Spec.CommitId {
 		requireRestart = true
 	}
 
@@ -53,38 +62,93 @@ func (c *Controller) handleProjectCreateUpdate(ctx context.Context, event store.
 		requireRestart = true
 	}
 
+	// a reconcile request redeploys the project even if nothing changed
+	requestId := project.Spec.ReconcileRequest
+	if requestId != "" {
+		requireRestart = true
+	}
+
+	// values, secrets or compose options may change without a new commit; an empty hash is unknown
+	configHash := c.configHash(project, c.exportPath(project.Name, project.Spec.CommitId), project.Spec.CommitId)
+	if project.Status.RolledBackCommitId != project.Spec.CommitId && project.Status.ConfigHash != "" && project.Status.ConfigHash != configHash {
+		requireRestart = true
+	}
+
 	if !requireRestart {
 		return nil
 	}
 
-	project.Status.LastAppliedCommitId = project.Spec.CommitId
+	if ready, err := c.checkDependencies(project); err != nil || !ready {
+		return err
+	}
+
+	previousCommitId := project.Status.LastAppliedCommitId
+	deployCommitId := project.Spec.CommitId
+	if project.Status.RolledBackCommitId == project.Spec.CommitId && previousCommitId != "" {
+		// don't bring back a rolled back commit just because some containers are gone
+		deployCommitId = previousCommitId
+	} else {
+		project.Status.RolledBackCommitId = ""
+	}
+
+	// the exported files of a verified commit can't change, but the commit may have been refused since, e.g. if the
+	// trusted keys changed
+	if refused, err := c.verifyCommit(project, deployCommitId); refused || err != nil {
+		return err
+	}
+
+	project.Status.LastAppliedCommitId = deployCommitId
+	// the hash is known once the commit is exported, a failure before must not cause another deployment
+	project.Status.ConfigHash = ""
 
 	project.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
-	if err := compose.Up(project.Name, filepath.Join(project.Spec.LocalPath, project.Spec.ComposePath)); err != nil {
-		project.Status.Conditions[projectv1.ConditionFailure] = conditionv1.Condition{
-			LastTransitionTime: time.Now(),
-			Status:             "failure",
-			Message:            err.Error(),
-		}
 
-		if err := checkComposeSchema(project); err != nil {
-			project.Status.Conditions[projectv1.ConditionSchema] = conditionv1.Condition{
-				LastTransitionTime: time.Now(),
-				Status:             "invalid",
-				Message:            err.Error(),
+	c.requests.Start(requestId)
+	deployment, out := c.startDeployment(project, deployCommitId)
+
+	var result *compose.Result
+	if previousCommitId != "" && deployCommitId != previousCommitId {
+		// the volumes are archived while they still belong to the previous commit
+		err = c.takeSnapshot(ctx, project, previousCommitId, out)
+	}
+
+	if err == nil {
+		// hooks only run if a new commit gets deployed, not if containers are just restored
+		result, err = c.deploy(ctx, project, deployCommitId, deployCommitId != previousCommitId, out)
+	}
+
+	if err != nil {
+		var hookErr *hookError
+		if errors.As(err, &hookErr) && hookErr.hook.GetFailurePolicy() == hookv1.FailurePolicyRollback &&
+			previousCommitId != "" && previousCommitId != deployCommitId {
+			c.rollback(ctx, project, previousCommitId, err, out)
+		} else {
+			project.Status.Conditions[projectv1.ConditionFailure] = makeCondition("failure", err.Error())
+
+			if hookErr != nil {
+				project.Status.Conditions[projectv1.ConditionHook] = makeCondition("failure", err.Error())
+			} else if err := c.checkComposeSchema(project, deployCommitId); err != nil {
+				project.Status.Conditions[projectv1.ConditionSchema] = makeCondition("invalid", err.Error())
 			}
 		}
 
 		logrus.WithError(err).WithField("project", project.Name).Warn("failed to run docker-compose")
 	} else {
-		project.Status.Conditions[projectv1.ConditionSuccess] = conditionv1.Condition{
-			LastTransitionTime: time.Now(),
-			Status:             "success",
-			Message:            "docker-compose up was successful",
-		}
+		project.Status.Conditions[projectv1.ConditionSuccess] = makeCondition("success", "docker-compose up was successful")
+
+		// the containers of older commits have been replaced
+		c.pruneExports(project.Name, deployCommitId)
 	}
 
+	c.finishDeployment(deployment, out, err)
+	c.requests.Finish(requestId, deployCommitId, err)
+	project.Spec.ReconcileRequest = ""
+
+	// remember the containers created by the deployment, otherwise the next reconciliation would deploy again
 	project.Status.ContainerCount = len(projectContainers)
+	if err == nil && result != nil {
+		project.Status.ContainerCount = result.ContainerCount()
+	}
 
 	logrus.WithField("status", project.Status).Debug("update project")
 
@@ -92,19 +156,196 @@ func (c *Controller) handleProjectCreateUpdate(ctx context.Context, event store.
 		if !errors.Is(err, store.ErrNotFound) {
 			return err
 		}
+		return nil
+	}
+
+	if project.IsReady() {
+		c.triggerDependents(project)
 	}
 
 	return nil
 }
 
-func checkComposeSchema(project *projectv1.Project) error {
-	workingDir := filepath.Join(project.Spec.LocalPath, project.Spec.ComposePath)
-	_, err := composecli.ProjectFromOptions(&composecli.ProjectOptions{
-		WorkingDir:  workingDir,
-		ConfigPaths: []string{filepath.Join(workingDir, "docker-compose.yml")},
-		Environment: make(map[string]string),
-		EnvFiles:    []string{},
-	})
+// deploy runs docker compose up for the given commit of the project, optionally surrounded by its hooks. The commit
+// is deployed from its export, since the work tree may already contain newer, not yet verified commits.
+func (c *Controller) deploy(ctx context.Context, project *projectv1.Project, commitId string, withHooks bool, out io.Writer) (*compose.Result, error) {
+	repoDir, err := c.exportCommit(project, commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	project.Status.ConfigHash = ""
+	if commitId == project.Spec.CommitId {
+		project.Status.ConfigHash = c.configHash(project, repoDir, commitId)
+	}
+
+	opts, err := ComposeOptions(c.api, project, repoDir, commitId)
+	if err != nil {
+		return nil, err
+	}
+	opts.Output = out
+
+	if !withHooks {
+		return c.apply(ctx, project, opts)
+	}
+
+	hooks, err := loadHooks(project, filepath.Join(repoDir, project.Spec.ComposePath))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.runHooks(ctx, project, opts, "PreDeploy", hooks.PreDeploy, out); err != nil {
+		return nil, err
+	}
+
+	result, err := c.apply(ctx, project, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// the post deploy hooks run in the new set
+	opts.ProjectName = ComposeProjectName(project)
+	return result, c.runHooks(ctx, project, opts, "PostDeploy", hooks.PostDeploy, out)
+}
+
+// exportPath returns the export directory of the commit of the project
+func (c *Controller) exportPath(projectName, commitId string) string {
+	return filepath.Join(c.exportDir, projectName, commitId)
+}
+
+// exportCommit writes commitId of the project into its export directory, unless it has been exported before, and
+// returns it. The export is kept while the commit is deployed, since the containers bind mount its files.
+func (c *Controller) exportCommit(project *projectv1.Project, commitId string) (string, error) {
+	exportDir := c.exportPath(project.Name, commitId)
+	if _, err := os.Stat(exportDir); err == nil {
+		return exportDir, nil
+	}
+
+	// a partial export of an interrupted attempt is never used
+	tmpDir := exportDir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return "", errors.WithMessage(err, "failed to remove partial export")
+	}
+
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := gitrepo.ExportCommit(project.Spec.LocalPath, commitId, tmpDir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return "", errors.WithMessage(err, "failed to export commit "+commitId)
+	}
+
+	if err := os.Rename(tmpDir, exportDir); err != nil {
+		return "", err
+	}
+
+	return exportDir, nil
+}
+
+// pruneExports deletes the exports of the project except the one of the deployed commit
+func (c *Controller) pruneExports(projectName, deployedCommitId string) {
+	entries, err := os.ReadDir(filepath.Join(c.exportDir, projectName))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == deployedCommitId {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(c.exportDir, projectName, entry.Name())); err != nil {
+			logrus.WithError(err).WithField("project", projectName).Warn("failed to remove exported commit")
+		}
+	}
+}
+
+// removeExports deletes all exports of the project
+func (c *Controller) removeExports(projectName string) {
+	if err := os.RemoveAll(filepath.Join(c.exportDir, projectName)); err != nil {
+		logrus.WithError(err).WithField("project", projectName).Warn("failed to remove exported commits")
+	}
+}
+
+// apply replaces the live containers of the project with the ones of opts according to its strategy
+func (c *Controller) apply(ctx context.Context, project *projectv1.Project, opts compose.Options) (*compose.Result, error) {
+	if project.Spec.Compose.IsBlueGreen() {
+		return c.upBlueGreen(ctx, project, opts)
+	}
+
+	if project.Status.ActiveColor == "" {
+		return c.composeUp(ctx, project, opts)
+	}
+
+	// the strategy changed to recreate, so the live blue/green set is replaced by a recreated one
+	live := opts
+	opts.ProjectName = project.Name
+	result, err := c.composeUp(ctx, project, opts)
+	if err != nil {
+		return result, err
+	}
+
+	project.Status.ActiveColor = ""
+	c.tearDown(ctx, live)
+	return result, nil
+}
+
+// composeUp applies the compose project and records the outcome of every service as event
+func (c *Controller) composeUp(ctx context.Context, project *projectv1.Project, opts compose.Options) (*compose.Result, error) {
+	result, err := c.engine.Up(ctx, opts)
+	if result != nil && len(result.Services) > 0 {
+		lines := make([]string, 0, len(result.Services))
+		for _, service := range result.Services {
+			line := fmt.Sprintf("%s: %s", service.Service, service.Action)
+			if service.Error != "" {
+				line += " (" + service.Error + ")"
+			}
+			lines = append(lines, line)
+		}
+
+		reason := "ComposeApplied"
+		if err != nil {
+			reason = "ComposeFailed"
+		}
+		c.recorder.Record(project, reason, strings.Join(lines, "\n"))
+	}
+
+	return result, err
+}
+
+// rollback deploys the previous commit again after the deployment of the current commit failed with cause
+func (c *Controller) rollback(ctx context.Context, project *projectv1.Project, previousCommitId string, cause error, out io.Writer) {
+	project.Status.RolledBackCommitId = project.Status.LastAppliedCommitId
+	project.Status.LastAppliedCommitId = previousCommitId
+	project.Status.Conditions[projectv1.ConditionHook] = makeCondition("failure", cause.Error())
 
-	return err
+	logrus.WithField("project", project.Name).WithField("commit", previousCommitId).Info("roll back project")
+	_, _ = fmt.Fprintf(out, "rolling back to commit %s\n", previousCommitId)
+
+	if c.restoreOnRollback(project, previousCommitId) {
+		if err := c.restoreSnapshot(ctx, project, project.Status.LastSnapshot, out); err != nil {
+			// the previous commit is deployed anyway, since it may cope with the migrated data
+			_, _ = fmt.Fprintf(out, "failed to restore snapshot: %s\n", err.Error())
+			c.recorder.Record(project, "SnapshotRestoreFailed", err.Error())
+		}
+	}
+
+	if _, err := c.deploy(ctx, project, previousCommitId, false, out); err != nil {
+		project.Status.Conditions[projectv1.ConditionFailure] = makeCondition("failure", fmt.Sprintf("%s; rollback to %s failed: %s", cause.Error(), previousCommitId, err.Error()))
+		c.recorder.Record(project, "RollbackFailed", err.Error())
+		return
+	}
+
+	project.Status.Conditions[projectv1.ConditionFailure] = makeCondition("failure", fmt.Sprintf("%s; rolled back to %s", cause.Error(), previousCommitId))
+	c.pruneExports(project.Name, previousCommitId)
+	c.recorder.Record(project, "RolledBack", fmt.Sprintf("rolled back from %s to %s", project.Status.RolledBackCommitId, previousCommitId))
+}
+
+func makeCondition(status conditionv1.Status, message string) conditionv1.Condition {
+	return conditionv1.Condition{
+		LastTransitionTime: time.Now(),
+		Status:             status,
+		Message:            message,
+	}
 }
@@ -2,6 +2,7 @@ package project
 
 import (
 	"context"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
 	"github.com/lacodon/recoon/pkg/compose"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/sirupsen/logrus"
@@ -10,9 +11,22 @@ import (
 func (c *Controller) handleProjectDelete(ctx context.Context, event store.Event) error {
 	logrus.WithField("project", event.PreviousObject.GetNamespaceName()).Debug("run compose down")
 
-	if err := compose.Down(event.PreviousObject.GetName()); err != nil {
+	opts := compose.Options{ProjectName: event.PreviousObject.GetName()}
+	project, ok := event.PreviousObject.(*projectv1.Project)
+	if ok && project.Spec != nil {
+		if projectOpts, err := c.deployedComposeOptions(project); err == nil {
+			opts = projectOpts
+		}
+	}
+
+	if err := c.engine.Down(ctx, opts); err != nil {
 		logrus.WithError(err).WithField("project", event.PreviousObject.GetNamespaceName()).Error("error during docker-compose down")
 	}
 
+	if ok {
+		c.deleteDeployments(project)
+	}
+	c.removeExports(event.PreviousObject.GetName())
+
 	return nil
 }
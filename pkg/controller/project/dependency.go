@@ -0,0 +1,148 @@
+package project
+
+import (
+	"fmt"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"strings"
+)
+
+// checkDependencies updates the dependency status of the project and reports whether it is allowed to be deployed
+func (c *Controller) checkDependencies(project *projectv1.Project) (bool, error) {
+	if len(project.Spec.DependsOn) == 0 {
+		project.Status.BlockedBy = nil
+		return true, nil
+	}
+
+	projectList, err := c.api.List(projectv1.VersionKind)
+	if err != nil {
+		return false, errors.WithMessage(err, "failed to list projects")
+	}
+
+	projects := make(map[string]*projectv1.Project, len(projectList))
+	graph := make(map[string][]string, len(projectList))
+	for _, p := range projectList {
+		other := p.(*projectv1.Project)
+		projects[other.Name] = other
+		if other.Spec != nil {
+			graph[other.Name] = other.Spec.DependsOn
+		}
+	}
+	// the stored version might be outdated
+	graph[project.Name] = project.Spec.DependsOn
+
+	blockedBy := make([]string, 0)
+	for _, dependency := range project.Spec.DependsOn {
+		if other, ok := projects[dependency]; !ok || !other.IsReady() {
+			blockedBy = append(blockedBy, dependency)
+		}
+	}
+
+	statusBefore := project.DeepCopy().(*projectv1.Project).Status
+
+	cycle := findCycle(graph, project.Name)
+	if cycle != nil {
+		project.Status.Conditions[projectv1.ConditionDependencyCycle] = makeCondition("invalid", "dependency cycle: "+strings.Join(cycle, " -> "))
+	} else {
+		delete(project.Status.Conditions, projectv1.ConditionDependencyCycle)
+	}
+
+	if len(blockedBy) > 0 {
+		project.Status.Conditions[projectv1.ConditionDependency] = makeCondition("blocked", fmt.Sprintf("waiting for %s", strings.Join(blockedBy, ", ")))
+		project.Status.BlockedBy = blockedBy
+	} else {
+		delete(project.Status.Conditions, projectv1.ConditionDependency)
+		project.Status.BlockedBy = nil
+	}
+
+	if len(blockedBy) == 0 && cycle == nil {
+		return true, nil
+	}
+
+	if !sameDependencyStatus(statusBefore, project.Status) {
+		logrus.WithField("project", project.Name).WithField("blockedBy", blockedBy).Info("project is blocked by its dependencies")
+
+		if err := c.api.Update(project); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// triggerDependents reconciles all blocked projects which depend on the given project
+func (c *Controller) triggerDependents(project *projectv1.Project) {
+	projectList, err := c.api.List(projectv1.VersionKind)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list projects")
+		return
+	}
+
+	for _, p := range projectList {
+		other := p.(*projectv1.Project)
+		if other.Spec == nil || other.Status == nil || len(other.Status.BlockedBy) == 0 {
+			continue
+		}
+
+		for _, dependency := range other.Spec.DependsOn {
+			if dependency != project.Name {
+				continue
+			}
+
+			logrus.WithField("project", other.Name).WithField("dependency", project.Name).Debug("dependency is ready, trigger reconciliation")
+			if err := c.api.Update(other); err != nil {
+				logrus.WithError(err).WithField("project", other.Name).Warn("failed to trigger reconciliation of dependent project")
+			}
+			break
+		}
+	}
+}
+
+// findCycle returns the first dependency cycle which contains start or nil if there is none
+func findCycle(graph map[string][]string, start string) []string {
+	visited := make(map[string]bool)
+
+	var visit func(node string, path []string) []string
+	visit = func(node string, path []string) []string {
+		path = append(path, node)
+
+		for _, next := range graph[node] {
+			if next == start {
+				return append(path, next)
+			}
+
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+
+			if cycle := visit(next, path); cycle != nil {
+				return cycle
+			}
+		}
+
+		return nil
+	}
+
+	return visit(start, nil)
+}
+
+func sameDependencyStatus(a, b *projectv1.Status) bool {
+	if !reflect.DeepEqual(a.BlockedBy, b.BlockedBy) {
+		return false
+	}
+
+	for _, typ := range []conditionv1.Type{projectv1.ConditionDependency, projectv1.ConditionDependencyCycle} {
+		condA, okA := a.Conditions[typ]
+		condB, okB := b.Conditions[typ]
+		if okA != okB || condA.Message != condB.Message {
+			return false
+		}
+	}
+
+	return true
+}
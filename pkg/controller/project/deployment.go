@@ -0,0 +1,172 @@
+package project
+
+import (
+	"fmt"
+	deploymentv1 "github.com/lacodon/recoon/pkg/api/v1/deployment"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"time"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// startDeployment records a new deploy attempt of the project and opens its log. Failing to record the attempt
+// must not prevent the deployment, so the returned deployment is nil and the log discards everything in that case.
+func (c *Controller) startDeployment(project *projectv1.Project, commitId string) (*deploymentv1.Deployment, io.WriteCloser) {
+	logger := logrus.WithField("project", project.Name)
+
+	deployments, err := c.listDeployments(project)
+	if err != nil {
+		logger.WithError(err).Warn("failed to list deployments")
+		return nil, nopWriteCloser{io.Discard}
+	}
+
+	revision := 1
+	if len(deployments) > 0 {
+		revision = deployments[len(deployments)-1].Spec.Revision + 1
+	}
+
+	deployment := &deploymentv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentv1.MakeName(project.Name, revision),
+			Namespace: project.Namespace,
+		},
+		Spec: &deploymentv1.Spec{
+			Project: metav1.ObjectRef{
+				Version:   projectv1.VersionKind.Version,
+				Kind:      projectv1.VersionKind.Kind,
+				Namespace: project.Namespace,
+				Name:      project.Name,
+			},
+			CommitId: commitId,
+			Revision: revision,
+		},
+		Status: &deploymentv1.Status{
+			Phase:     deploymentv1.PhaseRunning,
+			StartTime: time.Now(),
+		},
+	}
+
+	if err := c.api.Create(deployment); err != nil {
+		logger.WithError(err).Warn("failed to record deployment")
+		return nil, nopWriteCloser{io.Discard}
+	}
+
+	// keep the configured number of revisions
+	for _, old := range deployments {
+		if old.Spec.Revision > revision-c.deployLogs.Keep() {
+			break
+		}
+		_ = c.api.Delete(deploymentv1.VersionKind, old.GetNamespaceName())
+	}
+
+	out, err := c.deployLogs.Create(project.Name, revision)
+	if err != nil {
+		logger.WithError(err).Warn("failed to create deploy log")
+		return deployment, nopWriteCloser{io.Discard}
+	}
+
+	_, _ = fmt.Fprintf(out, "deploying commit %s of project %s (revision %d)\n", commitId, project.Name, revision)
+	return deployment, out
+}
+
+// finishDeployment records the result of the deploy attempt
+func (c *Controller) finishDeployment(deployment *deploymentv1.Deployment, out io.WriteCloser, deployErr error) {
+	endTime := time.Now()
+
+	if deployErr != nil {
+		_, _ = fmt.Fprintf(out, "deployment failed: %s\n", deployErr.Error())
+	} else {
+		_, _ = fmt.Fprintln(out, "deployment succeeded")
+	}
+	_ = out.Close()
+
+	if deployment == nil {
+		return
+	}
+
+	deployment.Status.EndTime = &endTime
+	deployment.Status.Phase = deploymentv1.PhaseSucceeded
+	if deployErr != nil {
+		deployment.Status.Phase = deploymentv1.PhaseFailed
+		deployment.Status.Message = deployErr.Error()
+	}
+
+	if err := c.api.Update(deployment); err != nil {
+		logrus.WithError(err).WithField("deployment", deployment.Name).Warn("failed to record deployment result")
+	}
+}
+
+// listDeployments returns the deployments of the project sorted by revision
+func (c *Controller) listDeployments(project *projectv1.Project) ([]*deploymentv1.Deployment, error) {
+	list, err := c.api.List(deploymentv1.VersionKind, store.InNamespace(project.Namespace), store.WithNamePrefix(project.Name+"."))
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := make([]*deploymentv1.Deployment, 0, len(list))
+	for _, obj := range list {
+		deployment := obj.(*deploymentv1.Deployment)
+		if deployment.Spec == nil || deployment.Spec.Project.Name != project.Name {
+			continue
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].Spec.Revision < deployments[j].Spec.Revision
+	})
+
+	return deployments, nil
+}
+
+// failInterruptedDeployments marks deployments which were still running when recoon stopped as failed
+func (c *Controller) failInterruptedDeployments() error {
+	list, err := c.api.List(deploymentv1.VersionKind)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range list {
+		deployment := obj.(*deploymentv1.Deployment)
+		if deployment.Status == nil || deployment.IsFinished() {
+			continue
+		}
+
+		endTime := time.Now()
+		deployment.Status.Phase = deploymentv1.PhaseFailed
+		deployment.Status.EndTime = &endTime
+		deployment.Status.Message = "interrupted by restart of recoon"
+		if err := c.api.Update(deployment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteDeployments removes all deployments and deploy logs of the project
+func (c *Controller) deleteDeployments(project *projectv1.Project) {
+	deployments, err := c.listDeployments(project)
+	if err != nil {
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to list deployments")
+	}
+
+	for _, deployment := range deployments {
+		_ = c.api.Delete(deploymentv1.VersionKind, deployment.GetNamespaceName())
+	}
+
+	if err := c.deployLogs.RemoveAll(project.Name); err != nil {
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to remove deploy logs")
+	}
+}
@@ -0,0 +1,105 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	hookv1 "github.com/lacodon/recoon/pkg/api/v1/hook"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ProjectConfigFile can be placed beside the docker-compose.yml to configure the project from within the app repo
+const ProjectConfigFile = ".recoon.yml"
+
+type projectConfig struct {
+	Hooks *hookv1.Hooks `yaml:"hooks"`
+}
+
+// hookError is returned if a hook failed and its failure policy does not allow to continue
+type hookError struct {
+	phase string
+	hook  hookv1.Hook
+	err   error
+}
+
+func (h *hookError) Error() string {
+	return fmt.Sprintf("%s hook %q failed: %s", h.phase, h.hook.Name, h.err.Error())
+}
+
+func (h *hookError) Unwrap() error {
+	return h.err
+}
+
+// loadHooks returns the hooks from the project spec followed by the hooks from the ProjectConfigFile in composeDir
+func loadHooks(project *projectv1.Project, composeDir string) (*hookv1.Hooks, error) {
+	hooks := project.Spec.Hooks.Append(nil)
+
+	data, err := os.ReadFile(filepath.Join(composeDir, ProjectConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hooks, nil
+		}
+		return nil, errors.WithMessage(err, "failed to read "+ProjectConfigFile)
+	}
+
+	cfg := &projectConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, errors.WithMessage(err, "failed to unmarshal "+ProjectConfigFile)
+	}
+
+	return hooks.Append(cfg.Hooks), nil
+}
+
+// runHooks runs the hooks one after another and records their output as events and in the deploy log
+func (c *Controller) runHooks(ctx context.Context, project *projectv1.Project, opts compose.Options, phase string, hooks []hookv1.Hook, out io.Writer) error {
+	for _, hook := range hooks {
+		logger := logrus.WithField("project", project.Name).WithField("hook", hook.Name)
+		logger.Debugf("run %s hook", phase)
+
+		_, _ = fmt.Fprintf(out, "running %s hook %q\n", phase, hook.Name)
+		output, err := c.runHook(ctx, opts, hook)
+		_, _ = fmt.Fprintln(out, output)
+		if err == nil {
+			c.recorder.Record(project, phase+"HookSucceeded", fmt.Sprintf("hook %q succeeded:\n%s", hook.Name, output))
+			continue
+		}
+
+		c.recorder.Record(project, phase+"HookFailed", fmt.Sprintf("hook %q failed: %s\n%s", hook.Name, err.Error(), output))
+		logger.WithError(err).Warnf("%s hook failed", phase)
+
+		if hook.GetFailurePolicy() == hookv1.FailurePolicyIgnore {
+			project.Status.Conditions[projectv1.ConditionHook] = makeCondition("ignored", fmt.Sprintf("%s hook %q failed: %s", phase, hook.Name, err.Error()))
+			continue
+		}
+
+		return &hookError{
+			phase: phase,
+			hook:  hook,
+			err:   err,
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) runHook(ctx context.Context, opts compose.Options, hook hookv1.Hook) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, hook.GetTimeout())
+	defer cancel()
+
+	switch {
+	case hook.Service != "" && hook.Image != "":
+		return "", errors.New("service and image are mutually exclusive")
+	case hook.Service != "":
+		return c.engine.Run(ctx, opts, hook.Service, hook.Command)
+	case hook.Image != "":
+		return c.engine.RunImage(ctx, hook.Image, hook.Command)
+	default:
+		return "", errors.New("either service or image must be set")
+	}
+}
@@ -0,0 +1,168 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/render"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"strings"
+)
+
+// checkComposeSchema loads the compose project of the exported commit
+func (c *Controller) checkComposeSchema(project *projectv1.Project, commitId string) error {
+	opts, err := ComposeOptions(c.api, project, c.exportPath(project.Name, commitId), commitId)
+	if err != nil {
+		return err
+	}
+
+	_, err = compose.LoadProject(opts)
+	return err
+}
+
+// deployedComposeOptions returns the compose options of the exported commit which is deployed, the work tree may
+// already contain a newer commit
+func (c *Controller) deployedComposeOptions(project *projectv1.Project) (compose.Options, error) {
+	if project.Status == nil || project.Status.LastAppliedCommitId == "" {
+		return compose.Options{}, errors.New("no commit deployed")
+	}
+
+	commitId := project.Status.LastAppliedCommitId
+	return ComposeOptions(c.api, project, c.exportPath(project.Name, commitId), commitId)
+}
+
+// configHash returns a hash of the loaded compose project of the commit checked out in repoDir which changes with the
+// rendered values and secrets as well; it is empty if the project can't be loaded
+func (c *Controller) configHash(project *projectv1.Project, repoDir, commitId string) string {
+	opts, err := ComposeOptions(c.api, project, repoDir, commitId)
+	if err != nil {
+		return ""
+	}
+	// the name of the live blue/green set changes with every deployment
+	opts.ProjectName = project.Name
+
+	composeProject, err := compose.LoadProject(opts)
+	if err != nil {
+		return ""
+	}
+
+	data, err := composeProject.MarshalYAML()
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// ComposeOptions returns the compose options of the given commit of the project whose repository is checked out in repoDir
+func ComposeOptions(api store.Getter, project *projectv1.Project, repoDir, commitId string) (compose.Options, error) {
+	return composeOptions(api, project, repoDir, commitId, false)
+}
+
+// PreviewComposeOptions returns the ComposeOptions for showing the project to users; the values of secrets are redacted
+func PreviewComposeOptions(api store.Getter, project *projectv1.Project, repoDir, commitId string) (compose.Options, error) {
+	return composeOptions(api, project, repoDir, commitId, true)
+}
+
+func composeOptions(api store.Getter, project *projectv1.Project, repoDir, commitId string, preview bool) (compose.Options, error) {
+	composeDir := filepath.Join(repoDir, project.Spec.ComposePath)
+	opts := compose.Options{
+		ProjectName: ComposeProjectName(project),
+		WorkingDir:  composeDir,
+	}
+
+	// every container carries the recoon project, the garbage collector only touches marked containers and images
+	opts.Labels = make(map[string]string, len(project.Spec.Labels)+1)
+	for key, value := range project.Spec.Labels {
+		opts.Labels[key] = value
+	}
+	opts.Labels[compose.LabelOwner] = project.Name
+
+	config := project.Spec.Compose
+	if config == nil {
+		return opts, nil
+	}
+
+	if project.Status != nil && len(config.Images) > 0 {
+		opts.Images = make(map[string]string, len(config.Images))
+		for service := range config.Images {
+			if image, ok := project.Status.Images[service]; ok {
+				opts.Images[service] = image
+			}
+		}
+	}
+
+	var err error
+	if opts.ConfigFiles, err = resolvePaths(repoDir, composeDir, config.Files); err != nil {
+		return opts, err
+	}
+
+	if opts.EnvFiles, err = resolvePaths(repoDir, composeDir, config.EnvFiles); err != nil {
+		return opts, err
+	}
+
+	if opts.Patches, err = resolvePaths(repoDir, composeDir, config.Patches); err != nil {
+		return opts, err
+	}
+
+	opts.Profiles = config.Profiles
+	opts.Environment = config.Environment
+
+	// like docker compose, the project directory defaults to the directory of the first file
+	if config.ProjectDir != "" {
+		projectDir, err := resolvePaths(repoDir, composeDir, []string{config.ProjectDir})
+		if err != nil {
+			return opts, err
+		}
+		opts.WorkingDir = projectDir[0]
+	} else if len(opts.ConfigFiles) > 0 {
+		opts.WorkingDir = filepath.Dir(opts.ConfigFiles[0])
+	}
+
+	if config.Template {
+		data := render.Data{
+			Project: project.Name,
+			Commit:  commitId,
+			Values:  config.Values,
+		}
+
+		if preview {
+			opts.Render = render.NewPreview(api, data).Render
+		} else {
+			opts.Render = render.New(api, data).Render
+		}
+	}
+
+	return opts, nil
+}
+
+// ComposeProjectName returns the name of the compose project whose containers are live
+func ComposeProjectName(project *projectv1.Project) string {
+	if project.Status != nil && project.Status.ActiveColor != "" {
+		return project.Name + "-" + project.Status.ActiveColor
+	}
+
+	return project.Name
+}
+
+// resolvePaths joins the paths to composeDir and makes sure that they don't leave the repository
+func resolvePaths(repoDir, composeDir string, paths []string) ([]string, error) {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		joined := filepath.Join(composeDir, path)
+
+		rel, err := filepath.Rel(repoDir, joined)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("path %s is outside of the repository", path)
+		}
+
+		resolved = append(resolved, joined)
+	}
+
+	return resolved, nil
+}
@@ -2,42 +2,78 @@ package project
 
 import (
 	"context"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/deploylog"
+	"github.com/lacodon/recoon/pkg/eventrecorder"
+	"github.com/lacodon/recoon/pkg/reconcile"
 	"github.com/lacodon/recoon/pkg/retry"
+	"github.com/lacodon/recoon/pkg/snapshot"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/lacodon/recoon/pkg/watcher"
+	"github.com/lacodon/recoon/pkg/workqueue"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type Controller struct {
-	events  <-chan store.Event
-	api     store.GetterSetter
-	retryer retry.Retryer
+	events     <-chan store.Event
+	api        store.GetterSetter
+	queue      *workqueue.Queue
+	workers    int
+	recorder   *eventrecorder.Recorder
+	engine     compose.Engine
+	runtime    compose.ContainerRuntime
+	deployLogs *deploylog.Store
+	snapshots  *snapshot.Store
+	requests   *reconcile.Tracker
+	exportDir  string
 }
 
-func NewController(apiWatcher watcher.Watcher, api store.GetterSetter) *Controller {
-	events := apiWatcher.Watch(projectv1.VersionKind)
-
+// NewController creates a project controller which reconciles up to workers projects concurrently. The deployed
+// commits are exported below exportDir.
+func NewController(apiWatcher watcher.Watcher, api store.GetterSetter, engine compose.Engine, runtime compose.ContainerRuntime, deployLogs *deploylog.Store, snapshots *snapshot.Store, exportDir string, workers int, backoff *retry.Backoff) *Controller {
 	return &Controller{
-		events:  events,
-		api:     api,
-		retryer: retry.New(events),
+		events:     apiWatcher.Watch(projectv1.VersionKind),
+		api:        api,
+		queue:      workqueue.New(backoff),
+		workers:    workers,
+		recorder:   eventrecorder.New(api),
+		engine:     engine,
+		runtime:    runtime,
+		deployLogs: deployLogs,
+		snapshots:  snapshots,
+		requests:   reconcile.New(api),
+		exportDir:  exportDir,
 	}
 }
 
 func (c *Controller) Run(ctx context.Context) error {
-	if err := c.reconcileEveryProject(ctx); err != nil {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-c.events:
+				if !ok {
+					return
+				}
+				c.queue.Add(event)
+			}
+		}
+	}()
+
+	if err := c.failInterruptedDeployments(); err != nil {
 		return err
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case event := <-c.events:
-			c.retryer.RetryOnError(ctx, event, c.handleProjectChangeEvent)
-		}
+	if err := c.reconcileEveryProject(ctx); err != nil {
+		return err
 	}
+
+	c.queue.Run(ctx, c.workers, c.handleProjectChangeEvent, c.handleGiveUp)
+	return nil
 }
 
 func (c *Controller) reconcileEveryProject(ctx context.Context) error {
@@ -72,3 +108,33 @@ func (c *Controller) handleProjectChangeEvent(ctx context.Context, event store.E
 		panic("unimplemented event type: " + event.Type)
 	}
 }
+
+// handleGiveUp marks the project as permanently failed until it gets reconciled successfully
+func (c *Controller) handleGiveUp(_ context.Context, event store.Event, err error) {
+	if event.Type == store.EventTypeDelete {
+		return
+	}
+
+	project := &projectv1.Project{}
+	if err := c.api.Get(event.ObjectNamespaceName, project); err != nil {
+		return
+	}
+
+	if project.Status == nil {
+		project.Status = &projectv1.Status{}
+	}
+
+	if project.Status.Conditions == nil {
+		project.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
+	}
+
+	message := "giving up after too many failed attempts: " + err.Error()
+	if cond, ok := project.Status.Conditions[projectv1.ConditionRetryExhausted]; ok && cond.Message == message {
+		return
+	}
+
+	project.Status.Conditions[projectv1.ConditionRetryExhausted] = makeCondition("failure", message)
+	if err := c.api.Update(project); err != nil {
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to record permanent failure")
+	}
+}
@@ -0,0 +1,873 @@
+package project_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	deploymentv1 "github.com/lacodon/recoon/pkg/api/v1/deployment"
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/compose/fake"
+	"github.com/lacodon/recoon/pkg/controller/event"
+	"github.com/lacodon/recoon/pkg/controller/project"
+	"github.com/lacodon/recoon/pkg/deploylog"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/reconcile"
+	"github.com/lacodon/recoon/pkg/retry"
+	"github.com/lacodon/recoon/pkg/snapshot"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/lacodon/recoon/pkg/watcher"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const composeFile = `
+services:
+  web:
+    image: nginx:1.23
+  db:
+    image: postgres:15
+`
+
+var _ = Describe("Controller", func() {
+	var (
+		api         *store.DefaultStore
+		backend     *fake.Backend
+		deployLogs  *deploylog.Store
+		composeDir  string
+		snapshotDir string
+		exportDir   string
+		worktree    *git.Worktree
+		cancel      context.CancelFunc
+		nn          = metav1.NamespaceName{Name: "app", Namespace: "project-app"}
+	)
+
+	getProject := func() *projectv1.Project {
+		p := &projectv1.Project{}
+		Expect(api.Get(nn, p)).To(Succeed())
+		return p
+	}
+
+	hasCondition := func(typ conditionv1.Type) func() bool {
+		return func() bool {
+			p := getProject()
+			if p.Status == nil {
+				return false
+			}
+			_, ok := p.Status.Conditions[typ]
+			return ok
+		}
+	}
+
+	createProject := func(commitId string) {
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commitId,
+				ComposePath: ".",
+			},
+		})).To(Succeed())
+	}
+
+	// commit commits all files of composeDir and returns the commit id
+	commit := func() string {
+		Expect(worktree.AddWithOptions(&git.AddOptions{All: true})).To(Succeed())
+		hash, err := worktree.Commit("update", &git.CommitOptions{
+			Author:            &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+			AllowEmptyCommits: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return hash.String()
+	}
+
+	updateCommit := func(commitId string) {
+		// the controller may update the status at the same time
+		Eventually(func() error {
+			p := getProject()
+			p.Spec.CommitId = commitId
+			return api.Update(p)
+		}).Should(Succeed())
+	}
+
+	runningContainers := func() int {
+		running := 0
+		for _, c := range backend.Containers(nn.Name) {
+			if c.State == fake.StateRunning {
+				running++
+			}
+		}
+		return running
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		composeDir = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(composeFile), 0644)).To(Succeed())
+		repo, err := git.PlainInit(composeDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		worktree, err = repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotDir = GinkgoT().TempDir()
+		exportDir = GinkgoT().TempDir()
+		backend = fake.New()
+		apiWatcher := watcher.NewDefaultWatcher(api.EventsChan())
+		deployLogs = deploylog.New(GinkgoT().TempDir(), 0, 3)
+		projectController := project.NewController(apiWatcher, api, backend, backend, deployLogs,
+			snapshot.New(snapshotDir, "busybox", backend), exportDir, 2,
+			retry.NewBackoff(10*time.Millisecond, 50*time.Millisecond, 3))
+		eventController := event.NewController(api, backend)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() { _ = apiWatcher.Run(ctx) }()
+		go func() { _ = projectController.Run(ctx) }()
+		go func() { _ = eventController.Run(ctx) }()
+	})
+
+	AfterEach(func() {
+		cancel()
+		// give the controllers time to stop before the store is closed
+		time.Sleep(20 * time.Millisecond)
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should bring up a created project", func() {
+		c1 := commit()
+		createProject(c1)
+
+		Eventually(runningContainers).Should(Equal(2))
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		Eventually(func() int { return getProject().Status.ContainerCount }).Should(Equal(2))
+
+		p := getProject()
+		Expect(p.Status.LastAppliedCommitId).To(Equal(c1))
+		Expect(p.IsReady()).To(BeTrue())
+	})
+
+	It("should apply a new commit", func() {
+		createProject(commit())
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:1.24
+`), 0644)).To(Succeed())
+		c2 := commit()
+		updateCommit(c2)
+
+		Eventually(func() string { return getProject().Status.LastAppliedCommitId }).Should(Equal(c2))
+		Eventually(func() []string {
+			images := make([]string, 0)
+			for _, c := range backend.Containers(nn.Name) {
+				images = append(images, c.Image)
+			}
+			return images
+		}).Should(ConsistOf("nginx:1.24"))
+	})
+
+	It("should deploy the files of its commit if the work tree contains a newer one", func() {
+		c1 := commit()
+		createProject(c1)
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		ups := len(backend.Calls("Up", nn.Name))
+
+		// a commit which doesn't touch the include paths is checked out, but the project keeps its commit
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:1.24
+`), 0644)).To(Succeed())
+		commit()
+
+		backend.Remove(backend.Containers(nn.Name)[0].ID)
+		Eventually(func() int { return len(backend.Calls("Up", nn.Name)) }).Should(BeNumerically(">", ups))
+
+		calls := backend.Calls("Up", nn.Name)
+		Expect(calls[len(calls)-1].WorkingDir).To(Equal(filepath.Join(exportDir, nn.Name, c1)))
+		Eventually(runningContainers).Should(Equal(2))
+		for _, c := range backend.Containers(nn.Name) {
+			Expect(c.Image).NotTo(Equal("nginx:1.24"))
+		}
+		Expect(getProject().Status.LastAppliedCommitId).To(Equal(c1))
+	})
+
+	It("should not run compose up again if nothing changed", func() {
+		createProject(commit())
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+
+		calls := len(backend.Calls("Up", nn.Name))
+		Expect(api.Update(getProject())).To(Succeed())
+
+		Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(Equal(calls))
+	})
+
+	It("should redeploy an unchanged commit on a reconcile request and report the outcome", func() {
+		c1 := commit()
+		createProject(c1)
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		calls := len(backend.Calls("Up", nn.Name))
+
+		request, err := reconcile.New(api).Create(reconcilev1.TargetProject, nn.Name)
+		Expect(err).NotTo(HaveOccurred())
+		p := getProject()
+		p.Spec.ReconcileRequest = request.Name
+		Expect(api.Update(p)).To(Succeed())
+
+		getRequest := func() *reconcilev1.Reconcile {
+			r := &reconcilev1.Reconcile{}
+			Expect(api.Get(request.GetNamespaceName(), r)).To(Succeed())
+			return r
+		}
+
+		Eventually(func() bool { return getRequest().IsFinished() }).Should(BeTrue())
+		Expect(getRequest().Status.Phase).To(Equal(reconcilev1.PhaseSucceeded))
+		Expect(getRequest().Status.CommitId).To(Equal(c1))
+		Expect(backend.Calls("Up", nn.Name)).To(HaveLen(calls + 1))
+		Eventually(func() string { return getProject().Spec.ReconcileRequest }).Should(BeEmpty())
+	})
+
+	It("should record every deploy attempt with its log", func() {
+		c1 := commit()
+		createProject(c1)
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+
+		backend.SetError("Up", nn.Name, errors.New("build failed"))
+		c2 := commit()
+		updateCommit(c2)
+		Eventually(hasCondition(projectv1.ConditionFailure)).Should(BeTrue())
+
+		getDeployment := func(revision int) *deploymentv1.Deployment {
+			deployment := &deploymentv1.Deployment{}
+			Expect(api.Get(metav1.NamespaceName{
+				Name:      deploymentv1.MakeName(nn.Name, revision),
+				Namespace: nn.Namespace,
+			}, deployment)).To(Succeed())
+			return deployment
+		}
+
+		Eventually(func() bool { return getDeployment(2).IsFinished() }).Should(BeTrue())
+
+		first := getDeployment(1)
+		Expect(first.Spec.CommitId).To(Equal(c1))
+		Expect(first.Status.Phase).To(Equal(deploymentv1.PhaseSucceeded))
+		Expect(first.Status.EndTime).NotTo(BeNil())
+
+		second := getDeployment(2)
+		Expect(second.Spec.CommitId).To(Equal(c2))
+		Expect(second.Status.Phase).To(Equal(deploymentv1.PhaseFailed))
+		Expect(second.Status.Message).To(ContainSubstring("build failed"))
+
+		log, _, err := deployLogs.Read(nn.Name, 1, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(log)).To(ContainSubstring("service web: created"))
+		Expect(string(log)).To(ContainSubstring("deployment succeeded"))
+
+		log, _, err = deployLogs.Read(nn.Name, 2, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(log)).To(ContainSubstring("deployment failed: build failed"))
+	})
+
+	It("should run compose down for deleted projects", func() {
+		createProject(commit())
+		Eventually(runningContainers).Should(Equal(2))
+
+		Expect(api.Delete(projectv1.VersionKind, nn)).To(Succeed())
+
+		Eventually(func() int { return len(backend.Calls("Down", nn.Name)) }).Should(Equal(1))
+		Expect(backend.Containers(nn.Name)).To(BeEmpty())
+	})
+
+	It("should restart crashed containers", func() {
+		createProject(commit())
+		Eventually(runningContainers).Should(Equal(2))
+		crashed := backend.Containers(nn.Name)[0].ID
+
+		backend.Kill(crashed)
+
+		Eventually(runningContainers).Should(Equal(2))
+		// the container is restarted, not recreated
+		Expect(backend.Containers(nn.Name)[0].ID).To(Equal(crashed))
+	})
+
+	It("should recreate removed containers", func() {
+		createProject(commit())
+		Eventually(runningContainers).Should(Equal(2))
+		calls := len(backend.Calls("Up", nn.Name))
+
+		backend.Remove(backend.Containers(nn.Name)[0].ID)
+
+		Eventually(func() int { return len(backend.Calls("Up", nn.Name)) }).Should(BeNumerically(">", calls))
+		Eventually(runningContainers).Should(Equal(2))
+	})
+
+	It("should bring up stopped containers again", func() {
+		createProject(commit())
+		Eventually(runningContainers).Should(Equal(2))
+
+		backend.Stop(backend.Containers(nn.Name)[1].ID)
+
+		Eventually(runningContainers).Should(Equal(2))
+	})
+
+	It("should report compose failures and recover on the next commit", func() {
+		backend.SetError("Up", nn.Name, errors.New("pull access denied"))
+		createProject(commit())
+
+		Eventually(hasCondition(projectv1.ConditionFailure)).Should(BeTrue())
+		p := getProject()
+		Expect(p.Status.Conditions[projectv1.ConditionFailure].Message).To(ContainSubstring("pull access denied"))
+		Expect(p.Status.Conditions).NotTo(HaveKey(projectv1.ConditionSuccess))
+		Expect(p.IsReady()).To(BeFalse())
+
+		backend.SetError("Up", nn.Name, nil)
+		updateCommit(commit())
+
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		Expect(getProject().Status.Conditions).NotTo(HaveKey(projectv1.ConditionFailure))
+	})
+
+	It("should report invalid compose files", func() {
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    ports: "not a list"
+`), 0644)).To(Succeed())
+		backend.SetError("Up", nn.Name, errors.New("invalid compose file"))
+		createProject(commit())
+
+		Eventually(hasCondition(projectv1.ConditionSchema)).Should(BeTrue())
+	})
+
+	It("should pass the compose files and profiles of the spec to the engine", func() {
+		Expect(os.WriteFile(filepath.Join(composeDir, "override.yml"), []byte(`
+services:
+  web:
+    image: nginx:1.24
+`), 0644)).To(Succeed())
+		commitId := commit()
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commitId,
+				ComposePath: ".",
+				Compose: &composev1.Config{
+					Files:    []string{"docker-compose.yml", "override.yml"},
+					Profiles: []string{"debug"},
+				},
+			},
+		})).To(Succeed())
+
+		Eventually(runningContainers).Should(Equal(2))
+		up := backend.Calls("Up", nn.Name)[0]
+		repoDir := filepath.Join(exportDir, nn.Name, commitId)
+		Expect(up.ConfigFiles).To(Equal([]string{filepath.Join(repoDir, "docker-compose.yml"), filepath.Join(repoDir, "override.yml")}))
+		Expect(up.Profiles).To(Equal([]string{"debug"}))
+		Expect(backend.Containers(nn.Name)[1].Image).To(Equal("nginx:1.24"))
+	})
+
+	It("should refuse compose files outside of the repository", func() {
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commit(),
+				ComposePath: ".",
+				Compose:     &composev1.Config{Files: []string{"../../etc/compose.yml"}},
+			},
+		})).To(Succeed())
+
+		Eventually(hasCondition(projectv1.ConditionSchema)).Should(BeTrue())
+		Expect(backend.Calls("Up", nn.Name)).To(BeEmpty())
+	})
+
+	It("should render templates and redeploy if a used secret changes", func() {
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:{{ .Values.tag }}
+    environment:
+      PROJECT: {{ .Project }}
+      PASSWORD: {{ secret "db" "password" | quote }}
+`), 0644)).To(Succeed())
+		secret := &secretv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: secretv1.Namespace},
+			Spec:       &secretv1.Spec{Data: map[string]string{"password": "s3cret"}},
+		}
+		Expect(api.Create(secret)).To(Succeed())
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commit(),
+				ComposePath: ".",
+				Compose:     &composev1.Config{Template: true, Values: map[string]interface{}{"tag": "1.24"}},
+			},
+		})).To(Succeed())
+
+		Eventually(runningContainers).Should(Equal(1))
+		Expect(backend.Containers(nn.Name)[0].Image).To(Equal("nginx:1.24"))
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		calls := len(backend.Calls("Up", nn.Name))
+
+		// unchanged secrets don't cause a deployment
+		Expect(api.Update(getProject())).To(Succeed())
+		Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, "200ms").Should(Equal(calls))
+
+		Expect(api.Get(metav1.NamespaceName{Name: "db", Namespace: secretv1.Namespace}, secret)).To(Succeed())
+		secret.Spec.Data["password"] = "changed"
+		Expect(api.Update(secret)).To(Succeed())
+		Expect(api.Update(getProject())).To(Succeed())
+
+		Eventually(func() int { return len(backend.Calls("Up", nn.Name)) }).Should(Equal(calls + 1))
+	})
+
+	It("should redeploy with the images pinned by the image update", func() {
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commit(),
+				ComposePath: ".",
+				Compose:     &composev1.Config{Images: map[string]composev1.ImagePolicy{"web": {Semver: "^1.23"}}},
+			},
+		})).To(Succeed())
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+
+		p := getProject()
+		p.Status.Images = map[string]string{"web": "nginx:1.25.1@sha256:abc"}
+		Expect(api.Update(p)).To(Succeed())
+
+		Eventually(func() []string {
+			images := make([]string, 0)
+			for _, c := range backend.Containers(nn.Name) {
+				images = append(images, c.Image)
+			}
+			return images
+		}).Should(ConsistOf("nginx:1.25.1@sha256:abc", "postgres:15"))
+	})
+
+	It("should abort the deployment if a pre deploy hook fails", func() {
+		Expect(os.WriteFile(filepath.Join(composeDir, project.ProjectConfigFile), []byte(`
+hooks:
+  preDeploy:
+    - name: migrate
+      image: migrate:latest
+      command: ["up"]
+`), 0644)).To(Succeed())
+		backend.SetError("RunImage", "migrate:latest", errors.New("exit code 1"))
+		createProject(commit())
+
+		Eventually(hasCondition(projectv1.ConditionHook)).Should(BeTrue())
+		Expect(backend.Calls("Up", nn.Name)).To(BeEmpty())
+	})
+
+	It("should refuse commits which are not signed by a trusted key", func() {
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    commit(),
+				ComposePath: ".",
+				Verify:      &signaturev1.Policy{SSHKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGnoYrn5ThyvDZbeb5yqY3nA3NXn7vtRzi6NnUHWiCVj alice"}},
+			},
+		})).To(Succeed())
+
+		Eventually(hasCondition(projectv1.ConditionUnverified)).Should(BeTrue())
+		Expect(getProject().Status.Conditions[projectv1.ConditionUnverified].Message).To(ContainSubstring("commit is not signed"))
+		Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(BeZero())
+	})
+
+	It("should keep the verified commit running if an unsigned commit is pushed", func() {
+		entity, err := openpgp.NewEntity("alice", "", "alice@example.com", nil)
+		Expect(err).NotTo(HaveOccurred())
+		buf := &bytes.Buffer{}
+		w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entity.Serialize(w)).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		Expect(worktree.AddWithOptions(&git.AddOptions{All: true})).To(Succeed())
+		hash, err := worktree.Commit("signed", &git.CommitOptions{
+			Author:  &object.Signature{Name: "alice", Email: "alice@example.com", When: time.Now()},
+			SignKey: entity,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		signed := hash.String()
+
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   composeDir,
+				CommitId:    signed,
+				ComposePath: ".",
+				Verify:      &signaturev1.Policy{OpenPGPKeys: []string{buf.String()}},
+			},
+		})).To(Succeed())
+		Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		ups := len(backend.Calls("Up", nn.Name))
+
+		// the puller checks out the pushed commit before it is verified
+		Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: evil:latest
+`), 0644)).To(Succeed())
+		unsigned := commit()
+		updateCommit(unsigned)
+
+		Eventually(hasCondition(projectv1.ConditionUnverified)).Should(BeTrue())
+		Expect(getProject().Status.LastAppliedCommitId).To(Equal(signed))
+		Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(Equal(ups))
+		Expect(runningContainers()).To(Equal(2))
+		for _, c := range backend.Containers(nn.Name) {
+			Expect(c.Image).NotTo(Equal("evil:latest"))
+		}
+		// the containers bind mount the files of the verified commit, not the ones of the work tree
+		calls := backend.Calls("Up", nn.Name)
+		Expect(calls[len(calls)-1].WorkingDir).To(Equal(filepath.Join(exportDir, nn.Name, signed)))
+		Expect(filepath.Join(exportDir, nn.Name, unsigned)).NotTo(BeAnExistingFile())
+		Expect(os.ReadFile(filepath.Join(exportDir, nn.Name, signed, "docker-compose.yml"))).To(Equal([]byte(composeFile)))
+	})
+
+	Context("with dependencies", func() {
+		dbNN := metav1.NamespaceName{Name: "db", Namespace: "project-db"}
+
+		createDependent := func(name metav1.NamespaceName, commitId string, dependsOn ...string) {
+			Expect(api.Create(&projectv1.Project{
+				ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+				Spec: &projectv1.Spec{
+					LocalPath:   composeDir,
+					CommitId:    commitId,
+					ComposePath: ".",
+					DependsOn:   dependsOn,
+				},
+			})).To(Succeed())
+		}
+
+		getDB := func() *projectv1.Project {
+			p := &projectv1.Project{}
+			Expect(api.Get(dbNN, p)).To(Succeed())
+			return p
+		}
+
+		It("should wait until the dependencies are ready", func() {
+			backend.SetError("Up", dbNN.Name, errors.New("pull access denied"))
+			createDependent(dbNN, commit())
+			Eventually(func() bool { return getDB().Status != nil }).Should(BeTrue())
+
+			createDependent(nn, commit(), dbNN.Name)
+
+			Eventually(hasCondition(projectv1.ConditionDependency)).Should(BeTrue())
+			Expect(getProject().Status.BlockedBy).To(Equal([]string{dbNN.Name}))
+			Expect(getProject().Status.Conditions[projectv1.ConditionDependency].Message).To(Equal("waiting for db"))
+			Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(BeZero())
+
+			backend.SetError("Up", dbNN.Name, nil)
+			c2 := commit()
+			Eventually(func() error {
+				db := getDB()
+				db.Spec.CommitId = c2
+				return api.Update(db)
+			}).Should(Succeed())
+
+			Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+			p := getProject()
+			Expect(p.Status.BlockedBy).To(BeEmpty())
+			Expect(p.Status.Conditions).NotTo(HaveKey(projectv1.ConditionDependency))
+			Expect(runningContainers()).To(Equal(2))
+		})
+
+		It("should block missing dependencies", func() {
+			createDependent(nn, commit(), "missing")
+
+			Eventually(hasCondition(projectv1.ConditionDependency)).Should(BeTrue())
+			Expect(getProject().Status.BlockedBy).To(Equal([]string{"missing"}))
+			Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(BeZero())
+		})
+
+		It("should refuse to deploy a dependency cycle", func() {
+			createDependent(dbNN, commit(), nn.Name)
+			createDependent(nn, commit(), dbNN.Name)
+
+			Eventually(hasCondition(projectv1.ConditionDependencyCycle)).Should(BeTrue())
+			Expect(getProject().Status.Conditions[projectv1.ConditionDependencyCycle].Message).To(Equal("dependency cycle: app -> db -> app"))
+			Consistently(func() int {
+				return len(backend.Calls("Up", nn.Name)) + len(backend.Calls("Up", dbNN.Name))
+			}, 200*time.Millisecond).Should(BeZero())
+		})
+	})
+
+	Context("with a rollback hook", func() {
+		var first string
+
+		commitFiles := func(files map[string]string) string {
+			for name, content := range files {
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(composeDir, name)), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(composeDir, name), []byte(content), 0644)).To(Succeed())
+			}
+			return commit()
+		}
+
+		reasons := func() []string {
+			list, err := api.List(eventv1.VersionKind, store.InNamespace(nn.Namespace), store.WithNamePrefix(nn.Name+"."))
+			Expect(err).NotTo(HaveOccurred())
+
+			reasons := make([]string, 0, len(list))
+			for _, el := range list {
+				reasons = append(reasons, el.(*eventv1.Event).Reason)
+			}
+			return reasons
+		}
+
+		images := func() []string {
+			images := make([]string, 0)
+			for _, c := range backend.Containers(nn.Name) {
+				images = append(images, c.Image)
+			}
+			return images
+		}
+
+		BeforeEach(func() {
+			first = commitFiles(map[string]string{"docker-compose.yml": composeFile, "config/nginx.conf": "worker_processes 1;\n"})
+			createProject(first)
+			Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+
+			backend.SetError("RunImage", "smoke:latest", errors.New("exit code 1"))
+			updateCommit(commitFiles(map[string]string{
+				"docker-compose.yml": "services:\n  web:\n    image: nginx:1.24\n",
+				project.ProjectConfigFile: `
+hooks:
+  postDeploy:
+    - name: smoke
+      image: smoke:latest
+      failurePolicy: rollback
+`,
+			}))
+		})
+
+		It("should deploy the previous commit again if a hook fails", func() {
+			Eventually(func() string { return getProject().Status.RolledBackCommitId }).ShouldNot(BeEmpty())
+
+			p := getProject()
+			Expect(p.Status.LastAppliedCommitId).To(Equal(first))
+			Expect(p.Status.Conditions[projectv1.ConditionFailure].Message).To(ContainSubstring("rolled back to " + first))
+			Eventually(images).Should(ConsistOf("nginx:1.23", "postgres:15"))
+			Expect(reasons()).To(ContainElements("PostDeployHookFailed", "RolledBack"))
+
+			// the rolled back commit is not deployed again by the next reconciliation
+			ups := len(backend.Calls("Up", nn.Name))
+			Eventually(func() error { return api.Update(getProject()) }).Should(Succeed())
+			Consistently(func() int { return len(backend.Calls("Up", nn.Name)) }, 200*time.Millisecond).Should(Equal(ups))
+		})
+
+		It("should keep the exported commit while it is deployed", func() {
+			Eventually(func() string { return getProject().Status.RolledBackCommitId }).ShouldNot(BeEmpty())
+
+			ups := backend.Calls("Up", nn.Name)
+			rollbackDir := filepath.Join(exportDir, nn.Name, first)
+			Expect(ups[len(ups)-1].WorkingDir).To(Equal(rollbackDir))
+			Expect(filepath.Join(rollbackDir, "config", "nginx.conf")).To(BeARegularFile())
+			Expect(filepath.Join(rollbackDir, project.ProjectConfigFile)).NotTo(BeAnExistingFile())
+
+			backend.SetError("RunImage", "smoke:latest", nil)
+			updateCommit(commitFiles(map[string]string{"docker-compose.yml": "services:\n  web:\n    image: nginx:1.25\n"}))
+
+			Eventually(images).Should(ConsistOf("nginx:1.25"))
+			Eventually(func() string { return rollbackDir }).ShouldNot(BeAnExistingFile())
+		})
+	})
+
+	Context("with a snapshot policy", func() {
+		var first string
+
+		BeforeEach(func() {
+			Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  db:
+    image: postgres:15
+    volumes:
+      - data:/var/lib/postgresql/data
+volumes:
+  data:
+`), 0644)).To(Succeed())
+
+			first = commit()
+			Expect(api.Create(&projectv1.Project{
+				ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+				Spec: &projectv1.Spec{
+					LocalPath:   composeDir,
+					CommitId:    first,
+					ComposePath: ".",
+					Snapshots:   &snapshotv1.Policy{Keep: 2},
+				},
+			})).To(Succeed())
+			Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		})
+
+		snapshots := func() []*snapshotv1.Snapshot {
+			list, err := project.ListSnapshots(api, nn.Name)
+			Expect(err).NotTo(HaveOccurred())
+			return list
+		}
+
+		It("should archive the volumes before a new commit gets deployed", func() {
+			Expect(backend.Calls("RunHelper", "busybox")).To(BeEmpty())
+
+			second := commit()
+			updateCommit(second)
+			Eventually(func() string { return getProject().Status.LastAppliedCommitId }).Should(Equal(second))
+
+			Expect(snapshots()).To(HaveLen(1))
+			s := snapshots()[0]
+			Expect(s.Spec.CommitId).To(Equal(first))
+			Expect(s.Spec.Volumes).To(ConsistOf(snapshotv1.Volume{Name: "app_data", File: "app_data.tar.gz"}))
+			Expect(getProject().Status.LastSnapshot).To(Equal(s.Spec.ID))
+
+			calls := backend.Calls("RunHelper", "busybox")
+			Expect(calls).To(HaveLen(1))
+			Expect(calls[0].Binds).To(ContainElement("app_data:/volume:ro"))
+		})
+
+		It("should keep only the configured number of snapshots", func() {
+			commitIds := []string{commit(), commit(), commit()}
+			for _, commitId := range commitIds {
+				updateCommit(commitId)
+				Eventually(func() string { return getProject().Status.LastAppliedCommitId }).Should(Equal(commitId))
+				// snapshot ids have millisecond resolution
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			Expect(snapshots()).To(HaveLen(2))
+			Expect(snapshots()[0].Spec.CommitId).To(Equal(commitIds[0]))
+			Expect(snapshots()[1].Spec.CommitId).To(Equal(commitIds[1]))
+		})
+
+		It("should not deploy if the snapshot fails", func() {
+			backend.SetError("RunHelper", "busybox", errors.New("no space left on device"))
+			ups := len(backend.Calls("Up", nn.Name))
+
+			updateCommit(commit())
+			Eventually(hasCondition(projectv1.ConditionFailure)).Should(BeTrue())
+			Expect(backend.Calls("Up", nn.Name)).To(HaveLen(ups))
+			Expect(snapshots()).To(BeEmpty())
+		})
+
+		It("should stop the project, restore the volumes and redeploy on request", func() {
+			second := commit()
+			updateCommit(second)
+			Eventually(snapshots).Should(HaveLen(1))
+			Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+			id := snapshots()[0].Spec.ID
+			ups := len(backend.Calls("Up", nn.Name))
+
+			p := getProject()
+			p.Spec.RestoreSnapshot = id
+			Expect(api.Update(p)).To(Succeed())
+
+			Eventually(func() int { return len(backend.Calls("Up", nn.Name)) }).Should(Equal(ups + 1))
+			Eventually(func() string { return getProject().Spec.RestoreSnapshot }).Should(BeEmpty())
+			Expect(backend.Calls("Down", nn.Name)).To(HaveLen(1))
+
+			calls := backend.Calls("RunHelper", "busybox")
+			Expect(calls).To(HaveLen(2))
+			Expect(calls[1].Binds).To(ContainElement("app_data:/volume"))
+			Eventually(func() string { return getProject().Status.LastAppliedCommitId }).Should(Equal(second))
+			Eventually(runningContainers).Should(Equal(1))
+		})
+	})
+
+	Context("with the blue/green strategy", func() {
+		BeforeEach(func() {
+			Expect(api.Create(&projectv1.Project{
+				ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+				Spec: &projectv1.Spec{
+					LocalPath:   composeDir,
+					CommitId:    commit(),
+					ComposePath: ".",
+					Compose: &composev1.Config{
+						Strategy:  composev1.StrategyBlueGreen,
+						BlueGreen: &composev1.BlueGreen{Aliases: map[string]string{"web": "app"}},
+					},
+				},
+			})).To(Succeed())
+			Eventually(hasCondition(projectv1.ConditionSuccess)).Should(BeTrue())
+		})
+
+		aliases := func() []string {
+			list := make([]string, 0)
+			for _, containerAliases := range backend.NetworkAliases(composev1.DefaultNetwork) {
+				list = append(list, containerAliases...)
+			}
+			return list
+		}
+
+		It("should bring up the first set and register the aliases", func() {
+			Expect(getProject().Status.ActiveColor).To(Equal("blue"))
+			Expect(backend.Containers("app-blue")).To(HaveLen(2))
+			Expect(backend.Containers(nn.Name)).To(BeEmpty())
+			Expect(aliases()).To(ConsistOf("app", "db.app"))
+		})
+
+		It("should switch to the other set and tear down the old one", func() {
+			updateCommit(commit())
+
+			Eventually(func() string { return getProject().Status.ActiveColor }).Should(Equal("green"))
+			Expect(backend.Containers("app-green")).To(HaveLen(2))
+			Expect(backend.Containers("app-blue")).To(BeEmpty())
+			Expect(aliases()).To(ConsistOf("app", "db.app"))
+
+			Consistently(func() int { return len(backend.Calls("Up", "app-blue")) }, 200*time.Millisecond).Should(Equal(1))
+		})
+
+		It("should keep the old set if the new one doesn't become healthy", func() {
+			blue := backend.Containers("app-blue")
+			backend.SetHealth("app-green", compose.HealthUnhealthy)
+			updateCommit(commit())
+
+			Eventually(hasCondition(projectv1.ConditionFailure)).Should(BeTrue())
+			Expect(getProject().Status.ActiveColor).To(Equal("blue"))
+			Expect(backend.Containers("app-blue")).To(Equal(blue))
+			Expect(backend.Containers("app-green")).To(BeEmpty())
+			Expect(aliases()).To(ConsistOf("app", "db.app"))
+		})
+
+		It("should refuse services with published ports", func() {
+			Expect(os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: nginx:1.24
+    ports:
+      - "8080:80"
+`), 0644)).To(Succeed())
+			updateCommit(commit())
+
+			Eventually(hasCondition(projectv1.ConditionFailure)).Should(BeTrue())
+			Expect(backend.Calls("Up", "app-green")).To(BeEmpty())
+			Expect(backend.Containers("app-blue")).To(HaveLen(2))
+		})
+	})
+})
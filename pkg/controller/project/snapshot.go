@@ -0,0 +1,248 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// takeSnapshot archives the volumes selected by the snapshot policy of the project while commitId is deployed
+func (c *Controller) takeSnapshot(ctx context.Context, project *projectv1.Project, commitId string, out io.Writer) error {
+	policy := project.Spec.Snapshots
+	if policy == nil || c.snapshots == nil {
+		return nil
+	}
+
+	volumes, err := c.runtime.ListVolumes(ctx, ComposeProjectName(project))
+	if err != nil {
+		return errors.WithMessage(err, "failed to list volumes")
+	}
+
+	if len(policy.Volumes) > 0 {
+		if volumes, err = c.selectVolumes(project, commitId, policy.Volumes, volumes); err != nil {
+			return err
+		}
+	}
+
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	id := snapshotv1.MakeID(time.Now())
+	_, _ = fmt.Fprintf(out, "taking snapshot %s of volumes %s\n", id, strings.Join(volumes, ", "))
+
+	archives, err := c.snapshots.Create(ctx, project.Name, id, volumes)
+	if err != nil {
+		return errors.WithMessage(err, "failed to take snapshot")
+	}
+
+	snapshot := &snapshotv1.Snapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      snapshotv1.MakeName(project.Name, id),
+			Namespace: project.Namespace,
+		},
+		Spec: &snapshotv1.Spec{
+			Project: metav1.ObjectRef{
+				Version:   projectv1.VersionKind.Version,
+				Kind:      projectv1.VersionKind.Kind,
+				Namespace: project.Namespace,
+				Name:      project.Name,
+			},
+			ID:        id,
+			CommitId:  commitId,
+			Volumes:   archives,
+			CreatedAt: time.Now(),
+		},
+	}
+	if err := c.api.Create(snapshot); err != nil {
+		_ = c.snapshots.Remove(project.Name, id)
+		return errors.WithMessage(err, "failed to record snapshot")
+	}
+
+	project.Status.LastSnapshot = id
+	c.recorder.Record(project, "SnapshotCreated", fmt.Sprintf("archived volumes %s of commit %s as snapshot %s", strings.Join(volumes, ", "), commitId, id))
+	c.pruneSnapshots(project, policy.GetKeep())
+	return nil
+}
+
+// restoreOnRollback tells whether the last snapshot has been taken of commitId and should be restored when rolling back to it
+func (c *Controller) restoreOnRollback(project *projectv1.Project, commitId string) bool {
+	if project.Spec.Snapshots == nil || !project.Spec.Snapshots.RestoreOnRollback || project.Status.LastSnapshot == "" {
+		return false
+	}
+
+	snapshot := &snapshotv1.Snapshot{}
+	if err := c.api.Get(metav1.NamespaceName{
+		Name:      snapshotv1.MakeName(project.Name, project.Status.LastSnapshot),
+		Namespace: project.Namespace,
+	}, snapshot); err != nil {
+		return false
+	}
+
+	return snapshot.Spec != nil && snapshot.Spec.CommitId == commitId
+}
+
+// selectVolumes returns the names of the existing volumes which the compose project of the exported commit defines
+// with the given keys
+func (c *Controller) selectVolumes(project *projectv1.Project, commitId string, keys, existing []string) ([]string, error) {
+	opts, err := ComposeOptions(c.api, project, c.exportPath(project.Name, commitId), commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	composeProject, err := compose.LoadProject(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	volumes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		config, ok := composeProject.Volumes[key]
+		if !ok {
+			return nil, fmt.Errorf("volume %s of the snapshot policy is not defined in the compose project", key)
+		}
+
+		if exists[config.Name] {
+			volumes = append(volumes, config.Name)
+		}
+	}
+
+	return volumes, nil
+}
+
+// restoreSnapshot stops the project and replaces the content of its volumes by the archives of the snapshot
+func (c *Controller) restoreSnapshot(ctx context.Context, project *projectv1.Project, id string, out io.Writer) error {
+	if c.snapshots == nil {
+		return errors.New("snapshots are not configured")
+	}
+
+	snapshot := &snapshotv1.Snapshot{}
+	if err := c.api.Get(metav1.NamespaceName{
+		Name:      snapshotv1.MakeName(project.Name, id),
+		Namespace: project.Namespace,
+	}, snapshot); err != nil {
+		return errors.WithMessagef(err, "failed to get snapshot %s", id)
+	}
+
+	_, _ = fmt.Fprintf(out, "stopping project to restore snapshot %s\n", id)
+
+	// the project must be stopped anyway, even if the compose files of the deployed commit are broken
+	opts, err := c.deployedComposeOptions(project)
+	if err != nil {
+		opts = compose.Options{ProjectName: project.Name}
+	}
+
+	if err := c.engine.Down(ctx, opts); err != nil {
+		return errors.WithMessage(err, "failed to stop project")
+	}
+
+	if err := c.snapshots.Restore(ctx, project.Name, id, snapshot.Spec.Volumes); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(out, "restored volumes of snapshot %s\n", id)
+	c.recorder.Record(project, "SnapshotRestored", fmt.Sprintf("restored volumes of snapshot %s taken at commit %s", id, snapshot.Spec.CommitId))
+	return nil
+}
+
+// handleRestoreRequest restores the snapshot requested by Spec.RestoreSnapshot and redeploys the last applied commit
+func (c *Controller) handleRestoreRequest(ctx context.Context, project *projectv1.Project) error {
+	id := project.Spec.RestoreSnapshot
+
+	// reset the request first, so that a failed update afterwards doesn't restore the snapshot again
+	project.Spec.RestoreSnapshot = ""
+	if err := c.api.Update(project); err != nil {
+		return err
+	}
+
+	commitId := project.Status.LastAppliedCommitId
+	if commitId == "" {
+		commitId = project.Spec.CommitId
+	}
+
+	deployment, out := c.startDeployment(project, commitId)
+	_, _ = fmt.Fprintf(out, "restoring snapshot %s\n", id)
+
+	project.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
+
+	var result *compose.Result
+	err := c.restoreSnapshot(ctx, project, id, out)
+	if err == nil {
+		result, err = c.deploy(ctx, project, commitId, false, out)
+	}
+
+	if err != nil {
+		project.Status.Conditions[projectv1.ConditionFailure] = makeCondition("failure", fmt.Sprintf("failed to restore snapshot %s: %s", id, err.Error()))
+		c.recorder.Record(project, "RestoreFailed", err.Error())
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to restore snapshot")
+	} else {
+		project.Status.Conditions[projectv1.ConditionSuccess] = makeCondition("success", fmt.Sprintf("restored snapshot %s", id))
+		project.Status.LastAppliedCommitId = commitId
+		project.Status.ContainerCount = result.ContainerCount()
+	}
+
+	c.finishDeployment(deployment, out, err)
+
+	if err := c.api.Update(project); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// pruneSnapshots removes the oldest snapshots of the project so that keep remain
+func (c *Controller) pruneSnapshots(project *projectv1.Project, keep int) {
+	snapshots, err := ListSnapshots(c.api, project.Name)
+	if err != nil {
+		logrus.WithError(err).WithField("project", project.Name).Warn("failed to list snapshots")
+		return
+	}
+
+	for i := 0; i < len(snapshots)-keep; i++ {
+		if err := c.snapshots.Remove(project.Name, snapshots[i].Spec.ID); err != nil {
+			logrus.WithError(err).WithField("snapshot", snapshots[i].Name).Warn("failed to remove snapshot")
+			continue
+		}
+		_ = c.api.Delete(snapshotv1.VersionKind, snapshots[i].GetNamespaceName())
+	}
+}
+
+// ListSnapshots returns the snapshots of the project from the oldest to the newest
+func ListSnapshots(api store.Getter, projectName string) ([]*snapshotv1.Snapshot, error) {
+	list, err := api.List(snapshotv1.VersionKind,
+		store.InNamespace("project-"+projectName),
+		store.WithNamePrefix(projectName+"."))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*snapshotv1.Snapshot, 0, len(list))
+	for _, el := range list {
+		snapshot := el.(*snapshotv1.Snapshot)
+		if snapshot.Spec != nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Spec.CreatedAt.Before(snapshots[j].Spec.CreatedAt)
+	})
+
+	return snapshots, nil
+}
@@ -0,0 +1,48 @@
+package project
+
+import (
+	"fmt"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// verifyCommit refuses to deploy a commit which is not signed by one of the trusted keys of the project and reports
+// whether it got refused; the reason is stored in the conditions of the project in that case
+func (c *Controller) verifyCommit(project *projectv1.Project, commitId string) (bool, error) {
+	if project.Spec.Verify.IsEmpty() {
+		return false, nil
+	}
+
+	signer, err := gitrepo.VerifyCommit(project.Spec.LocalPath, commitId, project.Spec.Verify)
+	if err == nil {
+		c.recorder.Record(project, "CommitVerified", fmt.Sprintf("commit %s is signed by %s", commitId, signer))
+		return false, nil
+	}
+
+	message := fmt.Sprintf("refused to deploy commit %s: %s", commitId, err.Error())
+	c.requests.Finish(project.Spec.ReconcileRequest, commitId, errors.New(message))
+
+	// the update below triggers the next reconciliation, which must not update again
+	if cond, ok := project.Status.Conditions[projectv1.ConditionUnverified]; ok && cond.Message == message && project.Spec.ReconcileRequest == "" {
+		return true, nil
+	}
+
+	logrus.WithError(err).WithField("project", project.Name).WithField("commit", commitId).Warn("refused unverified commit")
+	c.recorder.Record(project, "CommitRefused", message)
+
+	if project.Status.Conditions == nil {
+		project.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
+	}
+	project.Status.Conditions[projectv1.ConditionUnverified] = makeCondition("failure", message)
+	project.Spec.ReconcileRequest = ""
+
+	if err := c.api.Update(project); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return true, err
+	}
+
+	return true, nil
+}
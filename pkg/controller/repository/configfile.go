@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the config file in the root of the config repo
+const ConfigFileName = ".recoon.config.yml"
+
+// versions of the config file
+const (
+	// APIVersionV1 is the default; unknown fields are ignored
+	APIVersionV1 = "recoon/v1"
+	// APIVersionV2 rejects unknown fields and invalid settings
+	APIVersionV2 = "recoon/v2"
+)
+
+// ConfigError is an error at Line of the config file; Line is 0 for errors which concern the whole file
+type ConfigError struct {
+	Line    int
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", ConfigFileName, e.Line, e.Message)
+	}
+
+	return ConfigFileName + ": " + e.Message
+}
+
+// ConfigErrors are all errors of the config file
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+var (
+	yamlLineRegexp     = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	unknownFieldRegexp = regexp.MustCompile(`field (\S+) not found in type \S+`)
+)
+
+// ParseConfig decodes the config file. Manifests with apiVersion recoon/v2 are decoded strictly and validated; the
+// returned error is of type ConfigErrors then.
+func ParseConfig(data []byte) (*ConfigRepoData, error) {
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(data, root); err != nil {
+		return nil, yamlErrors(err)
+	}
+
+	version := &struct {
+		APIVersion string `yaml:"apiVersion"`
+	}{}
+	if err := root.Decode(version); err != nil {
+		return nil, yamlErrors(err)
+	}
+
+	configData := &ConfigRepoData{}
+	switch version.APIVersion {
+	case "", APIVersionV1:
+		if err := yaml.Unmarshal(data, configData); err != nil {
+			return nil, yamlErrors(err)
+		}
+
+		if err := decodeStrict(data, &ConfigRepoData{}); err != nil {
+			logrus.WithError(err).Warnf("ignoring unknown fields, set apiVersion: %s to reject them", APIVersionV2)
+		}
+
+		return configData, nil
+
+	case APIVersionV2:
+		if err := decodeStrict(data, configData); err != nil {
+			return nil, err
+		}
+
+		if errs := validateConfig(configData, root); len(errs) > 0 {
+			return nil, errs
+		}
+
+		return configData, nil
+
+	default:
+		return nil, ConfigErrors{{
+			Line:    valueLine(documentNode(root), "apiVersion"),
+			Message: fmt.Sprintf("unsupported apiVersion %q, use %s", version.APIVersion, APIVersionV2),
+		}}
+	}
+}
+
+// decodeStrict decodes data into v and fails on unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return yamlErrors(err)
+	}
+
+	return nil
+}
+
+// yamlErrors converts the errors of the yaml decoder, which contain the line in their message, to ConfigErrors
+func yamlErrors(err error) ConfigErrors {
+	messages := []string{err.Error()}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	errs := make(ConfigErrors, 0, len(messages))
+	for _, message := range messages {
+		configErr := ConfigError{Message: strings.TrimPrefix(message, "yaml: ")}
+		if match := yamlLineRegexp.FindStringSubmatch(message); match != nil {
+			configErr.Line, _ = strconv.Atoi(match[1])
+			configErr.Message = match[2]
+		}
+		configErr.Message = unknownFieldRegexp.ReplaceAllString(configErr.Message, "unknown field $1")
+
+		errs = append(errs, configErr)
+	}
+
+	return errs
+}
+
+// validateConfig checks the settings which the yaml decoder can't; root is the node of the decoded data
+func validateConfig(configData *ConfigRepoData, root *yaml.Node) ConfigErrors {
+	errs := make(ConfigErrors, 0)
+
+	var repoNodes []*yaml.Node
+	if repos := mappingValue(documentNode(root), "repos"); repos != nil {
+		repoNodes = repos.Content
+	}
+
+	projects := make(map[string]int)
+	for i, repoMeta := range configData.Repos {
+		node := &yaml.Node{}
+		if i < len(repoNodes) {
+			node = repoNodes[i]
+		}
+		fail := func(field, format string, args ...interface{}) {
+			errs = append(errs, ConfigError{Line: valueLine(node, field), Message: fmt.Sprintf(format, args...)})
+		}
+
+		if repoMeta.Name == "" {
+			fail("name", "repo has no name")
+		}
+
+		if repoMeta.URL == "" {
+			fail("url", "repo %s has no url", repoMeta.Name)
+		}
+
+		if repoMeta.Interval != "" {
+			if interval, err := time.ParseDuration(repoMeta.Interval); err != nil || interval <= 0 {
+				fail("interval", "invalid interval %q, use e.g. 5m", repoMeta.Interval)
+			}
+		}
+
+		if repoMeta.Depth < 0 {
+			fail("depth", "depth must not be negative")
+		}
+
+		if ref := repoMeta.Ref; ref != nil {
+			set := 0
+			for _, field := range []string{ref.Tag, ref.Semver, ref.Commit} {
+				if field != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				fail("ref", "ref needs exactly one of tag, semver and commit")
+			}
+		}
+
+		if repoMeta.Credentials != nil && repoMeta.Credentials.Secret == "" {
+			fail("credentials", "credentials have no secret")
+		}
+
+		if repoMeta.Compose != nil {
+			switch repoMeta.Compose.Strategy {
+			case "", composev1.StrategyRecreate, composev1.StrategyBlueGreen:
+			default:
+				fail("compose", "unknown compose strategy %q", repoMeta.Compose.Strategy)
+			}
+		}
+
+		var overlayNodes []*yaml.Node
+		if overlays := mappingValue(node, "overlays"); overlays != nil {
+			overlayNodes = overlays.Content
+		}
+
+		type projectLine struct {
+			name string
+			line int
+		}
+		repoProjects := make([]projectLine, 0, 1)
+		if len(repoMeta.Overlays) == 0 && repoMeta.Name != "" {
+			repoProjects = append(repoProjects, projectLine{name: repoMeta.Name, line: valueLine(node, "name")})
+		}
+		for j, overlay := range repoMeta.Overlays {
+			line := valueLine(node, "overlays")
+			if j < len(overlayNodes) {
+				line = overlayNodes[j].Line
+			}
+
+			if overlay.Name == "" {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("overlay of repo %s has no name", repoMeta.Name)})
+				continue
+			}
+			repoProjects = append(repoProjects, projectLine{name: repoMeta.Name + "-" + overlay.Name, line: line})
+		}
+
+		for _, project := range repoProjects {
+			if previous, ok := projects[project.name]; ok {
+				errs = append(errs, ConfigError{Line: project.line, Message: fmt.Sprintf("project %s is already defined in line %d", project.name, previous)})
+				continue
+			}
+			projects[project.name] = project.line
+		}
+	}
+
+	return errs
+}
+
+// documentNode returns the top level node of a parsed document
+func documentNode(root *yaml.Node) *yaml.Node {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		return root.Content[0]
+	}
+
+	return root
+}
+
+// mappingValue returns the value of the key of a mapping node or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// valueLine returns the line of the value of the key or the line of the node if it has no such key
+func valueLine(node *yaml.Node, key string) int {
+	if value := mappingValue(node, key); value != nil {
+		return value.Line
+	}
+
+	return node.Line
+}
@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"github.com/lacodon/recoon/pkg/controller/repository"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseConfig", func() {
+	It("should ignore unknown fields without apiVersion", func() {
+		config, err := repository.ParseConfig([]byte(`
+repos:
+  - name: app
+    url: git@github.com:LaCodon/app.git
+    unknown: true
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Repos).To(HaveLen(1))
+		Expect(config.Repos[0].Name).To(Equal("app"))
+	})
+
+	It("should decode the per repo settings of v2", func() {
+		config, err := repository.ParseConfig([]byte(`
+apiVersion: recoon/v2
+repos:
+  - name: app
+    url: git@github.com:LaCodon/app.git
+    interval: 5m
+    suspend: true
+    credentials:
+      secret: app-git
+    labels:
+      team: web
+    compose:
+      environment:
+        DOMAIN: example.com
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Repos).To(HaveLen(1))
+		Expect(config.Repos[0].Interval).To(Equal("5m"))
+		Expect(config.Repos[0].Suspend).To(BeTrue())
+		Expect(config.Repos[0].Credentials.Secret).To(Equal("app-git"))
+		Expect(config.Repos[0].Labels).To(Equal(map[string]string{"team": "web"}))
+		Expect(config.Repos[0].Compose.Environment).To(Equal(map[string]string{"DOMAIN": "example.com"}))
+	})
+
+	It("should report unknown fields of v2 with their line", func() {
+		_, err := repository.ParseConfig([]byte(`apiVersion: recoon/v2
+repos:
+  - name: app
+    url: git@github.com:LaCodon/app.git
+    brnach: main
+`))
+		Expect(err).To(MatchError(".recoon.config.yml:5: unknown field brnach"))
+	})
+
+	It("should report all invalid settings of v2 with their line", func() {
+		_, err := repository.ParseConfig([]byte(`apiVersion: recoon/v2
+repos:
+  - name: app
+    url: git@github.com:LaCodon/app.git
+    interval: soon
+  - name: app
+    url: git@github.com:LaCodon/other.git
+    ref:
+      tag: v1.0.0
+      commit: 4f2a9c1
+  - url: git@github.com:LaCodon/third.git
+`))
+		Expect(err).To(MatchError(".recoon.config.yml:5: invalid interval \"soon\", use e.g. 5m; " +
+			".recoon.config.yml:9: ref needs exactly one of tag, semver and commit; " +
+			".recoon.config.yml:6: project app is already defined in line 3; " +
+			".recoon.config.yml:11: repo has no name"))
+	})
+
+	It("should report syntax errors with their line", func() {
+		_, err := repository.ParseConfig([]byte("apiVersion: recoon/v2\nrepos:\n  - name: app\n   url: x\n"))
+		Expect(err).To(MatchError(MatchRegexp(`^\.recoon\.config\.yml:\d+: `)))
+	})
+
+	It("should reject unknown versions", func() {
+		_, err := repository.ParseConfig([]byte("apiVersion: recoon/v3\n"))
+		Expect(err).To(MatchError(".recoon.config.yml:1: unsupported apiVersion \"recoon/v3\", use recoon/v2"))
+	})
+
+	It("should accept empty files", func() {
+		config, err := repository.ParseConfig([]byte(""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Repos).To(BeEmpty())
+
+		config, err = repository.ParseConfig([]byte("apiVersion: recoon/v2\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Repos).To(BeEmpty())
+	})
+})
@@ -2,25 +2,240 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	hookv1 "github.com/lacodon/recoon/pkg/api/v1/hook"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
 	"github.com/lacodon/recoon/pkg/gitrepo"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 	"io"
+	"reflect"
+	"time"
 )
 
 type ConfigRepoData struct {
-	Repos []ConfigRepoMeta `yaml:"repos"`
+	// APIVersion is APIVersionV2 for strictly decoded and validated manifests; without it, unknown fields are ignored
+	APIVersion string           `yaml:"apiVersion"`
+	Repos      []ConfigRepoMeta `yaml:"repos"`
 }
 
 type ConfigRepoMeta struct {
-	Name   string `yaml:"name"`
-	URL    string `yaml:"url"`
-	Branch string `yaml:"branch"`
-	Path   string `yaml:"path"`
+	Name           string                    `yaml:"name"`
+	URL            string                    `yaml:"url"`
+	Branch         string                    `yaml:"branch"`
+	Ref            *repositoryv1.RefSelector `yaml:"ref"`
+	Credentials    *repositoryv1.Credentials `yaml:"credentials"`
+	HostKeys       []string                  `yaml:"hostKeys"`
+	Depth          int                       `yaml:"depth"`
+	SparseCheckout bool                      `yaml:"sparseCheckout"`
+	Path           string                    `yaml:"path"`
+	IncludePaths   []string                  `yaml:"includePaths"`
+	Hooks          *hookv1.Hooks             `yaml:"hooks"`
+	DependsOn      []string                  `yaml:"dependsOn"`
+	Compose        *composev1.Config         `yaml:"compose"`
+	Snapshots      *snapshotv1.Policy        `yaml:"snapshots"`
+	// WebhookSecret references the secret which verifies the push webhooks of the repository
+	WebhookSecret *secretv1.KeyRef `yaml:"webhookSecret"`
+	// Verify lists the keys which are trusted to sign the commits of the repository
+	Verify *signaturev1.Policy `yaml:"verify"`
+	// Values are available as .Values if the compose files are rendered as templates, see compose.template
+	Values map[string]interface{} `yaml:"values"`
+	// Overlays deploy the repository once per environment instead of once as is
+	Overlays []ConfigRepoOverlay `yaml:"overlays"`
+	// Interval overrides appRepo.reconciliationInterval for this repository, e.g. 5m
+	Interval string `yaml:"interval"`
+	// Suspend stops pulling and deploying the repository
+	Suspend bool `yaml:"suspend"`
+	// Labels are added to the containers of the projects
+	Labels map[string]string `yaml:"labels"`
+}
+
+// ConfigRepoOverlay is an environment of a repository which gets its own project named <name>-<overlay name>
+type ConfigRepoOverlay struct {
+	Name string `yaml:"name"`
+	// Patches are relative to the path of the repository and applied after the patches of the repository
+	Patches []string `yaml:"patches"`
+	// Values override the values of the repository with the same key
+	Values map[string]interface{} `yaml:"values"`
+}
+
+// makeRepositories returns the repository objects of the entry; one per overlay or a single one without overlays
+func makeRepositories(repoMeta ConfigRepoMeta) []*repositoryv1.Repository {
+	newRepo := func(projectName, overlay string, compose *composev1.Config, values map[string]interface{}) *repositoryv1.Repository {
+		if len(values) > 0 {
+			if compose == nil {
+				compose = &composev1.Config{}
+			}
+			compose.Values = values
+		}
+		if compose != nil && compose.Values != nil {
+			compose.Values = normalizeValues(compose.Values)
+		}
+
+		suffixes := []string{repoMeta.Path}
+		if overlay != "" {
+			suffixes = append(suffixes, overlay)
+		}
+
+		return &repositoryv1.Repository{
+			TypeMeta: metav1.TypeMeta{
+				Version: repositoryv1.VersionKind.Version,
+				Kind:    repositoryv1.VersionKind.Kind,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      gitrepo.MakeAPIName(repoMeta.URL, repoMeta.Branch, suffixes...),
+				Namespace: "default",
+			},
+			Spec: &repositoryv1.Spec{
+				ProjectName:    projectName,
+				Url:            repoMeta.URL,
+				Branch:         repoMeta.Branch,
+				Ref:            repoMeta.Ref.DeepCopy(),
+				Credentials:    repoMeta.Credentials.DeepCopy(),
+				HostKeys:       repoMeta.HostKeys,
+				Depth:          repoMeta.Depth,
+				SparseCheckout: repoMeta.SparseCheckout,
+				Path:           repoMeta.Path,
+				Overlay:        overlay,
+				IncludePaths:   repoMeta.IncludePaths,
+				Hooks:          repoMeta.Hooks.DeepCopy(),
+				DependsOn:      repoMeta.DependsOn,
+				Compose:        compose,
+				Snapshots:      repoMeta.Snapshots.DeepCopy(),
+				WebhookSecret:  repoMeta.WebhookSecret.DeepCopy(),
+				Verify:         repoMeta.Verify.DeepCopy(),
+				Interval:       repoMeta.Interval,
+				Suspend:        repoMeta.Suspend,
+				Labels:         repoMeta.Labels,
+			},
+		}
+	}
+
+	if len(repoMeta.Overlays) == 0 {
+		return []*repositoryv1.Repository{newRepo(repoMeta.Name, "", repoMeta.Compose.DeepCopy(), repoMeta.Values)}
+	}
+
+	repos := make([]*repositoryv1.Repository, 0, len(repoMeta.Overlays))
+	for _, overlay := range repoMeta.Overlays {
+		if overlay.Name == "" {
+			logrus.WithField("repo", repoMeta.Name).Warn("ignore overlay without name")
+			continue
+		}
+
+		compose := repoMeta.Compose.DeepCopy()
+		if compose == nil {
+			compose = &composev1.Config{}
+		}
+		compose.Patches = append(compose.Patches, overlay.Patches...)
+
+		values := make(map[string]interface{}, len(repoMeta.Values)+len(overlay.Values))
+		for key, value := range repoMeta.Values {
+			values[key] = value
+		}
+		for key, value := range overlay.Values {
+			values[key] = value
+		}
+
+		repos = append(repos, newRepo(repoMeta.Name+"-"+overlay.Name, overlay.Name, compose, values))
+	}
+
+	return repos
+}
+
+// updateMutableSpec copies all fields which are not part of the repository name from newSpec to spec and reports if something changed
+func updateMutableSpec(spec, newSpec *repositoryv1.Spec) bool {
+	changed := false
+
+	if !reflect.DeepEqual(spec.Ref, newSpec.Ref) {
+		spec.Ref = newSpec.Ref.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Credentials, newSpec.Credentials) {
+		spec.Credentials = newSpec.Credentials.DeepCopy()
+		changed = true
+	}
+
+	if spec.Depth != newSpec.Depth || spec.SparseCheckout != newSpec.SparseCheckout {
+		spec.Depth = newSpec.Depth
+		spec.SparseCheckout = newSpec.SparseCheckout
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.HostKeys, newSpec.HostKeys) {
+		spec.HostKeys = newSpec.HostKeys
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.IncludePaths, newSpec.IncludePaths) {
+		spec.IncludePaths = newSpec.IncludePaths
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Hooks, newSpec.Hooks) {
+		spec.Hooks = newSpec.Hooks.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.DependsOn, newSpec.DependsOn) {
+		spec.DependsOn = newSpec.DependsOn
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Compose, newSpec.Compose) {
+		spec.Compose = newSpec.Compose.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Snapshots, newSpec.Snapshots) {
+		spec.Snapshots = newSpec.Snapshots.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.WebhookSecret, newSpec.WebhookSecret) {
+		spec.WebhookSecret = newSpec.WebhookSecret.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Verify, newSpec.Verify) {
+		spec.Verify = newSpec.Verify.DeepCopy()
+		changed = true
+	}
+
+	if spec.Interval != newSpec.Interval || spec.Suspend != newSpec.Suspend {
+		spec.Interval = newSpec.Interval
+		spec.Suspend = newSpec.Suspend
+		changed = true
+	}
+
+	if !reflect.DeepEqual(spec.Labels, newSpec.Labels) {
+		spec.Labels = newSpec.Labels
+		changed = true
+	}
+
+	return changed
+}
+
+// normalizeValues converts the values like a JSON round trip through the store does, so that they compare equal afterwards
+func normalizeValues(values map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return values
+	}
+
+	normalized := make(map[string]interface{})
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return values
+	}
+
+	return normalized
 }
 
 func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event store.Event) error {
@@ -40,7 +255,7 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 	cloneUrl := apiRepo.Spec.Url
 	branchName := apiRepo.Spec.Branch
 
-	repo, err := gitrepo.NewReadOnlyGitRepository(gitrepo.MakeLocalPath(c.localGitDir, cloneUrl, branchName), c.sshKeyDir)
+	repo, err := gitrepo.NewReadOnlyGitRepository(gitrepo.MakeLocalPath(c.localGitDir, cloneUrl, branchName))
 	if err != nil {
 		return errors.WithMessage(err, "failed to initialize config repo")
 	}
@@ -50,9 +265,9 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 		return errors.WithMessage(err, "failed to get filesystem of config repo")
 	}
 
-	file, err := fs.Open(".recoon.config.yml")
+	file, err := fs.Open(ConfigFileName)
 	if err != nil {
-		return errors.WithMessage(err, "failed to open .recoon.config.yml")
+		return c.setConfigCondition(apiRepo, ConfigErrors{{Message: "failed to open: " + err.Error()}})
 	}
 
 	data, err := io.ReadAll(file)
@@ -61,9 +276,14 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 		return err
 	}
 
-	configRepoData := &ConfigRepoData{}
-	if err := yaml.Unmarshal(data, configRepoData); err != nil {
-		return errors.WithMessage(err, "failed to unmarshal .recoon.config.yml")
+	// an invalid config file is kept on the config repo until it gets fixed instead of being retried
+	configRepoData, err := ParseConfig(data)
+	if err != nil {
+		return c.setConfigCondition(apiRepo, err)
+	}
+
+	if err := c.setConfigCondition(apiRepo, nil); err != nil {
+		return err
 	}
 
 	currentRepos, err := c.api.List(repositoryv1.VersionKind, store.InNamespace("default"))
@@ -71,24 +291,12 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 		return errors.WithMessage(err, "failed to list repositories")
 	}
 
+	newRepos := make([]*repositoryv1.Repository, 0, len(configRepoData.Repos))
 	for _, repoMeta := range configRepoData.Repos {
-		newRepo := &repositoryv1.Repository{
-			TypeMeta: metav1.TypeMeta{
-				Version: repositoryv1.VersionKind.Version,
-				Kind:    repositoryv1.VersionKind.Kind,
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      gitrepo.MakeAPIName(repoMeta.URL, repoMeta.Branch, repoMeta.Path),
-				Namespace: "default",
-			},
-			Spec: &repositoryv1.Spec{
-				ProjectName: repoMeta.Name,
-				Url:         repoMeta.URL,
-				Branch:      repoMeta.Branch,
-				Path:        repoMeta.Path,
-			},
-		}
+		newRepos = append(newRepos, makeRepositories(repoMeta)...)
+	}
 
+	for _, newRepo := range newRepos {
 		oldIxd := currentRepos.Index(metav1.NamespaceName{
 			Name:      newRepo.GetName(),
 			Namespace: newRepo.GetNamespace(),
@@ -99,10 +307,16 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 				logrus.WithError(err).Warn("failed to create repo")
 			}
 		} else {
+			oldRepo := currentRepos[oldIxd].(*repositoryv1.Repository)
 			currentRepos = append(currentRepos[:oldIxd], currentRepos[oldIxd+1:]...)
-			// no api update required because if spec changes, name changes as well -> replacement instead of update
-		}
 
+			// url, branch and path are part of the name -> replacement instead of update; other fields may change in place
+			if oldRepo.Spec != nil && updateMutableSpec(oldRepo.Spec, newRepo.Spec) {
+				if err := c.api.Update(oldRepo); err != nil {
+					logrus.WithError(err).Warn("failed to update repo")
+				}
+			}
+		}
 	}
 
 	for _, oldRepo := range currentRepos {
@@ -112,3 +326,38 @@ func (c *Controller) handleConfigRepoChangeEvent(ctx context.Context, event stor
 
 	return nil
 }
+
+// setConfigCondition sets ConditionConfigInvalid on the config repo to the error of its config file or removes it
+func (c *Controller) setConfigCondition(apiRepo *repositoryv1.Repository, configErr error) error {
+	if apiRepo.Status == nil {
+		apiRepo.Status = &repositoryv1.Status{}
+	}
+
+	cond, ok := apiRepo.Status.Conditions[repositoryv1.ConditionConfigInvalid]
+	if configErr == nil {
+		if !ok {
+			return nil
+		}
+		delete(apiRepo.Status.Conditions, repositoryv1.ConditionConfigInvalid)
+	} else {
+		logrus.WithError(configErr).Warn("invalid config repo")
+		if ok && cond.Message == configErr.Error() {
+			return nil
+		}
+
+		if apiRepo.Status.Conditions == nil {
+			apiRepo.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
+		}
+		apiRepo.Status.Conditions[repositoryv1.ConditionConfigInvalid] = conditionv1.Condition{
+			LastTransitionTime: time.Now(),
+			Status:             "invalid",
+			Message:            configErr.Error(),
+		}
+	}
+
+	if err := c.api.Update(apiRepo); err != nil {
+		return errors.WithMessage(err, "failed to update config repo")
+	}
+
+	return nil
+}
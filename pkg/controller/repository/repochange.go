@@ -7,10 +7,13 @@ import (
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/credentials"
 	"github.com/lacodon/recoon/pkg/gitrepo"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"os"
+	"reflect"
 	"strings"
 )
 
@@ -33,11 +36,38 @@ func (c *Controller) handleRepoCreate(ctx context.Context, event store.Event) er
 		return err
 	}
 
-	if apiRepo.Spec == nil {
+	if apiRepo.Spec == nil || apiRepo.Spec.Suspend {
 		return nil
 	}
 
-	repo, err := gitrepo.NewGitRepository(ctx, c.localGitDir, apiRepo.Spec.Url, apiRepo.Spec.Branch, c.sshKeyDir)
+	// the deploy key is published before cloning, since cloning fails until it got added to the git hoster
+	deployKey, err := credentials.EnsureDeployKey(c.api, apiRepo)
+	if err != nil {
+		return errors.WithMessage(err, "failed to ensure deploy key")
+	}
+
+	if apiRepo.Status == nil || apiRepo.Status.DeployKey != deployKey {
+		if apiRepo.Status == nil {
+			apiRepo.Status = &repositoryv1.Status{}
+		}
+		apiRepo.Status.DeployKey = deployKey
+
+		if err := c.api.Update(apiRepo); err != nil {
+			return errors.WithMessage(err, "failed to update app repo")
+		}
+	}
+
+	auth, err := credentials.Auth(c.api, apiRepo)
+	if err != nil {
+		return errors.WithMessage(err, "failed to load credentials of app repo")
+	}
+
+	repo, err := gitrepo.NewGitRepository(ctx, c.localGitDir, apiRepo.Spec.Url, apiRepo.Spec.Branch, c.sshKeyDir,
+		gitrepo.WithRef(apiRepo.Spec.Ref),
+		gitrepo.WithAuth(auth),
+		gitrepo.WithHostKeyCallback(c.knownHosts.HostKeyCallback(apiRepo, apiRepo.Spec.HostKeys)),
+		gitrepo.WithDepth(apiRepo.Spec.Depth),
+		gitrepo.WithSparseCheckout(apiRepo.Spec.GetSparseCheckoutDirectories()))
 	if err != nil {
 		return errors.WithMessage(err, "failed to create app repo")
 	}
@@ -46,15 +76,17 @@ func (c *Controller) handleRepoCreate(ctx context.Context, event store.Event) er
 		return errors.WithMessage(err, "failed to pull app repo")
 	}
 
-	oldCommitId := ""
-	if apiRepo.Status != nil {
-		oldCommitId = apiRepo.Status.CurrentCommitId
-	}
+	_, gaveUp := apiRepo.Status.Conditions[repositoryv1.ConditionRetryExhausted]
+	if apiRepo.Status.CurrentCommitId != repo.GetCurrentCommitId() || gaveUp {
+		conditions := apiRepo.Status.Conditions
+		delete(conditions, repositoryv1.ConditionRetryExhausted)
 
-	if oldCommitId != repo.GetCurrentCommitId() {
 		apiRepo.Status = &repositoryv1.Status{
 			LocalPath:       repo.GetLocalPath(),
 			CurrentCommitId: repo.GetCurrentCommitId(),
+			ResolvedRef:     repo.GetResolvedRef(),
+			DeployKey:       deployKey,
+			Conditions:      conditions,
 		}
 
 		if err := c.api.Update(apiRepo); err != nil {
@@ -71,11 +103,13 @@ func (c *Controller) handleRepoUpdate(ctx context.Context, event store.Event) er
 		return err
 	}
 
-	if apiRepo.Spec == nil {
+	// suspended repositories keep their project as is until they get resumed
+	if apiRepo.Spec == nil || apiRepo.Spec.Suspend {
 		return nil
 	}
 
-	if apiRepo.Status == nil {
+	// not cloned yet, e.g. only the deploy key got published
+	if apiRepo.Status == nil || apiRepo.Status.CurrentCommitId == "" {
 		return c.handleRepoCreate(ctx, event)
 	}
 
@@ -94,6 +128,12 @@ func (c *Controller) handleRepoUpdate(ctx context.Context, event store.Event) er
 					LocalPath:   apiRepo.Status.LocalPath,
 					CommitId:    apiRepo.Status.CurrentCommitId,
 					ComposePath: apiRepo.Spec.Path,
+					Hooks:       apiRepo.Spec.Hooks.DeepCopy(),
+					DependsOn:   apiRepo.Spec.DependsOn,
+					Compose:     apiRepo.Spec.Compose.DeepCopy(),
+					Snapshots:   apiRepo.Spec.Snapshots.DeepCopy(),
+					Verify:      apiRepo.Spec.Verify.DeepCopy(),
+					Labels:      apiRepo.Spec.Labels,
 					Repo: metav1.ObjectRef{
 						Version:   apiRepo.Version,
 						Kind:      apiRepo.Kind,
@@ -102,23 +142,108 @@ func (c *Controller) handleRepoUpdate(ctx context.Context, event store.Event) er
 					},
 				},
 			}
-			return c.api.Create(project)
+			if err := c.api.Create(project); err != nil {
+				return err
+			}
+			return c.clearRetryExhausted(apiRepo)
 		} else {
 			return errors.WithMessage(err, "failed to get project")
 		}
 	}
 
+	changed := false
+
+	// a changed ref selector moves the repository to another local path
+	if project.Spec.LocalPath != apiRepo.Status.LocalPath {
+		project.Spec.LocalPath = apiRepo.Status.LocalPath
+		changed = true
+	}
+
 	if project.Spec.CommitId != apiRepo.Status.CurrentCommitId {
-		project.Spec.CommitId = apiRepo.Status.CurrentCommitId
-		project.Spec.ComposePath = apiRepo.Spec.Path
+		if c.hasRelevantChanges(apiRepo, project.Spec.CommitId) {
+			project.Spec.CommitId = apiRepo.Status.CurrentCommitId
+			project.Spec.ComposePath = apiRepo.Spec.Path
+			changed = true
+		} else {
+			logrus.WithField("project", project.Name).Debug("no changes in include paths, keep project commit")
+		}
+	}
+
+	if !reflect.DeepEqual(project.Spec.Hooks, apiRepo.Spec.Hooks) {
+		project.Spec.Hooks = apiRepo.Spec.Hooks.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(project.Spec.DependsOn, apiRepo.Spec.DependsOn) {
+		project.Spec.DependsOn = apiRepo.Spec.DependsOn
+		changed = true
+	}
+
+	if !reflect.DeepEqual(project.Spec.Compose, apiRepo.Spec.Compose) {
+		project.Spec.Compose = apiRepo.Spec.Compose.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(project.Spec.Snapshots, apiRepo.Spec.Snapshots) {
+		project.Spec.Snapshots = apiRepo.Spec.Snapshots.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(project.Spec.Verify, apiRepo.Spec.Verify) {
+		project.Spec.Verify = apiRepo.Spec.Verify.DeepCopy()
+		changed = true
+	}
+
+	if !reflect.DeepEqual(project.Spec.Labels, apiRepo.Spec.Labels) {
+		project.Spec.Labels = apiRepo.Spec.Labels
+		changed = true
+	}
+
+	if changed {
 		if err := c.api.Update(project); err != nil {
 			return errors.WithMessage(err, "failed to update project")
 		}
 	}
 
+	return c.clearRetryExhausted(apiRepo)
+}
+
+// clearRetryExhausted removes the condition of a repository which has been given up once it got handled successfully
+func (c *Controller) clearRetryExhausted(apiRepo *repositoryv1.Repository) error {
+	if _, ok := apiRepo.Status.Conditions[repositoryv1.ConditionRetryExhausted]; !ok {
+		return nil
+	}
+
+	delete(apiRepo.Status.Conditions, repositoryv1.ConditionRetryExhausted)
+	if err := c.api.Update(apiRepo); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return errors.WithMessage(err, "failed to update app repo")
+	}
+
 	return nil
 }
 
+// hasRelevantChanges checks if the files below the include paths of apiRepo changed since the given commit
+func (c *Controller) hasRelevantChanges(apiRepo *repositoryv1.Repository, sinceCommitId string) bool {
+	if sinceCommitId == "" {
+		return true
+	}
+
+	repo, err := gitrepo.NewReadOnlyGitRepository(apiRepo.Status.LocalPath)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to open app repo for change detection")
+		return true
+	}
+
+	changed, err := repo.HasChanges(sinceCommitId, apiRepo.Status.CurrentCommitId, apiRepo.Spec.GetIncludePaths())
+	if err != nil {
+		// e.g. old commit is gone because of a force push -> better deploy once too often
+		logrus.WithError(err).Warn("failed to diff commits, assume changes")
+		return true
+	}
+
+	return changed
+}
+
 func (c *Controller) handleRepoDelete(event store.Event) error {
 	oldData := event.PreviousObject.(*api.GenericObject).Data
 
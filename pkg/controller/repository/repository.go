@@ -2,33 +2,48 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
 	"github.com/lacodon/recoon/pkg/controller/configrepo"
+	"github.com/lacodon/recoon/pkg/knownhosts"
 	"github.com/lacodon/recoon/pkg/retry"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/lacodon/recoon/pkg/watcher"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type Controller struct {
 	events      <-chan store.Event
 	api         store.GetterSetter
 	retryer     retry.Retryer
+	backoff     *retry.Backoff
 	localGitDir string
 	sshKeyDir   string
+	knownHosts  *knownhosts.KnownHosts
+	// fingerprints holds the spec and commit of every repository when its last event got handled
+	fingerprints map[metav1.NamespaceName]string
 }
 
-func NewController(apiWatcher watcher.Watcher, api store.GetterSetter, localGitDir, sshKeyDir string) *Controller {
+func NewController(apiWatcher watcher.Watcher, api store.GetterSetter, localGitDir, sshKeyDir string, knownHosts *knownhosts.KnownHosts, backoff *retry.Backoff) *Controller {
 	events := apiWatcher.Watch(repositoryv1.VersionKind)
 
-	return &Controller{
-		events:      events,
-		api:         api,
-		retryer:     retry.New(events),
-		localGitDir: localGitDir,
-		sshKeyDir:   sshKeyDir,
+	c := &Controller{
+		events:       events,
+		api:          api,
+		backoff:      backoff,
+		localGitDir:  localGitDir,
+		sshKeyDir:    sshKeyDir,
+		knownHosts:   knownHosts,
+		fingerprints: make(map[metav1.NamespaceName]string),
 	}
+	c.retryer = retry.New(events, backoff, c.handleGiveUp)
+
+	return c
 }
 
 func (c *Controller) Run(ctx context.Context) error {
@@ -52,6 +67,8 @@ func (c *Controller) Run(ctx context.Context) error {
 func (c *Controller) handleEvent(ctx context.Context, event store.Event) error {
 	switch event.ObjectVersionKind {
 	case repositoryv1.VersionKind:
+		c.resetBackoff(event)
+
 		if event.ObjectNamespaceName.Name == configrepo.ConfigRepoName && event.ObjectNamespaceName.Namespace == "recoon-system" {
 			c.retryer.RetryOnError(ctx, event, c.handleConfigRepoChangeEvent)
 			return nil
@@ -83,3 +100,66 @@ func (c *Controller) reconcileEveryRepo(ctx context.Context) error {
 
 	return nil
 }
+
+// resetBackoff forgets the failed attempts of the repository if its spec or commit changed since its last event, so
+// that a repository which has been given up gets retried again
+func (c *Controller) resetBackoff(event store.Event) {
+	if event.Type == store.EventTypeDelete {
+		delete(c.fingerprints, event.ObjectNamespaceName)
+		return
+	}
+
+	apiRepo := &repositoryv1.Repository{}
+	if err := c.api.Get(event.ObjectNamespaceName, apiRepo); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(apiRepo.Spec)
+	if err != nil {
+		return
+	}
+	fingerprint := string(data)
+	if apiRepo.Status != nil {
+		fingerprint += apiRepo.Status.CurrentCommitId
+	}
+
+	if previous, ok := c.fingerprints[event.ObjectNamespaceName]; ok && previous != fingerprint {
+		c.backoff.Forget(event)
+	}
+	c.fingerprints[event.ObjectNamespaceName] = fingerprint
+}
+
+// handleGiveUp marks the repository as permanently failed until it gets reconciled successfully
+func (c *Controller) handleGiveUp(_ context.Context, event store.Event, err error) {
+	if event.Type == store.EventTypeDelete {
+		return
+	}
+
+	apiRepo := &repositoryv1.Repository{}
+	if err := c.api.Get(event.ObjectNamespaceName, apiRepo); err != nil {
+		return
+	}
+
+	if apiRepo.Status == nil {
+		apiRepo.Status = &repositoryv1.Status{}
+	}
+
+	if apiRepo.Status.Conditions == nil {
+		apiRepo.Status.Conditions = make(map[conditionv1.Type]conditionv1.Condition)
+	}
+
+	message := "giving up after too many failed attempts: " + err.Error()
+	if cond, ok := apiRepo.Status.Conditions[repositoryv1.ConditionRetryExhausted]; ok && cond.Message == message {
+		return
+	}
+
+	apiRepo.Status.Conditions[repositoryv1.ConditionRetryExhausted] = conditionv1.Condition{
+		LastTransitionTime: time.Now(),
+		Status:             "failure",
+		Message:            message,
+	}
+
+	if err := c.api.Update(apiRepo); err != nil {
+		logrus.WithError(err).WithField("repo", apiRepo.Name).Warn("failed to record permanent failure")
+	}
+}
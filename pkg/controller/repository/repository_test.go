@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	conditionv1 "github.com/lacodon/recoon/pkg/api/v1/condition"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/controller/repository"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/retry"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/lacodon/recoon/pkg/watcher"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Controller", func() {
+	var (
+		api     *store.DefaultStore
+		backoff *retry.Backoff
+		cancel  context.CancelFunc
+		nn      = metav1.NamespaceName{Name: "app", Namespace: "default"}
+	)
+
+	getRepo := func() *repositoryv1.Repository {
+		r := &repositoryv1.Repository{}
+		Expect(api.Get(nn, r)).To(Succeed())
+		return r
+	}
+
+	conditions := func() conditionv1.Conditions {
+		if status := getRepo().Status; status != nil {
+			return status.Conditions
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		apiWatcher := watcher.NewDefaultWatcher(api.EventsChan())
+		backoff = retry.NewBackoff(5*time.Millisecond, 10*time.Millisecond, 2)
+		controller := repository.NewController(apiWatcher, api, GinkgoT().TempDir(), GinkgoT().TempDir(),
+			knownhosts.New(api, false), backoff)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() { _ = apiWatcher.Run(ctx) }()
+		go func() { _ = controller.Run(ctx) }()
+	})
+
+	AfterEach(func() {
+		cancel()
+		// give the controllers time to stop before the store is closed
+		time.Sleep(20 * time.Millisecond)
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should recover from giving up once the repository got fixed", func() {
+		remoteDir := GinkgoT().TempDir()
+		remote, err := git.PlainInit(remoteDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(remoteDir, "docker-compose.yml"), []byte("services: {}\n"), 0644)).To(Succeed())
+		worktree, err := remote.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("docker-compose.yml")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := worktree.Commit("initial", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(api.Create(&repositoryv1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &repositoryv1.Spec{
+				ProjectName: "app",
+				Url:         filepath.Join(remoteDir, "missing"),
+				Branch:      "master",
+				Path:        ".",
+			},
+		})).To(Succeed())
+
+		Eventually(conditions).Should(HaveKey(repositoryv1.ConditionRetryExhausted))
+		Expect(backoff.States()).To(ConsistOf(HaveField("GaveUp", BeTrue())))
+
+		Eventually(func() error {
+			r := getRepo()
+			r.Status.Conditions["Other"] = conditionv1.Condition{Status: "kept"}
+			r.Spec.Url = remoteDir
+			return api.Update(r)
+		}).Should(Succeed())
+
+		Eventually(func() string { return getRepo().Status.CurrentCommitId }).Should(Equal(hash.String()))
+		Eventually(conditions).ShouldNot(HaveKey(repositoryv1.ConditionRetryExhausted))
+		Expect(conditions()).To(HaveKey(conditionv1.Type("Other")))
+		Expect(backoff.States()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,159 @@
+// Package credentials builds the git authentication of repositories from their credential secrets.
+package credentials
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	"github.com/lacodon/recoon/pkg/sshauth"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Keys of a credential secret
+const (
+	KeySSHPrivateKey = "sshPrivateKey"
+	KeyToken         = "token"
+	KeyUsername      = "username"
+	KeyPassword      = "password"
+)
+
+// defaultUsername is used for SSH urls without user and for tokens; the git hosters ignore it for tokens
+const defaultUsername = "git"
+
+// Auth returns the authentication for the url of the repository or nil if it has no credentials. SSH urls use the
+// sshPrivateKey of the secret, HTTP urls its token or username and password.
+func Auth(api store.Getter, repo *repositoryv1.Repository) (transport.AuthMethod, error) {
+	if repo.Spec == nil || repo.Spec.Credentials == nil || repo.Spec.Credentials.Secret == "" {
+		return nil, nil
+	}
+
+	secret, err := getSecret(api, repo.Spec.Credentials.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := secret.Value(KeyUsername)
+
+	if gitrepo.IsSSHUrl(repo.Spec.Url) {
+		privateKey, ok := secret.Value(KeySSHPrivateKey)
+		if !ok {
+			return nil, errors.Errorf("secret %s has no key %s for SSH url", secret.GetName(), KeySSHPrivateKey)
+		}
+
+		if endpoint, err := transport.NewEndpoint(repo.Spec.Url); err == nil && endpoint.User != "" {
+			username = endpoint.User
+		}
+		if username == "" {
+			username = defaultUsername
+		}
+
+		password, _ := secret.Value(KeyPassword)
+		auth, err := ssh.NewPublicKeys(username, []byte(privateKey), password)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid %s in secret %s", KeySSHPrivateKey, secret.GetName())
+		}
+
+		return auth, nil
+	}
+
+	if token, ok := secret.Value(KeyToken); ok {
+		if username == "" {
+			username = defaultUsername
+		}
+
+		return &http.BasicAuth{Username: username, Password: token}, nil
+	}
+
+	if password, ok := secret.Value(KeyPassword); ok && username != "" {
+		return &http.BasicAuth{Username: username, Password: password}, nil
+	}
+
+	return nil, errors.Errorf("secret %s has neither %s nor %s and %s", secret.GetName(), KeyToken, KeyUsername, KeyPassword)
+}
+
+// EnsureDeployKey generates an SSH deploy key in the credential secret of the repository if it has none yet and
+// returns its public key in authorized_keys format; repositories without GenerateDeployKey return an empty key
+func EnsureDeployKey(api store.GetterSetter, repo *repositoryv1.Repository) (string, error) {
+	if repo.Spec == nil || repo.Spec.Credentials == nil || !repo.Spec.Credentials.GenerateDeployKey {
+		return "", nil
+	}
+
+	name := repo.Spec.Credentials.Secret
+	if name == "" {
+		return "", errors.New("credentials without secret can't store a deploy key")
+	}
+
+	for {
+		secret, err := getSecret(api, name)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return "", err
+		}
+
+		if secret != nil {
+			if privateKey, ok := secret.Value(KeySSHPrivateKey); ok {
+				return publicKey(name, []byte(privateKey))
+			}
+		}
+
+		privateKey, err := sshauth.GenerateDeployKey()
+		if err != nil {
+			return "", errors.WithMessage(err, "failed to generate deploy key")
+		}
+
+		if secret == nil {
+			err = api.Create(&secretv1.Secret{
+				TypeMeta:   metav1.TypeMeta{Version: secretv1.VersionKind.Version, Kind: secretv1.VersionKind.Kind},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: secretv1.Namespace},
+				Spec:       &secretv1.Spec{Data: map[string]string{KeySSHPrivateKey: string(privateKey)}},
+			})
+		} else {
+			if secret.Spec == nil {
+				secret.Spec = &secretv1.Spec{}
+			}
+			if secret.Spec.Data == nil {
+				secret.Spec.Data = make(map[string]string)
+			}
+			secret.Spec.Data[KeySSHPrivateKey] = string(privateKey)
+			err = api.Update(secret)
+		}
+
+		if errors.Is(err, store.ErrObjectChanged) || errors.Is(err, store.ErrAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return "", errors.WithMessagef(err, "failed to store deploy key in secret %s", name)
+		}
+
+		return publicKey(name, privateKey)
+	}
+}
+
+func getSecret(api store.Getter, name string) (*secretv1.Secret, error) {
+	secret := &secretv1.Secret{}
+	if err := api.Get(metav1.NamespaceName{Name: name, Namespace: secretv1.Namespace}, secret); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errors.WithMessagef(err, "secret %s", name)
+		}
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func publicKey(secretName string, privateKey []byte) (string, error) {
+	signer, err := gossh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return "", errors.WithMessagef(err, "invalid %s in secret %s", KeySSHPrivateKey, secretName)
+	}
+
+	authorizedKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(signer.PublicKey())))
+	return authorizedKey + " recoon-" + secretName, nil
+}
@@ -0,0 +1,92 @@
+package credentials_test
+
+import (
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/credentials"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credentials", func() {
+	var api *store.DefaultStore
+
+	repo := func(url string, creds *repositoryv1.Credentials) *repositoryv1.Repository {
+		return &repositoryv1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       &repositoryv1.Spec{Url: url, Branch: "main", Credentials: creds},
+		}
+	}
+
+	createSecret := func(name string, data map[string]string) {
+		Expect(api.Create(&secretv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: secretv1.Namespace},
+			Spec:       &secretv1.Spec{Data: data},
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should not authenticate repositories without credentials", func() {
+		auth, err := credentials.Auth(api, repo("https://github.com/lacodon/app.git", nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(BeNil())
+	})
+
+	It("should use tokens and passwords for HTTPS urls", func() {
+		createSecret("token", map[string]string{credentials.KeyToken: "t0ken"})
+		createSecret("basic", map[string]string{credentials.KeyUsername: "alice", credentials.KeyPassword: "s3cret"})
+
+		auth, err := credentials.Auth(api, repo("https://github.com/lacodon/app.git", &repositoryv1.Credentials{Secret: "token"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(Equal(&http.BasicAuth{Username: "git", Password: "t0ken"}))
+
+		auth, err = credentials.Auth(api, repo("https://github.com/lacodon/app.git", &repositoryv1.Credentials{Secret: "basic"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(Equal(&http.BasicAuth{Username: "alice", Password: "s3cret"}))
+	})
+
+	It("should fail for missing secrets and keys", func() {
+		createSecret("token", map[string]string{credentials.KeyToken: "t0ken"})
+
+		_, err := credentials.Auth(api, repo("https://github.com/lacodon/app.git", &repositoryv1.Credentials{Secret: "missing"}))
+		Expect(err).To(MatchError(store.ErrNotFound))
+
+		_, err = credentials.Auth(api, repo("git@github.com:lacodon/app.git", &repositoryv1.Credentials{Secret: "token"}))
+		Expect(err).To(MatchError(ContainSubstring(credentials.KeySSHPrivateKey)))
+	})
+
+	It("should generate a deploy key once and use it for SSH urls", func() {
+		creds := &repositoryv1.Credentials{Secret: "app-deploy-key", GenerateDeployKey: true}
+
+		publicKey, err := credentials.EnsureDeployKey(api, repo("git@github.com:lacodon/app.git", creds))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(publicKey).To(HavePrefix("ecdsa-sha2-nistp384 "))
+		Expect(publicKey).To(HaveSuffix(" recoon-app-deploy-key"))
+
+		again, err := credentials.EnsureDeployKey(api, repo("git@github.com:lacodon/app.git", creds))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(publicKey))
+
+		auth, err := credentials.Auth(api, repo("git@github.com:lacodon/app.git", creds))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth).To(BeAssignableToTypeOf(&ssh.PublicKeys{}))
+		Expect(auth.(*ssh.PublicKeys).User).To(Equal("git"))
+	})
+})
@@ -0,0 +1,163 @@
+package deploylog
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Store keeps the build and up output of every deployment in a file per revision below dir
+type Store struct {
+	dir string
+	// maxSize is the maximal size of a single log file; further output gets dropped
+	maxSize int64
+	// keep is the number of revisions which are kept per project
+	keep int
+}
+
+func New(dir string, maxSize int64, keep int) *Store {
+	if keep < 1 {
+		keep = 1
+	}
+
+	return &Store{
+		dir:     dir,
+		maxSize: maxSize,
+		keep:    keep,
+	}
+}
+
+// Keep returns the number of revisions which are kept per project
+func (s *Store) Keep() int {
+	return s.keep
+}
+
+// Create creates the log file of the given revision of the project and removes logs which exceed the retention
+func (s *Store) Create(projectName string, revision int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Join(s.dir, projectName), 0750); err != nil {
+		return nil, errors.WithMessage(err, "failed to create log dir")
+	}
+
+	if err := s.RemoveOlderThan(projectName, revision-s.keep+1); err != nil {
+		return nil, errors.WithMessage(err, "failed to rotate logs")
+	}
+
+	file, err := os.OpenFile(s.path(projectName, revision), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to create log file")
+	}
+
+	return &Writer{
+		file:    file,
+		maxSize: s.maxSize,
+	}, nil
+}
+
+// Read returns the log of the given revision starting at offset and the offset of its end
+func (s *Store) Read(projectName string, revision int, offset int64) ([]byte, int64, error) {
+	file, err := os.Open(s.path(projectName, revision))
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	return data, offset + int64(len(data)), nil
+}
+
+// Remove deletes the log of the given revision
+func (s *Store) Remove(projectName string, revision int) error {
+	if err := os.Remove(s.path(projectName, revision)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveOlderThan deletes all logs of the project with a revision lower than the given one
+func (s *Store) RemoveOlderThan(projectName string, revision int) error {
+	entries, err := os.ReadDir(filepath.Join(s.dir, projectName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		rev, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".log"))
+		if err != nil || rev >= revision {
+			continue
+		}
+
+		if err := s.Remove(projectName, rev); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveAll deletes all logs of the project
+func (s *Store) RemoveAll(projectName string) error {
+	return os.RemoveAll(filepath.Join(s.dir, projectName))
+}
+
+func (s *Store) path(projectName string, revision int) string {
+	return filepath.Join(s.dir, projectName, fmt.Sprintf("%d.log", revision))
+}
+
+// Writer appends to a log file until its maximal size is reached; it is safe for concurrent use
+type Writer struct {
+	mu        sync.Mutex
+	file      *os.File
+	written   int64
+	maxSize   int64
+	truncated bool
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.truncated {
+		return len(p), nil
+	}
+
+	if w.maxSize > 0 && w.written+int64(len(p)) > w.maxSize {
+		w.truncated = true
+		n, err := w.file.Write(p[:w.maxSize-w.written])
+		w.written += int64(n)
+		if err != nil {
+			return n, err
+		}
+
+		_, err = w.file.WriteString("\n... log truncated\n")
+		// the caller must not fail just because the log is full
+		return len(p), err
+	}
+
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
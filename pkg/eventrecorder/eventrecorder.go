@@ -0,0 +1,74 @@
+package eventrecorder
+
+import (
+	"fmt"
+	"github.com/lacodon/recoon/pkg/api"
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// MaxEventsPerObject is the number of events which are kept for each involved object
+const MaxEventsPerObject = 50
+
+// MaxMessageLength is the maximal length of an event message; longer messages keep their end
+const MaxMessageLength = 16 * 1024
+
+type Recorder struct {
+	api store.GetterSetter
+}
+
+func New(api store.GetterSetter) *Recorder {
+	return &Recorder{
+		api: api,
+	}
+}
+
+// Record creates a new event for the involved object and removes the oldest events of this object if there are too many
+func (r *Recorder) Record(involved api.Object, reason, message string) {
+	if len(message) > MaxMessageLength {
+		message = "..." + message[len(message)-MaxMessageLength:]
+	}
+
+	now := time.Now()
+	event := &eventv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", involved.GetName(), now.UnixNano()),
+			Namespace: involved.GetNamespace(),
+		},
+		InvolvedObject: metav1.ObjectRef{
+			Version:   involved.GetVersionKind().Version,
+			Kind:      involved.GetVersionKind().Kind,
+			Namespace: involved.GetNamespace(),
+			Name:      involved.GetName(),
+		},
+		Reason:    reason,
+		Message:   message,
+		Timestamp: now,
+	}
+
+	if err := r.api.Create(event); err != nil {
+		logrus.WithError(err).WithField("reason", reason).Warn("failed to record event")
+		return
+	}
+
+	r.prune(involved)
+}
+
+func (r *Recorder) prune(involved api.Object) {
+	list, err := r.api.List(eventv1.VersionKind, store.InNamespace(involved.GetNamespace()), store.WithNamePrefix(involved.GetName()+"."))
+	if err != nil || len(list) <= MaxEventsPerObject {
+		return
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].(*eventv1.Event).Timestamp.Before(list[j].(*eventv1.Event).Timestamp)
+	})
+
+	for _, event := range list[:len(list)-MaxEventsPerObject] {
+		_ = r.api.Delete(eventv1.VersionKind, event.GetNamespaceName())
+	}
+}
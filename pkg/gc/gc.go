@@ -0,0 +1,410 @@
+// Package gc removes images, build cache and stopped containers which are no longer referenced by any project.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	dockertypes "github.com/docker/docker/api/types"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kinds of removed items
+const (
+	KindImage      = "image"
+	KindContainer  = "container"
+	KindBuildCache = "buildcache"
+)
+
+type Options struct {
+	// KeepImages is the number of images which are kept per repository used by a project, including the ones in use
+	KeepImages int
+	// HighWaterMark is the disk usage of images, containers and build cache in bytes above which only images in
+	// use are kept and all unused build cache is removed; zero disables it
+	HighWaterMark int64
+	// BuildCacheMaxAge is the time after which unused build cache is removed; zero keeps it until the high-water mark is reached
+	BuildCacheMaxAge time.Duration
+}
+
+// Item is something which is removed by the garbage collection
+type Item struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Name is the tag of an image or the name of a container
+	Name   string `json:"name,omitempty"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// Report lists what has been removed or would be removed in a dry run
+type Report struct {
+	DryRun bool `json:"dryRun"`
+	// DiskUsage of images, containers and build cache in bytes before the collection
+	DiskUsage             int64  `json:"diskUsage"`
+	HighWaterMark         int64  `json:"highWaterMark"`
+	HighWaterMarkExceeded bool   `json:"highWaterMarkExceeded"`
+	Items                 []Item `json:"items"`
+	// Reclaimed is the sum of the sizes of the removed items; layers shared with kept images are not freed
+	Reclaimed int64    `json:"reclaimed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+type Collector struct {
+	api      store.Getter
+	runtime  compose.ContainerRuntime
+	interval time.Duration
+	options  Options
+
+	// mu serializes the periodic and the manually triggered collections
+	mu sync.Mutex
+}
+
+// NewCollector returns a task which collects garbage every interval; a zero interval only allows manual collections
+func NewCollector(api store.Getter, runtime compose.ContainerRuntime, interval time.Duration, options Options) *Collector {
+	if options.KeepImages < 1 {
+		options.KeepImages = 1
+	}
+
+	return &Collector{
+		api:      api,
+		runtime:  runtime,
+		interval: interval,
+		options:  options,
+	}
+}
+
+func (c *Collector) Run(ctx context.Context) error {
+	if c.interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	for {
+		t := time.NewTimer(c.interval)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+			report, err := c.Collect(ctx, false)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to collect garbage")
+				continue
+			}
+
+			if len(report.Items) > 0 {
+				logrus.WithField("items", len(report.Items)).WithField("reclaimed", report.Reclaimed).Info("collected garbage")
+			}
+			for _, message := range report.Errors {
+				logrus.Warn("garbage collection: " + message)
+			}
+		}
+	}
+}
+
+// Collect removes everything which isn't referenced by a project anymore; in a dry run nothing gets removed
+func (c *Collector) Collect(ctx context.Context, dryRun bool) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	projects, err := c.api.List(projectv1.VersionKind)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to list projects")
+	}
+
+	projectNames := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		projectNames[project.GetName()] = true
+	}
+
+	usage, err := c.runtime.DiskUsage(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to get disk usage")
+	}
+
+	report := &Report{
+		DryRun:        dryRun,
+		DiskUsage:     diskUsage(usage),
+		HighWaterMark: c.options.HighWaterMark,
+		Items:         make([]Item, 0),
+	}
+	report.HighWaterMarkExceeded = c.options.HighWaterMark > 0 && report.DiskUsage > c.options.HighWaterMark
+
+	containers := c.planContainers(usage, projectNames)
+	images := c.planImages(usage, projectNames, report.HighWaterMarkExceeded)
+	buildCache := c.planBuildCache(usage, report.HighWaterMarkExceeded)
+
+	if dryRun {
+		report.Items = append(append(append(report.Items, containers...), images...), buildCache...)
+		for _, item := range report.Items {
+			report.Reclaimed += item.Size
+		}
+		return report, nil
+	}
+
+	// containers go first, so that their images are unused afterwards
+	for _, item := range containers {
+		if err := c.runtime.RemoveContainer(ctx, item.ID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to remove container %s: %s", item.Name, err.Error()))
+			continue
+		}
+		report.Items = append(report.Items, item)
+		report.Reclaimed += item.Size
+	}
+
+	for _, item := range images {
+		if err := c.runtime.RemoveImage(ctx, item.ID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to remove image %s: %s", item.Name, err.Error()))
+			continue
+		}
+		report.Items = append(report.Items, item)
+		report.Reclaimed += item.Size
+	}
+
+	if len(buildCache) > 0 {
+		unusedFor := c.options.BuildCacheMaxAge
+		if report.HighWaterMarkExceeded {
+			unusedFor = 0
+		}
+
+		reclaimed, err := c.runtime.PruneBuildCache(ctx, unusedFor)
+		if err != nil {
+			report.Errors = append(report.Errors, "failed to prune build cache: "+err.Error())
+		} else {
+			report.Items = append(report.Items, buildCache...)
+			report.Reclaimed += int64(reclaimed)
+		}
+	}
+
+	return report, nil
+}
+
+// planContainers returns the stopped containers deployed by recoon for projects which it doesn't know anymore;
+// containers without the recoon marker label, e.g. of foreign compose projects, are never removed
+func (c *Collector) planContainers(usage dockertypes.DiskUsage, projectNames map[string]bool) []Item {
+	items := make([]Item, 0)
+	for _, container := range usage.Containers {
+		projectName := container.Labels[compose.LabelOwner]
+		if projectName == "" || projectNames[projectName] || container.State == "running" {
+			continue
+		}
+
+		items = append(items, Item{
+			Kind:   KindContainer,
+			ID:     container.ID,
+			Name:   containerName(container),
+			Size:   container.SizeRw,
+			Reason: fmt.Sprintf("stopped container of unknown project %s", projectName),
+		})
+	}
+
+	return items
+}
+
+// planImages returns the dangling images built by recoon, the images of removed containers and the old images of the
+// repositories used by the containers of projects. Only the newest KeepImages images per repository are kept, or just
+// the ones in use if the high-water mark is exceeded. Images of other repositories are never removed.
+func (c *Collector) planImages(usage dockertypes.DiskUsage, projectNames map[string]bool, highWaterMarkExceeded bool) []Item {
+	// images of removed containers are unused after the collection
+	removedContainers := make(map[string]bool)
+	for _, item := range c.planContainers(usage, projectNames) {
+		removedContainers[item.ID] = true
+	}
+
+	inUse := make(map[string]bool)
+	orphaned := make(map[string]bool)
+	repositories := make(map[string]bool)
+	for _, container := range usage.Containers {
+		if removedContainers[container.ID] {
+			orphaned[container.ImageID] = true
+			continue
+		}
+		inUse[container.ImageID] = true
+
+		if projectNames[container.Labels[compose.LabelOwner]] {
+			if repository, ok := repositoryOf(container.Image); ok {
+				repositories[repository] = true
+			}
+		}
+	}
+
+	keep := c.options.KeepImages
+	if highWaterMarkExceeded {
+		keep = 0
+	}
+
+	byRepository := make(map[string][]*dockertypes.ImageSummary)
+	items := make([]Item, 0)
+	for _, image := range usage.Images {
+		if inUse[image.ID] {
+			continue
+		}
+
+		tags := repoTags(image)
+		if len(tags) == 0 {
+			if image.Labels[compose.LabelOwner] != "" {
+				items = append(items, Item{Kind: KindImage, ID: image.ID, Size: image.Size, Reason: "dangling image"})
+			}
+			continue
+		}
+
+		referenced := false
+		for _, tag := range tags {
+			if repository, ok := repositoryOf(tag); ok && repositories[repository] {
+				byRepository[repository] = append(byRepository[repository], image)
+				referenced = true
+			}
+		}
+
+		if !referenced && orphaned[image.ID] {
+			items = append(items, Item{
+				Kind:   KindImage,
+				ID:     image.ID,
+				Name:   strings.Join(tags, ", "),
+				Size:   image.Size,
+				Reason: "image of removed containers of unknown projects",
+			})
+		}
+	}
+
+	// the images in use count towards the kept images, so the newest unused ones are kept only if there is room
+	used := make(map[string]int)
+	for _, image := range usage.Images {
+		if !inUse[image.ID] {
+			continue
+		}
+		for _, tag := range repoTags(image) {
+			if repository, ok := repositoryOf(tag); ok {
+				used[repository]++
+			}
+		}
+	}
+
+	// an image with tags of multiple repositories is only removed if none of them keeps it
+	keptBy := make(map[string]bool)
+	removable := make(map[string]*dockertypes.ImageSummary)
+	reasons := make(map[string]string)
+	for repository, images := range byRepository {
+		sort.Slice(images, func(i, j int) bool {
+			return images[i].Created > images[j].Created
+		})
+
+		for i, image := range images {
+			if i < keep-used[repository] {
+				keptBy[image.ID] = true
+				continue
+			}
+			removable[image.ID] = image
+			if highWaterMarkExceeded {
+				reasons[image.ID] = "unused image while the disk high-water mark is exceeded"
+			} else {
+				reasons[image.ID] = fmt.Sprintf("more than %d images of repository %s", keep, repository)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(removable))
+	for id := range removable {
+		if !keptBy[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		image := removable[id]
+		items = append(items, Item{
+			Kind:   KindImage,
+			ID:     image.ID,
+			Name:   strings.Join(repoTags(image), ", "),
+			Size:   image.Size,
+			Reason: reasons[id],
+		})
+	}
+
+	return items
+}
+
+// planBuildCache returns the unused build cache records older than BuildCacheMaxAge or all if the high-water mark is exceeded
+func (c *Collector) planBuildCache(usage dockertypes.DiskUsage, highWaterMarkExceeded bool) []Item {
+	items := make([]Item, 0)
+	if !highWaterMarkExceeded && c.options.BuildCacheMaxAge <= 0 {
+		return items
+	}
+
+	for _, record := range usage.BuildCache {
+		if record.InUse {
+			continue
+		}
+
+		reason := "unused build cache while the disk high-water mark is exceeded"
+		if !highWaterMarkExceeded {
+			if record.LastUsedAt != nil && time.Since(*record.LastUsedAt) < c.options.BuildCacheMaxAge {
+				continue
+			}
+			reason = fmt.Sprintf("build cache unused for more than %s", c.options.BuildCacheMaxAge)
+		}
+
+		items = append(items, Item{
+			Kind:   KindBuildCache,
+			ID:     record.ID,
+			Name:   record.Description,
+			Size:   record.Size,
+			Reason: reason,
+		})
+	}
+
+	return items
+}
+
+func diskUsage(usage dockertypes.DiskUsage) int64 {
+	total := usage.LayersSize
+	for _, container := range usage.Containers {
+		total += container.SizeRw
+	}
+	for _, record := range usage.BuildCache {
+		if !record.Shared {
+			total += record.Size
+		}
+	}
+
+	return total
+}
+
+// repositoryOf returns the normalized repository of the image reference
+func repositoryOf(image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+
+	return named.Name(), true
+}
+
+func repoTags(image *dockertypes.ImageSummary) []string {
+	tags := make([]string, 0, len(image.RepoTags))
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func containerName(container *dockertypes.Container) string {
+	if len(container.Names) == 0 {
+		return container.ID
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/")
+}
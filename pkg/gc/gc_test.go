@@ -0,0 +1,132 @@
+package gc_test
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/lacodon/recoon/pkg/compose/fake"
+	"github.com/lacodon/recoon/pkg/gc"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collector", func() {
+	var (
+		api     *store.DefaultStore
+		backend *fake.Backend
+		now     = time.Now()
+	)
+
+	itemIds := func(report *gc.Report) []string {
+		ids := make([]string, 0, len(report.Items))
+		for _, item := range report.Items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "project-app"},
+			Spec:       &projectv1.Spec{},
+		})).To(Succeed())
+
+		backend = fake.New()
+		Expect(backend.StartContainer(context.Background(),
+			backend.CreateContainer("app", "web", "nginx:1.25", map[string]string{compose.LabelOwner: "app"}))).To(Succeed())
+		backend.CreateContainer("removed", "cache", "redis:7", map[string]string{compose.LabelOwner: "removed"})
+
+		backend.AddImage("sha256:nginx:1.25", []string{"nginx:1.25"}, nil, 100, now)
+		backend.AddImage("sha256:nginx:1.24", []string{"nginx:1.24"}, nil, 100, now.Add(-1*time.Hour))
+		backend.AddImage("sha256:nginx:1.23", []string{"nginx:1.23"}, nil, 100, now.Add(-2*time.Hour))
+		backend.AddImage("sha256:nginx:1.22", []string{"nginx:1.22"}, nil, 100, now.Add(-3*time.Hour))
+		backend.AddImage("sha256:redis:7", []string{"redis:7"}, nil, 50, now)
+		backend.AddImage("sha256:dangling", []string{"<none>:<none>"}, map[string]string{compose.LabelOwner: "removed"}, 10, now)
+		backend.AddImage("sha256:alpine:3", []string{"alpine:3"}, nil, 5, now.Add(-24*time.Hour))
+
+		backend.AddImage("sha256:foreign", []string{"<none>:<none>"}, nil, 10, now)
+
+		backend.AddBuildCache("recent", 20, now.Add(-time.Hour))
+		backend.AddBuildCache("old", 30, now.Add(-10*24*time.Hour))
+	})
+
+	AfterEach(func() {
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should only report in a dry run", func() {
+		collector := gc.NewCollector(api, backend, 0, gc.Options{KeepImages: 3, BuildCacheMaxAge: 7 * 24 * time.Hour})
+
+		report, err := collector.Collect(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.DryRun).To(BeTrue())
+		Expect(itemIds(report)).To(ConsistOf(
+			backend.Containers("removed")[0].ID, "sha256:nginx:1.22", "sha256:redis:7", "sha256:dangling", "old"))
+		Expect(report.Reclaimed).To(Equal(int64(100 + 50 + 10 + 30)))
+
+		Expect(backend.Images()).To(HaveLen(8))
+		Expect(backend.Containers("removed")).To(HaveLen(1))
+		Expect(backend.Calls("PruneBuildCache", "")).To(BeEmpty())
+	})
+
+	It("should keep the newest images of the repositories used by projects and unrelated images", func() {
+		collector := gc.NewCollector(api, backend, 0, gc.Options{KeepImages: 3, BuildCacheMaxAge: 7 * 24 * time.Hour})
+
+		report, err := collector.Collect(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Errors).To(BeEmpty())
+
+		Expect(backend.Images()).To(ConsistOf("sha256:nginx:1.25", "sha256:nginx:1.24", "sha256:nginx:1.23", "sha256:alpine:3", "sha256:foreign"))
+		Expect(backend.Containers("removed")).To(BeEmpty())
+		Expect(backend.Containers("app")).To(HaveLen(1))
+		Expect(backend.Calls("PruneBuildCache", "")).To(HaveLen(1))
+
+		// nothing left to collect
+		report, err = collector.Collect(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Items).To(BeEmpty())
+	})
+
+	It("should only keep images in use and remove all build cache above the high-water mark", func() {
+		collector := gc.NewCollector(api, backend, 0, gc.Options{KeepImages: 3, HighWaterMark: 100})
+
+		report, err := collector.Collect(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.HighWaterMarkExceeded).To(BeTrue())
+		Expect(itemIds(report)).To(ContainElements("recent", "old"))
+
+		Expect(backend.Images()).To(ConsistOf("sha256:nginx:1.25", "sha256:alpine:3", "sha256:foreign"))
+	})
+
+	It("should never remove the containers and images of foreign compose projects", func() {
+		foreign := backend.CreateContainer("foreign", "db", "postgres:15", nil)
+		backend.AddImage("sha256:postgres:15", []string{"postgres:15"}, nil, 80, now)
+		backend.AddImage("sha256:postgres:14", []string{"postgres:14"}, nil, 80, now.Add(-time.Hour))
+		// a foreign project named like a recoon project doesn't make its images ones of the project
+		Expect(backend.StartContainer(context.Background(), backend.CreateContainer("app", "proxy", "traefik:2", nil))).To(Succeed())
+		backend.AddImage("sha256:traefik:2", []string{"traefik:2"}, nil, 40, now)
+		backend.AddImage("sha256:traefik:1", []string{"traefik:1"}, nil, 40, now.Add(-time.Hour))
+
+		collector := gc.NewCollector(api, backend, 0, gc.Options{KeepImages: 1, HighWaterMark: 100})
+
+		report, err := collector.Collect(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Errors).To(BeEmpty())
+		Expect(itemIds(report)).NotTo(ContainElements(foreign, "sha256:postgres:15", "sha256:postgres:14", "sha256:traefik:1", "sha256:foreign"))
+
+		Expect(backend.Containers("foreign")).To(ConsistOf(HaveField("ID", foreign)))
+		Expect(backend.Images()).To(ContainElements("sha256:postgres:15", "sha256:postgres:14", "sha256:traefik:1", "sha256:foreign"))
+		Expect(backend.Images()).NotTo(ContainElement("sha256:nginx:1.24"))
+	})
+})
@@ -0,0 +1,82 @@
+package gitrepo
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// HasChanges reports whether any file below one of the given paths differs between the two commits
+func (g *gitRepo) HasChanges(fromCommitId, toCommitId string, paths []string) (bool, error) {
+	if fromCommitId == toCommitId {
+		return false, nil
+	}
+
+	fromTree, err := g.getTree(fromCommitId)
+	if err != nil {
+		return false, err
+	}
+
+	toTree, err := g.getTree(toCommitId)
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return false, err
+	}
+
+	for _, change := range changes {
+		if isBelowAnyPath(change.From.Name, paths) || isBelowAnyPath(change.To.Name, paths) {
+			return true, nil
+		}
+
+		// include paths inside of a submodule are compared by the commits of the submodule
+		if name := submodulePath(change); name != "" && g.submoduleHasChanges(change, pathsInside(name, paths)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (g *gitRepo) getTree(commitId string) (*object.Tree, error) {
+	commit, err := g.repository.CommitObject(plumbing.NewHash(commitId))
+	if err != nil {
+		return nil, err
+	}
+
+	return commit.Tree()
+}
+
+// submodulePath returns the path of a changed submodule or an empty string for other changes
+func submodulePath(change *object.Change) string {
+	if change.To.TreeEntry.Mode == filemode.Submodule {
+		return change.To.Name
+	}
+	if change.From.TreeEntry.Mode == filemode.Submodule {
+		return change.From.Name
+	}
+
+	return ""
+}
+
+// isBelowAnyPath checks if the given file name lays below one of the paths; an empty path matches every file
+func isBelowAnyPath(name string, paths []string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if p == "" || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package gitrepo_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func commitFile(repo *git.Repository, dir, name, content string) string {
+	Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)).To(Succeed())
+
+	worktree, err := repo.Worktree()
+	Expect(err).To(BeNil())
+
+	_, err = worktree.Add(name)
+	Expect(err).To(BeNil())
+
+	hash, err := worktree.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	Expect(err).To(BeNil())
+
+	return hash.String()
+}
+
+var _ = Describe("HasChanges", Ordered, func() {
+	var repo gitrepo.ReadonlyGitRepository
+	var first, second, third string
+
+	BeforeAll(func() {
+		repoDir := GinkgoT().TempDir()
+		rawRepo, err := git.PlainInit(repoDir, false)
+		Expect(err).To(BeNil())
+
+		first = commitFile(rawRepo, repoDir, "app-a/docker-compose.yml", "a: 1")
+		second = commitFile(rawRepo, repoDir, "app-b/docker-compose.yml", "b: 1")
+		third = commitFile(rawRepo, repoDir, "app-a/config/app.conf", "a: 2")
+
+		repo, err = gitrepo.NewReadOnlyGitRepository(repoDir)
+		Expect(err).To(BeNil())
+	})
+
+	It("should not report changes for the same commit", func() {
+		Expect(repo.HasChanges(first, first, []string{""})).To(BeFalse())
+	})
+
+	It("should ignore changes outside of the include paths", func() {
+		Expect(repo.HasChanges(first, second, []string{"/app-a"})).To(BeFalse())
+	})
+
+	It("should detect changes below the include paths", func() {
+		Expect(repo.HasChanges(first, second, []string{"/app-b/"})).To(BeTrue())
+		Expect(repo.HasChanges(second, third, []string{"app-a"})).To(BeTrue())
+	})
+
+	It("should not match paths which only share a prefix", func() {
+		Expect(repo.HasChanges(first, second, []string{"/app"})).To(BeFalse())
+	})
+
+	It("should treat the repository root as include path for everything", func() {
+		Expect(repo.HasChanges(first, second, []string{"/"})).To(BeTrue())
+	})
+
+	It("should fail for unknown commits", func() {
+		_, err := repo.HasChanges("0000000000000000000000000000000000000000", third, []string{""})
+		Expect(err).NotTo(BeNil())
+	})
+})
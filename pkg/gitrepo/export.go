@@ -0,0 +1,127 @@
+package gitrepo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// ExportCommit writes the files of the given commit of the repository at localPath into destination, including the
+// files of its checked out submodules
+func ExportCommit(localPath, commitId, destination string) error {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return err
+	}
+
+	return exportCommit(repo, plumbing.NewHash(commitId), destination)
+}
+
+func exportCommit(repo *git.Repository, hash plumbing.Hash, destination string) error {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	if err := tree.Files().ForEach(func(file *object.File) error {
+		return exportFile(file, filepath.Join(destination, filepath.FromSlash(file.Name)))
+	}); err != nil {
+		return err
+	}
+
+	return exportSubmodules(repo, tree, destination)
+}
+
+func exportFile(file *object.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	if mode&os.ModeSymlink != 0 {
+		linkTarget, err := file.Contents()
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(linkTarget, target)
+	}
+
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// exportSubmodules writes the commits of the submodules of the tree into their paths below destination; submodules
+// which aren't checked out, e.g. outside of the sparse checkout directories, stay empty like in the work tree
+func exportSubmodules(repo *git.Repository, tree *object.Tree, destination string) error {
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode != filemode.Submodule {
+			continue
+		}
+
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+
+		submodule, err := worktree.Submodule(submoduleName(worktree, name))
+		if err != nil {
+			continue
+		}
+
+		submoduleRepo, err := submodule.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "failed to open submodule %s", name)
+		}
+
+		target := filepath.Join(destination, filepath.FromSlash(name))
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+
+		if err := exportCommit(submoduleRepo, entry.Hash, target); err != nil {
+			return errors.WithMessagef(err, "failed to export submodule %s", name)
+		}
+	}
+}
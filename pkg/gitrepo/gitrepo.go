@@ -6,7 +6,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
@@ -14,13 +13,17 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
 	"github.com/lacodon/recoon/pkg/sshauth"
 	"github.com/sirupsen/logrus"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 type GitRepository interface {
 	Pull(ctx context.Context) error
 	GetCurrentCommitId() string
+	// GetResolvedRef returns the branch or tag which the current commit got selected by
+	GetResolvedRef() string
 	GetFS() (billy.Filesystem, error)
 	GetLocalPath() string
 }
@@ -28,23 +31,69 @@ type GitRepository interface {
 type ReadonlyGitRepository interface {
 	GetCurrentCommitId() string
 	GetFS() (billy.Filesystem, error)
+	HasChanges(fromCommitId, toCommitId string, paths []string) (bool, error)
 }
 
 type gitRepo struct {
-	url        string
-	branchName string
-	localPath  string
-	repository *git.Repository
-	auth       transport.AuthMethod
+	url         string
+	branchName  string
+	ref         *repositoryv1.RefSelector
+	resolvedRef string
+	localPath   string
+	repository  *git.Repository
+	auth        transport.AuthMethod
+	hostKeys    gossh.HostKeyCallback
+	depth       int
+	sparseDirs  []string
+
+	cloneOptions *git.CloneOptions
 }
 
-func NewReadOnlyGitRepository(localPath, sshKeyDir string) (ReadonlyGitRepository, error) {
-	repo, err := git.PlainOpen(localPath)
-	if err != nil {
-		return nil, err
+// Option configures a repository created by NewGitRepository
+type Option func(g *gitRepo)
+
+// WithRef checks out the tag or commit selected by ref instead of the head of the branch. The repository gets
+// its own local path per selector.
+func WithRef(ref *repositoryv1.RefSelector) Option {
+	return func(g *gitRepo) {
+		if ref.String() != "" {
+			g.ref = ref
+		}
+	}
+}
+
+// WithAuth authenticates against the remote with auth instead of the global SSH key
+func WithAuth(auth transport.AuthMethod) Option {
+	return func(g *gitRepo) {
+		g.auth = auth
+	}
+}
+
+// WithHostKeyCallback verifies the host keys of SSH remotes with callback instead of the SSH_KNOWN_HOSTS files
+func WithHostKeyCallback(callback gossh.HostKeyCallback) Option {
+	return func(g *gitRepo) {
+		g.hostKeys = callback
+	}
+}
+
+// WithDepth limits clones and fetches to the last depth commits of the tracked ref; 0 fetches the full history.
+// Commit selectors need a depth which still contains the commit.
+func WithDepth(depth int) Option {
+	return func(g *gitRepo) {
+		g.depth = depth
+	}
+}
+
+// WithSparseCheckout only checks out the files below the directories, which are relative to the repository root
+func WithSparseCheckout(dirs []string) Option {
+	return func(g *gitRepo) {
+		g.sparseDirs = dirs
 	}
+}
 
-	auth, err := ssh.NewPublicKeysFromFile("git", filepath.Join(sshKeyDir, sshauth.PrivateKeyFile), "")
+// NewReadOnlyGitRepository opens a cloned repository; it never talks to the remote and thus needs no credentials
+func NewReadOnlyGitRepository(localPath string) (ReadonlyGitRepository, error) {
+	repo, err := git.PlainOpen(localPath)
 	if err != nil {
 		return nil, err
 	}
@@ -52,17 +101,24 @@ func NewReadOnlyGitRepository(localPath, sshKeyDir string) (ReadonlyGitRepositor
 	return &gitRepo{
 		localPath:  localPath,
 		repository: repo,
-		auth:       auth,
 	}, nil
 }
 
-func NewGitRepository(ctx context.Context, localDir, cloneUrl, branchName, sshKeyDir string) (GitRepository, error) {
+func NewGitRepository(ctx context.Context, localDir, cloneUrl, branchName, sshKeyDir string, opts ...Option) (GitRepository, error) {
 	var progressWriter io.Writer
 	if logrus.GetLevel() == logrus.DebugLevel {
 		progressWriter = os.Stdout
 	}
 
-	destinationPath := MakeLocalPath(localDir, cloneUrl, branchName)
+	g := &gitRepo{
+		url:        cloneUrl,
+		branchName: branchName,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	destinationPath := MakeLocalPath(localDir, cloneUrl, branchName, g.cloneSuffixes()...)
 
 	options := &git.CloneOptions{
 		URL:           cloneUrl,
@@ -70,9 +126,19 @@ func NewGitRepository(ctx context.Context, localDir, cloneUrl, branchName, sshKe
 		ReferenceName: plumbing.NewBranchReferenceName(branchName),
 		Progress:      progressWriter,
 		SingleBranch:  true,
+		Depth:         g.depth,
+		Tags:          git.NoTags,
+		// Pull checks out the selected commit or the sparse directories
+		NoCheckout: g.ref != nil || len(g.sparseDirs) > 0,
+	}
+
+	if g.ref != nil && branchName == "" {
+		// the default branch; Pull fetches the selected tags or all branches
+		options.ReferenceName = ""
 	}
 
-	if strings.HasPrefix(cloneUrl, "git@") {
+	options.Auth = g.auth
+	if options.Auth == nil && IsSSHUrl(cloneUrl) {
 		auth, err := ssh.NewPublicKeysFromFile("git", filepath.Join(sshKeyDir, sshauth.PrivateKeyFile), "")
 		if err != nil {
 			return nil, err
@@ -81,6 +147,10 @@ func NewGitRepository(ctx context.Context, localDir, cloneUrl, branchName, sshKe
 		options.Auth = auth
 	}
 
+	if publicKeys, ok := options.Auth.(*ssh.PublicKeys); ok && g.hostKeys != nil {
+		publicKeys.HostKeyCallback = g.hostKeys
+	}
+
 	logrus.Debug("cloning into ", destinationPath)
 	repo, err := git.PlainCloneContext(ctx, destinationPath, false, options)
 	if err != nil {
@@ -96,13 +166,11 @@ func NewGitRepository(ctx context.Context, localDir, cloneUrl, branchName, sshKe
 		}
 	}
 
-	return &gitRepo{
-		url:        cloneUrl,
-		branchName: branchName,
-		localPath:  destinationPath,
-		repository: repo,
-		auth:       options.Auth,
-	}, nil
+	g.localPath = destinationPath
+	g.repository = repo
+	g.auth = options.Auth
+	g.cloneOptions = options
+	return g, nil
 }
 
 // Pull pulls all changes from remote
@@ -112,13 +180,25 @@ func (g *gitRepo) Pull(ctx context.Context) error {
 		progressWriter = os.Stdout
 	}
 
-	if err := g.repository.FetchContext(ctx, &git.FetchOptions{
+	fetchOptions := &git.FetchOptions{
 		RemoteName: "origin",
-		RefSpecs:   []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		RefSpecs:   g.refSpecs(),
+		Depth:      g.depth,
 		Auth:       g.auth,
 		Progress:   progressWriter,
 		Force:      true,
-	}); err != nil {
+		Tags:       git.NoTags,
+	}
+
+	err := g.repository.FetchContext(ctx, fetchOptions)
+	if errors.Is(err, plumbing.ErrObjectNotFound) && g.depth > 0 {
+		// go-git fails to update some shallow clones, but cloning them again is cheap
+		if err = g.reclone(ctx); err == nil {
+			err = g.repository.FetchContext(ctx, fetchOptions)
+		}
+	}
+
+	if err != nil {
 		if errors.Is(err, git.ErrRemoteNotFound) {
 			if _, err := g.repository.CreateRemote(&gitconfig.RemoteConfig{
 				Name:  "origin",
@@ -141,13 +221,65 @@ func (g *gitRepo) Pull(ctx context.Context) error {
 		return err
 	}
 
-	if err := worktree.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.NewRemoteReferenceName("origin", g.branchName),
-		Force:  true,
-	}); err != nil {
+	checkoutOptions := &git.CheckoutOptions{
+		Branch:                    plumbing.NewRemoteReferenceName("origin", g.branchName),
+		Force:                     true,
+		SparseCheckoutDirectories: g.sparseDirs,
+	}
+	resolvedRef := plumbing.NewBranchReferenceName(g.branchName).String()
+
+	if g.ref != nil {
+		checkoutOptions.Branch = ""
+		checkoutOptions.Hash, resolvedRef, err = g.resolveRef()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := g.checkout(worktree, checkoutOptions); err != nil {
+		return err
+	}
+
+	if err := g.updateSubmodules(ctx, worktree); err != nil {
+		return err
+	}
+
+	g.resolvedRef = resolvedRef
+	return nil
+}
+
+// checkout checks out the commit of the options. go-git only leaves out the files of a sparse checkout which are
+// already in the index, so the first sparse checkout into an empty index is repeated.
+func (g *gitRepo) checkout(worktree *git.Worktree, options *git.CheckoutOptions) error {
+	idx, err := g.repository.Storer.Index()
+	if err != nil {
+		return err
+	}
+	repeat := len(options.SparseCheckoutDirectories) > 0 && len(idx.Entries) == 0
+
+	if err := worktree.Checkout(options); err != nil {
+		return err
+	}
+
+	if repeat {
+		return worktree.Checkout(options)
+	}
+
+	return nil
+}
+
+// reclone replaces the local clone with a fresh one
+func (g *gitRepo) reclone(ctx context.Context) error {
+	logrus.WithField("path", g.localPath).Info("failed to update shallow clone, cloning again")
+
+	_ = os.RemoveAll(g.localPath)
+	repo, err := git.PlainCloneContext(ctx, g.localPath, false, g.cloneOptions)
+	if err != nil {
+		_ = os.RemoveAll(g.localPath)
 		return err
 	}
 
+	g.repository = repo
 	return nil
 }
 
@@ -160,6 +292,10 @@ func (g *gitRepo) GetCurrentCommitId() string {
 	return head.Hash().String()
 }
 
+func (g *gitRepo) GetResolvedRef() string {
+	return g.resolvedRef
+}
+
 func (g *gitRepo) GetFS() (billy.Filesystem, error) {
 	worktree, err := g.repository.Worktree()
 	if err != nil {
@@ -0,0 +1,13 @@
+package gitrepo_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestGitRepo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GitRepo Suite")
+}
@@ -0,0 +1,79 @@
+package gitrepo_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("shallow and sparse clones", func() {
+	var (
+		originDir string
+		origin    *git.Repository
+		repo      gitrepo.GitRepository
+	)
+
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(repo.GetLocalPath(), name))
+		if os.IsNotExist(err) {
+			return ""
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	BeforeEach(func() {
+		originDir = GinkgoT().TempDir()
+
+		var err error
+		origin, err = git.PlainInit(originDir, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		commitFile(origin, originDir, "app-a/docker-compose.yml", "a: 1")
+		commitFile(origin, originDir, "app-b/docker-compose.yml", "b: 1")
+		commitFile(origin, originDir, "README.md", "readme")
+
+		repo, err = gitrepo.NewGitRepository(context.Background(), GinkgoT().TempDir(), originDir, "master", "",
+			gitrepo.WithDepth(1), gitrepo.WithSparseCheckout([]string{"app-a"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.Pull(context.Background())).To(Succeed())
+	})
+
+	It("should only check out the sparse directories", func() {
+		Expect(read("app-a/docker-compose.yml")).To(Equal("a: 1"))
+		Expect(read("app-b/docker-compose.yml")).To(BeEmpty())
+		Expect(read("README.md")).To(BeEmpty())
+	})
+
+	It("should only fetch the last commits", func() {
+		Expect(filepath.Join(repo.GetLocalPath(), ".git", "shallow")).To(BeAnExistingFile())
+
+		local, err := git.PlainOpen(repo.GetLocalPath())
+		Expect(err).NotTo(HaveOccurred())
+		commits, err := local.Log(&git.LogOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		count := 0
+		_ = commits.ForEach(func(_ *object.Commit) error {
+			count++
+			return nil
+		})
+		Expect(count).To(Equal(1))
+	})
+
+	It("should pull new commits", func() {
+		commitFile(origin, originDir, "app-a/docker-compose.yml", "a: 2")
+		head := commitFile(origin, originDir, "app-b/docker-compose.yml", "b: 2")
+
+		Expect(repo.Pull(context.Background())).To(Succeed())
+		Expect(repo.GetCurrentCommitId()).To(Equal(head))
+		Expect(read("app-a/docker-compose.yml")).To(Equal("a: 2"))
+		Expect(read("app-b/docker-compose.yml")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,155 @@
+package gitrepo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/lacodon/recoon/pkg/semver"
+	"github.com/pkg/errors"
+)
+
+// cloneSuffixes returns file name friendly suffixes for the local path, which tell apart the clones of a url and
+// branch with different ref selectors, depths and sparse checkouts
+func (g *gitRepo) cloneSuffixes() []string {
+	var suffixes []string
+
+	if g.ref != nil {
+		suffixes = append(suffixes, "ref-"+shortHash(g.ref.String()))
+	}
+
+	if g.depth > 0 {
+		suffixes = append(suffixes, "depth-"+strconv.Itoa(g.depth))
+	}
+
+	if len(g.sparseDirs) > 0 {
+		suffixes = append(suffixes, "sparse-"+shortHash(strings.Join(g.sparseDirs, "\n")))
+	}
+
+	return suffixes
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// refSpecs returns the refspecs which fetch only the refs needed to resolve the tracked branch or ref selector
+func (g *gitRepo) refSpecs() []gitconfig.RefSpec {
+	branches := gitconfig.RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	if g.branchName != "" {
+		branches = gitconfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", g.branchName, g.branchName))
+	}
+
+	// tags may be moved, so they are overwritten
+	switch {
+	case g.ref == nil || g.ref.Commit != "":
+		return []gitconfig.RefSpec{branches}
+	case g.ref.Tag != "":
+		tag := plumbing.NewTagReferenceName(g.ref.Tag)
+		return []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("+%s:%s", tag, tag))}
+	default:
+		return []gitconfig.RefSpec{"+refs/tags/*:refs/tags/*"}
+	}
+}
+
+// resolveRef returns the commit selected by the ref selector and the tag it got selected by or the commit itself
+func (g *gitRepo) resolveRef() (plumbing.Hash, string, error) {
+	set := 0
+	for _, field := range []string{g.ref.Tag, g.ref.Semver, g.ref.Commit} {
+		if field != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return plumbing.ZeroHash, "", errors.New("only one of tag, semver and commit may be set")
+	}
+
+	switch {
+	case g.ref.Commit != "":
+		hash, err := g.repository.ResolveRevision(plumbing.Revision(g.ref.Commit))
+		if err != nil {
+			return plumbing.ZeroHash, "", errors.WithMessagef(err, "failed to resolve commit %s", g.ref.Commit)
+		}
+		return *hash, hash.String(), nil
+
+	case g.ref.Tag != "":
+		name := plumbing.NewTagReferenceName(g.ref.Tag)
+		hash, err := g.peelTag(name)
+		if err != nil {
+			return plumbing.ZeroHash, "", errors.WithMessagef(err, "failed to resolve tag %s", g.ref.Tag)
+		}
+		return hash, name.String(), nil
+
+	default:
+		return g.resolveSemver()
+	}
+}
+
+// resolveSemver returns the commit of the highest tag in the semver range
+func (g *gitRepo) resolveSemver() (plumbing.Hash, string, error) {
+	semverRange, err := semver.ParseRange(g.ref.Semver)
+	if err != nil {
+		return plumbing.ZeroHash, "", errors.WithMessagef(err, "invalid semver range %q", g.ref.Semver)
+	}
+
+	tags, err := g.repository.Tags()
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	var best *plumbing.Reference
+	var bestVersion semver.Version
+	if err := tags.ForEach(func(ref *plumbing.Reference) error {
+		v, ok := semver.Parse(ref.Name().Short())
+		if !ok || !semverRange.Matches(v) {
+			return nil
+		}
+
+		if best == nil || v.Compare(bestVersion) > 0 {
+			best, bestVersion = ref, v
+		}
+		return nil
+	}); err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	if best == nil {
+		return plumbing.ZeroHash, "", errors.Errorf("no tag matches semver range %q", g.ref.Semver)
+	}
+
+	hash, err := g.peelTag(best.Name())
+	if err != nil {
+		return plumbing.ZeroHash, "", errors.WithMessagef(err, "failed to resolve tag %s", best.Name().Short())
+	}
+
+	return hash, best.Name().String(), nil
+}
+
+// peelTag returns the commit of a lightweight or annotated tag
+func (g *gitRepo) peelTag(name plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := g.repository.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tag, err := g.repository.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		// lightweight tags point to the commit directly
+		return ref.Hash(), nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return commit.Hash, nil
+}
@@ -0,0 +1,106 @@
+package gitrepo_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ref selector", func() {
+	var (
+		originDir string
+		localDir  string
+		commits   map[string]string
+	)
+
+	signature := func() *object.Signature {
+		return &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	}
+
+	BeforeEach(func() {
+		originDir = GinkgoT().TempDir()
+		localDir = GinkgoT().TempDir()
+		commits = make(map[string]string)
+
+		origin, err := git.PlainInit(originDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		worktree, err := origin.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+
+		for i, tag := range []string{"v1.0.0", "v1.2.0", "v2.0.0", "latest"} {
+			Expect(os.WriteFile(filepath.Join(originDir, "docker-compose.yml"), []byte(tag), 0644)).To(Succeed())
+			_, err = worktree.Add("docker-compose.yml")
+			Expect(err).NotTo(HaveOccurred())
+
+			hash, err := worktree.Commit(tag, &git.CommitOptions{Author: signature()})
+			Expect(err).NotTo(HaveOccurred())
+			commits[tag] = hash.String()
+
+			var opts *git.CreateTagOptions
+			if i%2 == 0 {
+				// mix annotated and lightweight tags
+				opts = &git.CreateTagOptions{Tagger: signature(), Message: tag}
+			}
+			_, err = origin.CreateTag(tag, hash, opts)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	pull := func(ref *repositoryv1.RefSelector) (gitrepo.GitRepository, error) {
+		repo, err := gitrepo.NewGitRepository(context.Background(), localDir, originDir, "master", "",
+			gitrepo.WithRef(ref))
+		Expect(err).NotTo(HaveOccurred())
+
+		return repo, repo.Pull(context.Background())
+	}
+
+	It("checks out the highest tag in the semver range", func() {
+		repo, err := pull(&repositoryv1.RefSelector{Semver: ">=1.1.0 <2.0.0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.GetCurrentCommitId()).To(Equal(commits["v1.2.0"]))
+		Expect(repo.GetResolvedRef()).To(Equal("refs/tags/v1.2.0"))
+
+		content, err := os.ReadFile(filepath.Join(repo.GetLocalPath(), "docker-compose.yml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("v1.2.0"))
+	})
+
+	It("checks out a fixed tag", func() {
+		repo, err := pull(&repositoryv1.RefSelector{Tag: "v2.0.0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.GetCurrentCommitId()).To(Equal(commits["v2.0.0"]))
+		Expect(repo.GetResolvedRef()).To(Equal("refs/tags/v2.0.0"))
+	})
+
+	It("checks out a commit by its abbreviated id", func() {
+		repo, err := pull(&repositoryv1.RefSelector{Commit: commits["v1.0.0"][:10]})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.GetCurrentCommitId()).To(Equal(commits["v1.0.0"]))
+		Expect(repo.GetResolvedRef()).To(Equal(commits["v1.0.0"]))
+	})
+
+	It("fails if no tag matches", func() {
+		_, err := pull(&repositoryv1.RefSelector{Semver: ">=3.0.0"})
+		Expect(err).To(MatchError(ContainSubstring("no tag matches")))
+	})
+
+	It("uses a separate local path per selector", func() {
+		tagged, err := pull(&repositoryv1.RefSelector{Tag: "v1.0.0"})
+		Expect(err).NotTo(HaveOccurred())
+		head, err := pull(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tagged.GetLocalPath()).NotTo(Equal(head.GetLocalPath()))
+		Expect(head.GetCurrentCommitId()).To(Equal(commits["latest"]))
+		Expect(head.GetResolvedRef()).To(Equal(plumbing.NewBranchReferenceName("master").String()))
+	})
+})
@@ -0,0 +1,123 @@
+package gitrepo
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// updateSubmodules initializes and updates the submodules recursively with the credentials of the repository;
+// submodules outside of the sparse checkout directories are skipped
+func (g *gitRepo) updateSubmodules(ctx context.Context, worktree *git.Worktree) error {
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return err
+	}
+
+	for _, submodule := range submodules {
+		cfg := submodule.Config()
+		if len(g.sparseDirs) > 0 && !isBelowAnyPath(cfg.Path, g.sparseDirs) {
+			continue
+		}
+
+		cfg.URL = resolveSubmoduleURL(g.url, cfg.URL)
+		if err := submodule.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			Auth:              g.auth,
+		}); err != nil {
+			return errors.WithMessagef(err, "failed to update submodule %s", cfg.Path)
+		}
+	}
+
+	return nil
+}
+
+// resolveSubmoduleURL resolves submodule urls relative to the url of the parent repository like git does, which
+// also works for scp-like urls such as git@github.com:org/repo.git
+func resolveSubmoduleURL(parentURL, submoduleURL string) string {
+	if !strings.HasPrefix(submoduleURL, "./") && !strings.HasPrefix(submoduleURL, "../") {
+		return submoduleURL
+	}
+
+	if parsed, err := url.Parse(parentURL); err == nil && parsed.Scheme != "" {
+		parsed.Path = path.Join(parsed.Path, submoduleURL)
+		return parsed.String()
+	}
+
+	if host, repoPath, found := strings.Cut(parentURL, ":"); found && !strings.Contains(host, "/") {
+		return host + ":" + path.Join(repoPath, submoduleURL)
+	}
+
+	return path.Join(parentURL, submoduleURL)
+}
+
+// submoduleHasChanges reports whether the change of a submodule affects one of the paths, which are relative to
+// the submodule; added, removed and not checked out submodules always do
+func (g *gitRepo) submoduleHasChanges(change *object.Change, paths []string) bool {
+	if len(paths) == 0 {
+		return false
+	}
+
+	if change.From.TreeEntry.Mode != filemode.Submodule || change.To.TreeEntry.Mode != filemode.Submodule {
+		return true
+	}
+
+	worktree, err := g.repository.Worktree()
+	if err != nil {
+		return true
+	}
+
+	submodule, err := worktree.Submodule(submoduleName(worktree, change.To.Name))
+	if err != nil {
+		return true
+	}
+
+	repo, err := submodule.Repository()
+	if err != nil {
+		return true
+	}
+
+	changed, err := (&gitRepo{repository: repo}).HasChanges(change.From.TreeEntry.Hash.String(), change.To.TreeEntry.Hash.String(), paths)
+	if err != nil {
+		// e.g. the old commit hasn't been fetched
+		return true
+	}
+
+	return changed
+}
+
+// submoduleName returns the name of the submodule at the path, which usually but not necessarily is the path
+func submoduleName(worktree *git.Worktree, submodulePath string) string {
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return submodulePath
+	}
+
+	for _, submodule := range submodules {
+		if submodule.Config().Path == submodulePath {
+			return submodule.Config().Name
+		}
+	}
+
+	return submodulePath
+}
+
+// pathsInside returns the paths below dir relative to dir
+func pathsInside(dir string, paths []string) []string {
+	inside := make([]string, 0)
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if strings.HasPrefix(p, dir+"/") {
+			inside = append(inside, strings.TrimPrefix(p, dir+"/"))
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,121 @@
+package gitrepo_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// commitSubmodule points the submodule at path to the commit of the repository at url
+func commitSubmodule(repo *git.Repository, dir, path, url, commitId string) string {
+	gitmodules := fmt.Sprintf("[submodule %q]\n\tpath = %s\n\turl = %s\n", path, path, url)
+	Expect(os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0644)).To(Succeed())
+
+	worktree, err := repo.Worktree()
+	Expect(err).To(BeNil())
+	_, err = worktree.Add(".gitmodules")
+	Expect(err).To(BeNil())
+
+	idx, err := repo.Storer.Index()
+	Expect(err).To(BeNil())
+	_, _ = idx.Remove(path)
+	idx.Entries = append(idx.Entries, &index.Entry{Name: path, Mode: filemode.Submodule, Hash: plumbing.NewHash(commitId)})
+	Expect(repo.Storer.SetIndex(idx)).To(Succeed())
+
+	hash, err := worktree.Commit("update "+path, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	Expect(err).To(BeNil())
+
+	return hash.String()
+}
+
+var _ = Describe("submodules", func() {
+	var (
+		originDir, sharedDir string
+		origin, shared       *git.Repository
+		repo                 gitrepo.GitRepository
+	)
+
+	BeforeEach(func() {
+		baseDir := GinkgoT().TempDir()
+		originDir = filepath.Join(baseDir, "app")
+		sharedDir = filepath.Join(baseDir, "shared")
+
+		var err error
+		shared, err = git.PlainInit(sharedDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		commitFile(shared, sharedDir, "compose/base.yml", "base: 1")
+		sharedCommit := commitFile(shared, sharedDir, "README.md", "readme")
+
+		origin, err = git.PlainInit(originDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		commitFile(origin, originDir, "app-a/docker-compose.yml", "a: 1")
+		commitSubmodule(origin, originDir, "shared", "../shared", sharedCommit)
+
+		repo, err = gitrepo.NewGitRepository(context.Background(), GinkgoT().TempDir(), originDir, "master", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.Pull(context.Background())).To(Succeed())
+	})
+
+	It("should check out submodules with relative urls", func() {
+		content, err := os.ReadFile(filepath.Join(repo.GetLocalPath(), "shared", "compose", "base.yml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("base: 1"))
+	})
+
+	It("should export the files of submodules", func() {
+		exportDir := GinkgoT().TempDir()
+		Expect(gitrepo.ExportCommit(repo.GetLocalPath(), repo.GetCurrentCommitId(), exportDir)).To(Succeed())
+
+		content, err := os.ReadFile(filepath.Join(exportDir, "shared", "compose", "base.yml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("base: 1"))
+		Expect(filepath.Join(exportDir, "app-a", "docker-compose.yml")).To(BeARegularFile())
+		Expect(filepath.Join(exportDir, "shared", ".git")).NotTo(BeAnExistingFile())
+	})
+
+	It("should detect changes inside of submodules", func() {
+		before := repo.GetCurrentCommitId()
+
+		sharedCommit := commitFile(shared, sharedDir, "README.md", "new readme")
+		commitSubmodule(origin, originDir, "shared", "../shared", sharedCommit)
+		Expect(repo.Pull(context.Background())).To(Succeed())
+		readmeOnly := repo.GetCurrentCommitId()
+
+		sharedCommit = commitFile(shared, sharedDir, "compose/base.yml", "base: 2")
+		commitSubmodule(origin, originDir, "shared", "../shared", sharedCommit)
+		Expect(repo.Pull(context.Background())).To(Succeed())
+		composeChanged := repo.GetCurrentCommitId()
+
+		content, err := os.ReadFile(filepath.Join(repo.GetLocalPath(), "shared", "compose", "base.yml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("base: 2"))
+
+		readOnly, err := gitrepo.NewReadOnlyGitRepository(repo.GetLocalPath())
+		Expect(err).NotTo(HaveOccurred())
+
+		changed, err := readOnly.HasChanges(before, readmeOnly, []string{"app-a", "shared/compose"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		changed, err = readOnly.HasChanges(readmeOnly, composeChanged, []string{"app-a", "shared/compose"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		changed, err = readOnly.HasChanges(readmeOnly, composeChanged, []string{"app-a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+	})
+})
@@ -4,10 +4,59 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-func MakeLocalPath(localDir, cloneUrl, branchName string) string {
-	destinationPath := filepath.Join(localDir, MakeAPIName(cloneUrl, branchName))
+// IsSSHUrl tells whether the clone url uses the SSH protocol, e.g. git@host:repo.git or ssh://host/repo.git
+func IsSSHUrl(cloneUrl string) bool {
+	endpoint, err := transport.NewEndpoint(cloneUrl)
+	if err != nil {
+		return false
+	}
+
+	return endpoint.Protocol == "ssh"
+}
+
+// IsLocalUrl tells whether the clone url is a path or file:// url of a local repository, e.g. a bare repository on
+// an air-gapped host
+func IsLocalUrl(cloneUrl string) bool {
+	endpoint, err := transport.NewEndpoint(cloneUrl)
+	if err != nil {
+		return false
+	}
+
+	return endpoint.Protocol == "file"
+}
+
+// LocalRepoPath returns the absolute path of a local clone url or an empty string for remote urls
+func LocalRepoPath(cloneUrl string) string {
+	endpoint, err := transport.NewEndpoint(cloneUrl)
+	if err != nil || endpoint.Protocol != "file" {
+		return ""
+	}
+
+	localPath, err := filepath.Abs(endpoint.Path)
+	if err != nil {
+		return filepath.Clean(endpoint.Path)
+	}
+
+	return localPath
+}
+
+// GitDir returns the directory with the refs of a local repository, which is the repository itself if it is bare
+func GitDir(localRepoPath string) string {
+	dotGit := filepath.Join(localRepoPath, git.GitDirName)
+	if info, err := os.Stat(dotGit); err == nil && info.IsDir() {
+		return dotGit
+	}
+
+	return localRepoPath
+}
+
+func MakeLocalPath(localDir, cloneUrl, branchName string, suffixes ...string) string {
+	destinationPath := filepath.Join(localDir, MakeAPIName(cloneUrl, branchName, suffixes...))
 	_ = os.MkdirAll(destinationPath, 0664)
 	return destinationPath
 }
@@ -19,6 +68,11 @@ func MakeAPIName(cloneUrl, branchName string, suffixes ...string) string {
 		":", "#",
 		".git", "")
 
+	// paths and file:// urls of the same repository get the same name
+	if localPath := LocalRepoPath(cloneUrl); localPath != "" {
+		cloneUrl = "file" + strings.TrimSuffix(filepath.ToSlash(localPath), "/.git")
+	}
+
 	name := cloneUrl + "#" + branchName
 
 	if suffixes != nil {
@@ -0,0 +1,17 @@
+package gitrepo_test
+
+import (
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("MakeAPIName",
+	func(cloneUrl, branchName string, suffixes []string, expected string) {
+		Expect(gitrepo.MakeAPIName(cloneUrl, branchName, suffixes...)).To(Equal(expected))
+	},
+	Entry("ssh url", "git@github.com:LaCodon/recoon.git", "main", []string{"test/app"}, "github.com#LaCodon#recoon#main#test+app"),
+	Entry("bare repository", "/srv/git/app.git", "main", []string{"deploy"}, "file#srv#git#app#main#deploy"),
+	Entry("file url", "file:///srv/git/app.git", "main", []string{"deploy"}, "file#srv#git#app#main#deploy"),
+	Entry("repository directory", "file:///srv/app/.git/", "main", nil, "file#srv#app#main"),
+)
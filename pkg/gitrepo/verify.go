@@ -0,0 +1,185 @@
+package gitrepo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUnsigned is returned for commits without signature
+var ErrUnsigned = errors.New("commit is not signed")
+
+// ErrUntrusted is returned for commits which are not signed by a trusted key
+var ErrUntrusted = errors.New("commit is not signed by a trusted key")
+
+// sshsig constants, see https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigNamespace = "git"
+	sshSigArmorHead = "-----BEGIN SSH SIGNATURE-----"
+	sshSigArmorTail = "-----END SSH SIGNATURE-----"
+)
+
+// VerifyCommit checks that the commit of the repository at localPath is signed by one of the keys of the policy
+// and returns a description of the signing key
+func VerifyCommit(localPath, commitId string, policy *signaturev1.Policy) (string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(commitId))
+	if err != nil {
+		return "", err
+	}
+
+	if commit.PGPSignature == "" {
+		return "", ErrUnsigned
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return "", err
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return "", err
+	}
+	message, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(commit.PGPSignature), sshSigArmorHead) {
+		return verifySSHSignature(commit.PGPSignature, message, policy.SSHKeys)
+	}
+
+	for _, key := range policy.OpenPGPKeys {
+		entity, err := commit.Verify(key)
+		if err != nil {
+			continue
+		}
+
+		identity := entity.PrimaryKey.KeyIdString()
+		if primary := entity.PrimaryIdentity(); primary != nil {
+			identity = primary.Name + " " + identity
+		}
+
+		return "OpenPGP key " + identity, nil
+	}
+
+	return "", ErrUntrusted
+}
+
+// sshSignature is the blob of an armored SSH signature without the magic preamble
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data which the SSH signature is made over without the magic preamble
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// verifySSHSignature verifies an armored sshsig signature of the message with the namespace git
+func verifySSHSignature(armored string, message []byte, trustedKeys []string) (string, error) {
+	sig, err := parseSSHSignature(armored)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return "", errors.WithMessage(err, "invalid public key in SSH signature")
+	}
+
+	trusted := false
+	for _, key := range trustedKeys {
+		trustedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err == nil && bytes.Equal(trustedKey.Marshal(), publicKey.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return "", ErrUntrusted
+	}
+
+	if sig.Namespace != sshSigNamespace {
+		return "", errors.Errorf("SSH signature has namespace %q instead of %q", sig.Namespace, sshSigNamespace)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", errors.Errorf("unsupported hash algorithm %q of SSH signature", sig.HashAlgorithm)
+	}
+	h.Write(message)
+
+	signature := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, signature); err != nil {
+		return "", errors.WithMessage(err, "invalid SSH signature")
+	}
+
+	signed := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err := publicKey.Verify(signed, signature); err != nil {
+		return "", errors.WithMessage(err, "invalid SSH signature")
+	}
+
+	return "SSH key " + ssh.FingerprintSHA256(publicKey), nil
+}
+
+func parseSSHSignature(armored string) (*sshSignature, error) {
+	armored = strings.TrimSpace(armored)
+	if !strings.HasPrefix(armored, sshSigArmorHead) || !strings.HasSuffix(armored, sshSigArmorTail) {
+		return nil, errors.New("malformed SSH signature armor")
+	}
+
+	body := strings.TrimSuffix(strings.TrimPrefix(armored, sshSigArmorHead), sshSigArmorTail)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, errors.WithMessage(err, "malformed SSH signature")
+	}
+
+	if !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		return nil, errors.New("malformed SSH signature: missing magic preamble")
+	}
+
+	sig := &sshSignature{}
+	if err := ssh.Unmarshal(blob[len(sshSigMagic):], sig); err != nil {
+		return nil, errors.WithMessage(err, "malformed SSH signature")
+	}
+
+	if sig.Version != 1 {
+		return nil, errors.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+
+	return sig, nil
+}
@@ -0,0 +1,182 @@
+package gitrepo_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	signaturev1 "github.com/lacodon/recoon/pkg/api/v1/signature"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+)
+
+func newPGPKey(name string) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(entity.Serialize(w)).To(Succeed())
+	Expect(w.Close()).To(Succeed())
+
+	return entity, buf.String()
+}
+
+func newSSHKey() (ssh.Signer, string) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	signer, err := ssh.NewSignerFromKey(private)
+	Expect(err).NotTo(HaveOccurred())
+
+	return signer, string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+// signSSH creates an armored sshsig signature like ssh-keygen -Y sign -n git
+func signSSH(signer ssh.Signer, message []byte) string {
+	hash := sha512.Sum512(message)
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{"git", "", "sha512", hash[:]})...)
+
+	sig, err := signer.Sign(rand.Reader, signed)
+	Expect(err).NotTo(HaveOccurred())
+
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, signer.PublicKey().Marshal(), "git", "", "sha512", ssh.Marshal(sig)})...)
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	lines := []string{"-----BEGIN SSH SIGNATURE-----"}
+	for len(encoded) > 70 {
+		lines = append(lines, encoded[:70])
+		encoded = encoded[70:]
+	}
+	lines = append(lines, encoded, "-----END SSH SIGNATURE-----")
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var _ = Describe("VerifyCommit", func() {
+	var (
+		repoDir string
+		repo    *git.Repository
+	)
+
+	commit := func(signKey *openpgp.Entity) string {
+		Expect(os.WriteFile(filepath.Join(repoDir, "docker-compose.yml"), []byte(time.Now().String()), 0644)).To(Succeed())
+
+		worktree, err := repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("docker-compose.yml")
+		Expect(err).NotTo(HaveOccurred())
+
+		hash, err := worktree.Commit("update", &git.CommitOptions{
+			Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+			SignKey: signKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		return hash.String()
+	}
+
+	commitSSH := func(signer ssh.Signer) string {
+		c, err := repo.CommitObject(plumbing.NewHash(commit(nil)))
+		Expect(err).NotTo(HaveOccurred())
+
+		unsigned := &plumbing.MemoryObject{}
+		Expect(c.EncodeWithoutSignature(unsigned)).To(Succeed())
+		reader, err := unsigned.Reader()
+		Expect(err).NotTo(HaveOccurred())
+		message, err := io.ReadAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		c.PGPSignature = signSSH(signer, message)
+
+		signed := repo.Storer.NewEncodedObject()
+		Expect(c.Encode(signed)).To(Succeed())
+		hash, err := repo.Storer.SetEncodedObject(signed)
+		Expect(err).NotTo(HaveOccurred())
+
+		return hash.String()
+	}
+
+	BeforeEach(func() {
+		repoDir = GinkgoT().TempDir()
+
+		var err error
+		repo, err = git.PlainInit(repoDir, false)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should accept commits signed by a trusted OpenPGP key", func() {
+		entity, publicKey := newPGPKey("alice")
+		_, otherKey := newPGPKey("bob")
+
+		signer, err := gitrepo.VerifyCommit(repoDir, commit(entity), &signaturev1.Policy{OpenPGPKeys: []string{otherKey, publicKey}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer).To(ContainSubstring("alice"))
+	})
+
+	It("should accept commits signed by a trusted SSH key", func() {
+		sshSigner, publicKey := newSSHKey()
+
+		signer, err := gitrepo.VerifyCommit(repoDir, commitSSH(sshSigner), &signaturev1.Policy{SSHKeys: []string{publicKey}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer).To(Equal("SSH key " + ssh.FingerprintSHA256(sshSigner.PublicKey())))
+	})
+
+	It("should refuse unsigned commits", func() {
+		_, publicKey := newPGPKey("alice")
+
+		_, err := gitrepo.VerifyCommit(repoDir, commit(nil), &signaturev1.Policy{OpenPGPKeys: []string{publicKey}})
+		Expect(err).To(MatchError(gitrepo.ErrUnsigned))
+	})
+
+	It("should refuse commits signed by untrusted keys", func() {
+		entity, _ := newPGPKey("mallory")
+		_, trustedPGPKey := newPGPKey("alice")
+		sshSigner, _ := newSSHKey()
+		_, trustedSSHKey := newSSHKey()
+		policy := &signaturev1.Policy{OpenPGPKeys: []string{trustedPGPKey}, SSHKeys: []string{trustedSSHKey}}
+
+		_, err := gitrepo.VerifyCommit(repoDir, commit(entity), policy)
+		Expect(err).To(MatchError(gitrepo.ErrUntrusted))
+
+		_, err = gitrepo.VerifyCommit(repoDir, commitSSH(sshSigner), policy)
+		Expect(err).To(MatchError(gitrepo.ErrUntrusted))
+	})
+
+	It("should refuse tampered SSH signatures", func() {
+		sshSigner, publicKey := newSSHKey()
+		c, err := repo.CommitObject(plumbing.NewHash(commitSSH(sshSigner)))
+		Expect(err).NotTo(HaveOccurred())
+
+		c.Message = "tampered"
+		tampered := repo.Storer.NewEncodedObject()
+		Expect(c.Encode(tampered)).To(Succeed())
+		hash, err := repo.Storer.SetEncodedObject(tampered)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = gitrepo.VerifyCommit(repoDir, hash.String(), &signaturev1.Policy{SSHKeys: []string{publicKey}})
+		Expect(err).To(MatchError(ContainSubstring("invalid SSH signature")))
+	})
+})
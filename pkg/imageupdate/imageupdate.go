@@ -0,0 +1,274 @@
+// Package imageupdate polls the registries of the images of projects with image policies and pins newer matching
+// tags or changed digests in the project status, which redeploys the project.
+package imageupdate
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	projectcontroller "github.com/lacodon/recoon/pkg/controller/project"
+	"github.com/lacodon/recoon/pkg/eventrecorder"
+	"github.com/lacodon/recoon/pkg/registry"
+	"github.com/lacodon/recoon/pkg/semver"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Updater struct {
+	api      store.GetterSetter
+	registry *registry.Client
+	recorder *eventrecorder.Recorder
+	interval time.Duration
+}
+
+// NewUpdater returns a task which checks the images every interval; a zero interval disables the image update
+func NewUpdater(api store.GetterSetter, registryClient *registry.Client, interval time.Duration) *Updater {
+	return &Updater{
+		api:      api,
+		registry: registryClient,
+		recorder: eventrecorder.New(api),
+		interval: interval,
+	}
+}
+
+func (u *Updater) Run(ctx context.Context) error {
+	if u.interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	for {
+		t := time.NewTimer(u.interval)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+			if err := u.runOnce(ctx); err != nil {
+				logrus.WithError(err).Warn("failed to update images")
+			}
+		}
+	}
+}
+
+func (u *Updater) runOnce(ctx context.Context) error {
+	projects, err := u.api.List(projectv1.VersionKind)
+	if err != nil {
+		return errors.WithMessage(err, "failed to list projects")
+	}
+
+	for _, rawProject := range projects {
+		project := rawProject.(*projectv1.Project)
+		if project.Spec == nil || project.Status == nil {
+			continue
+		}
+
+		images, err := u.resolveImages(ctx, project)
+		if err != nil {
+			logrus.WithError(err).WithField("project", project.Name).Warn("failed to check images for updates")
+		}
+
+		if err := u.updateStatus(project, images); err != nil {
+			logrus.WithError(err).WithField("project", project.Name).Warn("failed to update images of project")
+		}
+	}
+
+	return nil
+}
+
+// resolveImages returns the pinned image of every service with image policy; services which fail to resolve keep their current image
+func (u *Updater) resolveImages(ctx context.Context, project *projectv1.Project) (map[string]string, error) {
+	images := make(map[string]string)
+	if project.Spec.Compose == nil || len(project.Spec.Compose.Images) == 0 {
+		return images, nil
+	}
+
+	opts, err := projectcontroller.ComposeOptions(u.api, project, project.Spec.LocalPath, project.Spec.CommitId)
+	if err != nil {
+		return project.Status.Images, err
+	}
+	// the policies apply to the images of the compose files, not to the ones pinned before
+	opts.Images = nil
+
+	composeProject, err := compose.LoadProject(opts)
+	if err != nil {
+		return project.Status.Images, err
+	}
+
+	var errs []string
+	for serviceName, policy := range project.Spec.Compose.Images {
+		service, err := composeProject.GetService(serviceName)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("service %s: not found", serviceName))
+			continue
+		}
+
+		pinned, err := u.resolveImage(ctx, service.Image, policy)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("service %s: %s", serviceName, err.Error()))
+			if current, ok := project.Status.Images[serviceName]; ok {
+				images[serviceName] = current
+			}
+			continue
+		}
+
+		images[serviceName] = pinned
+	}
+
+	if len(errs) > 0 {
+		return images, errors.New(strings.Join(errs, "; "))
+	}
+
+	return images, nil
+}
+
+// resolveImage returns the reference with tag and digest of the image the policy selects
+func (u *Updater) resolveImage(ctx context.Context, image string, policy composev1.ImagePolicy) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", errors.WithMessagef(err, "invalid image %q", image)
+	}
+
+	tag := "latest"
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+	named = reference.TrimNamed(named)
+
+	if policy.Semver != "" || policy.Pattern != "" {
+		tags, err := u.registry.Tags(ctx, named)
+		if err != nil {
+			return "", err
+		}
+
+		if tag, err = selectTag(policy, tags); err != nil {
+			return "", err
+		}
+	}
+
+	tagged, err := reference.WithTag(named, tag)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := u.registry.Digest(ctx, tagged)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.FamiliarString(tagged) + "@" + digest, nil
+}
+
+// updateStatus stores the images in the project status if they changed, retrying on concurrent updates
+func (u *Updater) updateStatus(project *projectv1.Project, images map[string]string) error {
+	if len(images) == 0 {
+		images = nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if reflect.DeepEqual(project.Status.Images, images) {
+			return nil
+		}
+
+		previous := project.Status.Images
+		project.Status.Images = images
+		if err = u.api.Update(project); err == nil {
+			for service, image := range images {
+				if previous[service] != image {
+					logrus.WithField("project", project.Name).Infof("update image of service %s to %s", service, image)
+					u.recorder.Record(project, "ImageUpdated", fmt.Sprintf("service %s: %s", service, image))
+				}
+			}
+			return nil
+		}
+
+		if !errors.Is(err, store.ErrObjectChanged) {
+			return err
+		}
+
+		// the project controller may update the project concurrently, so retry with the latest version
+		latest := &projectv1.Project{}
+		if err := u.api.Get(metav1.NamespaceName{Name: project.Name, Namespace: project.Namespace}, latest); err != nil {
+			return err
+		}
+		if latest.Status == nil {
+			return nil
+		}
+		project = latest
+	}
+
+	return err
+}
+
+// selectTag returns the highest of the tags matching the policy
+func selectTag(policy composev1.ImagePolicy, tags []string) (string, error) {
+	var semverRange semver.Range
+	if policy.Semver != "" {
+		var err error
+		if semverRange, err = semver.ParseRange(policy.Semver); err != nil {
+			return "", errors.WithMessagef(err, "invalid semver range %q", policy.Semver)
+		}
+	}
+
+	var pattern *regexp.Regexp
+	if policy.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(policy.Pattern); err != nil {
+			return "", errors.WithMessagef(err, "invalid pattern %q", policy.Pattern)
+		}
+	}
+
+	best := ""
+	for _, tag := range tags {
+		if pattern != nil && !pattern.MatchString(tag) {
+			continue
+		}
+
+		if semverRange != nil {
+			v, ok := semver.Parse(tag)
+			if !ok || !semverRange.Matches(v) {
+				continue
+			}
+		}
+
+		if best == "" || tagLess(best, tag) {
+			best = tag
+		}
+	}
+
+	if best == "" {
+		return "", errors.New("no tag matches the image policy")
+	}
+
+	return best, nil
+}
+
+// tagLess orders semantic versions by precedence above all other tags, which are ordered lexically
+func tagLess(a, b string) bool {
+	aVersion, aIsVersion := semver.Parse(a)
+	bVersion, bIsVersion := semver.Parse(b)
+
+	switch {
+	case aIsVersion && bIsVersion:
+		if c := aVersion.Compare(bVersion); c != 0 {
+			return c < 0
+		}
+		// v1.2.3 and 1.2.3 are equal, so keep the order stable
+		return a < b
+	case aIsVersion != bIsVersion:
+		return bIsVersion
+	default:
+		return a < b
+	}
+}
@@ -0,0 +1,13 @@
+package imageupdate_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestImageUpdate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Image Update Suite")
+}
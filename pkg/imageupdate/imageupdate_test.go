@@ -0,0 +1,172 @@
+package imageupdate_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	composev1 "github.com/lacodon/recoon/pkg/api/v1/compose"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/imageupdate"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/registry"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeRegistry serves the tags and manifest digests of the repository app and requires a bearer token like Docker Hub
+type fakeRegistry struct {
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+func (r *fakeRegistry) setDigest(tag, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.digests[tag] = digest
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0k"})
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer t0k" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+req.Host+`/token",service="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/v2/app/tags/list":
+		tags := make([]string, 0, len(r.digests))
+		for tag := range r.digests {
+			tags = append(tags, tag)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "app", "tags": tags})
+	case strings.HasPrefix(req.URL.Path, "/v2/app/manifests/"):
+		digest, ok := r.digests[strings.TrimPrefix(req.URL.Path, "/v2/app/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Updater", func() {
+	var (
+		api      *store.DefaultStore
+		fake     *fakeRegistry
+		server   *httptest.Server
+		host     string
+		cancel   context.CancelFunc
+		nn       = metav1.NamespaceName{Name: "app", Namespace: "project-app"}
+		localDir string
+	)
+
+	images := func() map[string]string {
+		p := &projectv1.Project{}
+		Expect(api.Get(nn, p)).To(Succeed())
+		return p.Status.Images
+	}
+
+	createProject := func(tag string, policy composev1.ImagePolicy) {
+		Expect(os.WriteFile(filepath.Join(localDir, "docker-compose.yml"), []byte(`
+services:
+  web:
+    image: `+host+`/app:`+tag+`
+`), 0644)).To(Succeed())
+
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+			Spec: &projectv1.Spec{
+				LocalPath:   localDir,
+				CommitId:    "c1",
+				ComposePath: ".",
+				Compose:     &composev1.Config{Images: map[string]composev1.ImagePolicy{"web": policy}},
+			},
+			Status: &projectv1.Status{},
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		localDir = GinkgoT().TempDir()
+		fake = &fakeRegistry{digests: map[string]string{
+			"1.1.0":         "sha256:110",
+			"1.2.0":         "sha256:120",
+			"1.3.1":         "sha256:131",
+			"1.4.0-rc.1":    "sha256:140rc1",
+			"2.0.0":         "sha256:200",
+			"latest":        "sha256:200",
+			"main-20230401": "sha256:m0401",
+			"main-20230315": "sha256:m0315",
+			"feature-123":   "sha256:f123",
+		}}
+		server = httptest.NewServer(fake)
+		host = strings.TrimPrefix(server.URL, "http://")
+
+		updater := imageupdate.NewUpdater(api, registry.New(nil), 10*time.Millisecond)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() { _ = updater.Run(ctx) }()
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+		time.Sleep(20 * time.Millisecond)
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should pin the highest tag in the semver range", func() {
+		createProject("1.1.0", composev1.ImagePolicy{Semver: "^1.2"})
+
+		Eventually(images).Should(Equal(map[string]string{"web": host + "/app:1.3.1@sha256:131"}))
+	})
+
+	It("should pin the highest tag matching the pattern", func() {
+		createProject("main-1", composev1.ImagePolicy{Pattern: "^main-"})
+
+		Eventually(images).Should(Equal(map[string]string{"web": host + "/app:main-20230401@sha256:m0401"}))
+	})
+
+	It("should follow the digest of the tag without semver and pattern", func() {
+		createProject("latest", composev1.ImagePolicy{})
+		Eventually(images).Should(Equal(map[string]string{"web": host + "/app:latest@sha256:200"}))
+
+		fake.setDigest("latest", "sha256:201")
+		Eventually(images).Should(Equal(map[string]string{"web": host + "/app:latest@sha256:201"}))
+	})
+
+	It("should keep the pinned image if no tag matches", func() {
+		createProject("1.1.0", composev1.ImagePolicy{Semver: "^1.2"})
+		Eventually(images).Should(HaveKey("web"))
+
+		p := &projectv1.Project{}
+		Expect(api.Get(nn, p)).To(Succeed())
+		p.Spec.Compose.Images["web"] = composev1.ImagePolicy{Semver: ">=3"}
+		Expect(api.Update(p)).To(Succeed())
+
+		Consistently(images, 100*time.Millisecond).Should(Equal(map[string]string{"web": host + "/app:1.3.1@sha256:131"}))
+	})
+})
@@ -4,8 +4,14 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	deploymentv1 "github.com/lacodon/recoon/pkg/api/v1/deployment"
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	knownhostv1 "github.com/lacodon/recoon/pkg/api/v1/knownhost"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
 	"github.com/lacodon/recoon/pkg/client"
 	"github.com/lacodon/recoon/pkg/config"
 	"github.com/lacodon/recoon/pkg/sshauth"
@@ -44,6 +50,30 @@ func InitStore(api *store.DefaultStore) error {
 		return err
 	}
 
+	if err := api.CreateBucket(eventv1.VersionKind.String()); err != nil {
+		return err
+	}
+
+	if err := api.CreateBucket(deploymentv1.VersionKind.String()); err != nil {
+		return err
+	}
+
+	if err := api.CreateBucket(secretv1.VersionKind.String()); err != nil {
+		return err
+	}
+
+	if err := api.CreateBucket(snapshotv1.VersionKind.String()); err != nil {
+		return err
+	}
+
+	if err := api.CreateBucket(reconcilev1.VersionKind.String()); err != nil {
+		return err
+	}
+
+	if err := api.CreateBucket(knownhostv1.VersionKind.String()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,246 @@
+// Package knownhosts verifies the SSH host keys of git hosts against the known hosts managed by recoon.
+package knownhosts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lacodon/recoon/pkg/api"
+	knownhostv1 "github.com/lacodon/recoon/pkg/api/v1/knownhost"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/eventrecorder"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrUnknownHost is returned for hosts without known host keys if trust on first use is disabled
+var ErrUnknownHost = errors.New("unknown SSH host")
+
+// ErrKeyMismatch is returned if the host presents a key which is neither known nor pinned
+var ErrKeyMismatch = errors.New("SSH host key mismatch")
+
+// ScanTimeout limits the connection attempts of Scan
+const ScanTimeout = 10 * time.Second
+
+type KnownHosts struct {
+	api             store.GetterSetter
+	recorder        *eventrecorder.Recorder
+	trustOnFirstUse bool
+}
+
+// New returns the known hosts of the store; with trustOnFirstUse, the key of an unknown host is accepted and stored
+// on the first connection
+func New(api store.GetterSetter, trustOnFirstUse bool) *KnownHosts {
+	return &KnownHosts{
+		api:             api,
+		recorder:        eventrecorder.New(api),
+		trustOnFirstUse: trustOnFirstUse,
+	}
+}
+
+// Name returns the name of the known host object of the address, e.g. github.com or [git.example.com]:2222
+func Name(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	return knownhosts.Normalize(address)
+}
+
+// HostKeyCallback accepts the host keys pinned by a repository or, without pinned keys, the known host keys. Keys
+// which are trusted on first use are reported as event of the involved object.
+func (k *KnownHosts) HostKeyCallback(involved api.Object, pinned []string) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		host := Name(hostname)
+
+		if len(pinned) > 0 {
+			if containsKey(pinned, key) {
+				return nil
+			}
+
+			return errors.WithMessagef(ErrKeyMismatch, "%s key %s of %s is not pinned by the repository",
+				key.Type(), ssh.FingerprintSHA256(key), host)
+		}
+
+		known := &knownhostv1.KnownHost{}
+		err := k.api.Get(metav1.NamespaceName{Name: host, Namespace: knownhostv1.Namespace}, known)
+		if err == nil {
+			if known.Spec != nil && containsKey(known.Spec.Keys, key) {
+				return nil
+			}
+
+			return errors.WithMessagef(ErrKeyMismatch, "%s key %s of %s is not known", key.Type(), ssh.FingerprintSHA256(key), host)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		if !k.trustOnFirstUse {
+			return errors.WithMessagef(ErrUnknownHost, "%s; add it with recoonctl known-hosts add %s", host, host)
+		}
+
+		return k.trust(involved, host, key)
+	}
+}
+
+// trust stores the key of a host which connects for the first time
+func (k *KnownHosts) trust(involved api.Object, host string, key ssh.PublicKey) error {
+	if err := k.api.Create(&knownhostv1.KnownHost{
+		TypeMeta:   metav1.TypeMeta{Version: knownhostv1.VersionKind.Version, Kind: knownhostv1.VersionKind.Kind},
+		ObjectMeta: metav1.ObjectMeta{Name: host, Namespace: knownhostv1.Namespace},
+		Spec: &knownhostv1.Spec{
+			Keys:              []string{MarshalKey(key)},
+			TrustedOnFirstUse: true,
+		},
+	}); err != nil {
+		if errors.Is(err, store.ErrAlreadyExists) {
+			// another connection was first, so the key has to match its one
+			return k.HostKeyCallback(involved, nil)(host, nil, key)
+		}
+
+		return errors.WithMessage(err, "failed to store known host")
+	}
+
+	message := fmt.Sprintf("trusted %s key %s of %s on first use", key.Type(), ssh.FingerprintSHA256(key), host)
+	logrus.WithField("host", host).Warn(message)
+	if involved != nil {
+		k.recorder.Record(involved, "HostKeyTrusted", message)
+	}
+
+	return nil
+}
+
+// Seed stores the host keys of the known_hosts file, e.g. the SSH_KNOWN_HOSTS file which was used before the known
+// hosts were managed by recoon, if no known hosts are stored yet. Hashed host names, wildcards and markers like
+// @cert-authority can't be stored and are skipped.
+func Seed(api store.GetterSetter, file string) error {
+	list, err := api.List(knownhostv1.VersionKind, store.InNamespace(knownhostv1.Namespace))
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return errors.WithMessage(err, "failed to read known hosts file")
+	}
+
+	keys := make(map[string][]string)
+	hosts := make([]string, 0)
+	skipped := 0
+	for len(data) > 0 {
+		marker, entryHosts, key, _, rest, err := ssh.ParseKnownHosts(data)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "failed to parse known hosts file %s", file)
+		}
+		data = rest
+
+		for _, host := range entryHosts {
+			if marker != "" || strings.HasPrefix(host, "|") || strings.ContainsAny(host, "*?!") {
+				skipped++
+				continue
+			}
+
+			name := Name(host)
+			if _, ok := keys[name]; !ok {
+				hosts = append(hosts, name)
+			}
+			if !containsKey(keys[name], key) {
+				keys[name] = append(keys[name], MarshalKey(key))
+			}
+		}
+	}
+
+	for _, host := range hosts {
+		if err := api.Create(&knownhostv1.KnownHost{
+			TypeMeta:   metav1.TypeMeta{Version: knownhostv1.VersionKind.Version, Kind: knownhostv1.VersionKind.Kind},
+			ObjectMeta: metav1.ObjectMeta{Name: host, Namespace: knownhostv1.Namespace},
+			Spec:       &knownhostv1.Spec{Keys: keys[host]},
+		}); err != nil {
+			return errors.WithMessagef(err, "failed to store known host %s", host)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"file": file, "hosts": hosts, "skipped": skipped}).Info("seeded known hosts")
+	return nil
+}
+
+// Scan connects to the address and returns the host keys which it presents, one per supported key type
+func Scan(address string) ([]ssh.PublicKey, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	keys := make([]ssh.PublicKey, 0)
+	var lastErr error
+	for _, algorithm := range []string{ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoRSASHA512} {
+		var hostKey ssh.PublicKey
+		client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+			User:              "git",
+			HostKeyAlgorithms: []string{algorithm},
+			HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+				hostKey = key
+				// abort the handshake, the key is all we need
+				return errors.New("scanned")
+			},
+			Timeout: ScanTimeout,
+		})
+		if client != nil {
+			_ = client.Close()
+		}
+
+		if hostKey == nil {
+			lastErr = err
+			continue
+		}
+
+		if !containsKey(marshalKeys(keys), hostKey) {
+			keys = append(keys, hostKey)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.WithMessagef(lastErr, "failed to scan host keys of %s", address)
+	}
+
+	return keys, nil
+}
+
+// MarshalKey returns the key in authorized_keys format without newline
+func MarshalKey(key ssh.PublicKey) string {
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(key)))
+}
+
+func marshalKeys(keys []ssh.PublicKey) []string {
+	marshaled := make([]string, 0, len(keys))
+	for _, key := range keys {
+		marshaled = append(marshaled, MarshalKey(key))
+	}
+
+	return marshaled
+}
+
+// containsKey tells whether key is one of the keys in authorized_keys format
+func containsKey(keys []string, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err == nil && bytes.Equal(parsed.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,13 @@
+package knownhosts_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestKnownHosts(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "KnownHosts Suite")
+}
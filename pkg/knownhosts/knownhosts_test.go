@@ -0,0 +1,138 @@
+package knownhosts_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	knownhostv1 "github.com/lacodon/recoon/pkg/api/v1/knownhost"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey() ssh.PublicKey {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	key, err := ssh.NewPublicKey(public)
+	Expect(err).NotTo(HaveOccurred())
+
+	return key
+}
+
+var _ = Describe("KnownHosts", func() {
+	var (
+		api      *store.DefaultStore
+		repo     *repositoryv1.Repository
+		hostKey  ssh.PublicKey
+		otherKey ssh.PublicKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		repo = &repositoryv1.Repository{
+			TypeMeta:   metav1.TypeMeta{Version: repositoryv1.VersionKind.Version, Kind: repositoryv1.VersionKind.Kind},
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		}
+		hostKey = newHostKey()
+		otherKey = newHostKey()
+	})
+
+	AfterEach(func() {
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should name hosts like known_hosts", func() {
+		Expect(knownhosts.Name("github.com")).To(Equal("github.com"))
+		Expect(knownhosts.Name("github.com:22")).To(Equal("github.com"))
+		Expect(knownhosts.Name("git.example.com:2222")).To(Equal("[git.example.com]:2222"))
+		Expect(knownhosts.Name("[git.example.com]:2222")).To(Equal("[git.example.com]:2222"))
+	})
+
+	It("should refuse unknown hosts without trust on first use", func() {
+		callback := knownhosts.New(api, false).HostKeyCallback(repo, nil)
+		Expect(callback("github.com:22", nil, hostKey)).To(MatchError(knownhosts.ErrUnknownHost))
+	})
+
+	It("should trust unknown hosts on first use and refuse other keys afterwards", func() {
+		callback := knownhosts.New(api, true).HostKeyCallback(repo, nil)
+		Expect(callback("github.com:22", nil, hostKey)).To(Succeed())
+		Expect(callback("github.com:22", nil, hostKey)).To(Succeed())
+		Expect(callback("github.com:22", nil, otherKey)).To(MatchError(knownhosts.ErrKeyMismatch))
+
+		knownHost := &knownhostv1.KnownHost{}
+		Expect(api.Get(metav1.NamespaceName{Name: "github.com", Namespace: knownhostv1.Namespace}, knownHost)).To(Succeed())
+		Expect(knownHost.Spec.TrustedOnFirstUse).To(BeTrue())
+		Expect(knownHost.Spec.Keys).To(Equal([]string{knownhosts.MarshalKey(hostKey)}))
+
+		events, err := api.List(eventv1.VersionKind, store.InNamespace("default"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].(*eventv1.Event).Reason).To(Equal("HostKeyTrusted"))
+	})
+
+	It("should only accept the keys pinned by the repository", func() {
+		Expect(api.Create(&knownhostv1.KnownHost{
+			ObjectMeta: metav1.ObjectMeta{Name: "github.com", Namespace: knownhostv1.Namespace},
+			Spec:       &knownhostv1.Spec{Keys: []string{knownhosts.MarshalKey(hostKey)}},
+		})).To(Succeed())
+
+		callback := knownhosts.New(api, true).HostKeyCallback(repo, []string{knownhosts.MarshalKey(otherKey)})
+		Expect(callback("github.com:22", nil, otherKey)).To(Succeed())
+		Expect(callback("github.com:22", nil, hostKey)).To(MatchError(knownhosts.ErrKeyMismatch))
+	})
+
+	Context("seeding from a known_hosts file", func() {
+		const file = "testdata/known_hosts"
+
+		parseKey := func(key string) ssh.PublicKey {
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+			Expect(err).NotTo(HaveOccurred())
+			return parsed
+		}
+
+		BeforeEach(func() {
+			// the keys of testdata/known_hosts
+			hostKey = parseKey("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEj6F3+6ba6bYGi/4LNkrLPo5is8RpNC3eQi/kInSOZo")
+			otherKey = parseKey("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJmeYyh3hT0ymAnVCbR15UWngydkEHAYVUJ1v8l0IyzY")
+		})
+
+		It("should store the keys of the named hosts", func() {
+			Expect(knownhosts.Seed(api, file)).To(Succeed())
+
+			list, err := api.List(knownhostv1.VersionKind, store.InNamespace(knownhostv1.Namespace))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(HaveLen(2))
+
+			callback := knownhosts.New(api, false).HostKeyCallback(repo, nil)
+			Expect(callback("github.com:22", nil, hostKey)).To(Succeed())
+			Expect(callback("github.com:22", nil, otherKey)).To(Succeed())
+			Expect(callback("git.example.com:2222", nil, otherKey)).To(Succeed())
+			Expect(callback("git.example.com:2222", nil, hostKey)).To(MatchError(knownhosts.ErrKeyMismatch))
+			Expect(callback("gitlab.com:22", nil, otherKey)).To(MatchError(knownhosts.ErrUnknownHost))
+		})
+
+		It("should not seed if known hosts are stored already", func() {
+			Expect(api.Create(&knownhostv1.KnownHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "gitlab.com", Namespace: knownhostv1.Namespace},
+				Spec:       &knownhostv1.Spec{Keys: []string{knownhosts.MarshalKey(hostKey)}},
+			})).To(Succeed())
+
+			Expect(knownhosts.Seed(api, file)).To(Succeed())
+
+			callback := knownhosts.New(api, false).HostKeyCallback(repo, nil)
+			Expect(callback("github.com:22", nil, hostKey)).To(MatchError(knownhosts.ErrUnknownHost))
+		})
+	})
+})
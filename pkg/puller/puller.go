@@ -5,115 +5,162 @@ import (
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
 	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/credentials"
 	"github.com/lacodon/recoon/pkg/gitrepo"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/reconcile"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Request asks the puller to pull immediately
+type Request struct {
+	// Repositories limits the pull to these repositories; all repositories are pulled if it is empty
+	Repositories []metav1.NamespaceName
+	// ID is the reconcile request whose progress gets tracked; it is empty for untracked requests
+	ID string
+}
+
 type Puller struct {
 	api                    store.GetterSetter
-	immediateReconcile     <-chan bool
+	immediateReconcile     <-chan Request
 	gitDir                 string
 	sshKeyDir              string
+	knownHosts             *knownhosts.KnownHosts
 	reconciliationInterval time.Duration
+	requests               *reconcile.Tracker
+
+	started time.Time
+	// maps the keys of the repository groups to the time of their last pull
+	lastPull map[string]time.Time
 }
 
-func NewPuller(api store.GetterSetter, immediateReconcile <-chan bool, gitDir, sshKeyDir string, reconciliationInterval time.Duration) *Puller {
+// minPullDelay limits how often the puller wakes up for repositories with short intervals
+const minPullDelay = time.Second
+
+func NewPuller(api store.GetterSetter, immediateReconcile <-chan Request, gitDir, sshKeyDir string, knownHosts *knownhosts.KnownHosts, reconciliationInterval time.Duration) *Puller {
 	return &Puller{
 		api:                    api,
 		immediateReconcile:     immediateReconcile,
 		gitDir:                 gitDir,
 		sshKeyDir:              sshKeyDir,
+		knownHosts:             knownHosts,
 		reconciliationInterval: reconciliationInterval,
+		requests:               reconcile.New(api),
+		lastPull:               make(map[string]time.Time),
 	}
 }
 
 func (p *Puller) Run(ctx context.Context) error {
+	p.started = time.Now()
+
 	for {
-		t := time.NewTimer(p.reconciliationInterval)
+		t := time.NewTimer(p.untilNextPull(time.Now()))
 
 		select {
 		case <-ctx.Done():
 			return nil
 		case <-t.C:
-			if err := p.runOnce(ctx); err != nil {
+			if _, err := p.runOnce(ctx, Request{}); err != nil {
 				logrus.WithError(err).Warn("failed to update/pull app repositories")
 			}
-		case <-p.immediateReconcile:
+		case req := <-p.immediateReconcile:
 			t.Stop()
-			logrus.Info("got immediate reconcile event")
-			if err := p.runOnce(ctx); err != nil {
+			logrus.WithField("repositories", req.Repositories).Info("got immediate reconcile event")
+			p.requests.Start(req.ID)
+			commitId, err := p.runOnce(ctx, req)
+			if err != nil {
 				logrus.WithError(err).Warn("failed to update/pull app repositories")
 			}
+			p.requests.Finish(req.ID, commitId, err)
 		}
 	}
 }
 
-func (p *Puller) runOnce(ctx context.Context) error {
-	projects, err := p.api.List(projectv1.VersionKind)
-	if err != nil {
-		return errors.WithMessage(err, "failed to list projects")
+// runOnce pulls the requested repositories or, without requested repositories, the ones whose interval elapsed and
+// returns the current commit if a single repository is requested. The error lists the repositories which couldn't be
+// pulled.
+func (p *Puller) runOnce(ctx context.Context, req Request) (string, error) {
+	requested := make(map[metav1.NamespaceName]bool, len(req.Repositories))
+	for _, nn := range req.Repositories {
+		requested[nn] = true
 	}
 
-	// maps localPath to apiRepos
-	repoMap := make(map[string][]*repositoryv1.Repository)
-	for _, rawProject := range projects {
-		project := rawProject.(*projectv1.Project)
-
-		if project.Spec == nil {
-			continue
-		}
+	repoMap, err := p.groupRepositories()
+	if err != nil {
+		return "", err
+	}
 
-		repo := &repositoryv1.Repository{}
-		if err := p.api.Get(metav1.NamespaceName{
-			Name:      project.Spec.Repo.Name,
-			Namespace: project.Spec.Repo.Namespace,
-		}, repo); err != nil {
-			_ = p.api.Delete(projectv1.VersionKind, metav1.NamespaceName{
-				Name:      project.Name,
-				Namespace: project.Namespace,
-			})
+	commitId := ""
+	failed := make([]string, 0)
+	found := make(map[metav1.NamespaceName]bool, len(requested))
+	now := time.Now()
+	for key, repos := range repoMap {
+		if len(requested) > 0 && !containsAny(repos, requested) {
 			continue
 		}
 
-		if repo.Status == nil {
+		if len(requested) == 0 && now.Add(minPullDelay).Before(p.lastPulled(key).Add(interval(repos, p.reconciliationInterval))) {
 			continue
 		}
 
-		if _, ok := repoMap[repo.Status.LocalPath]; !ok {
-			repoMap[repo.Status.LocalPath] = make([]*repositoryv1.Repository, 0)
+		for _, repo := range repos {
+			found[repo.GetNamespaceName()] = true
 		}
+		// failed pulls are retried after the interval as well
+		p.lastPull[key] = now
 
-		repoMap[repo.Status.LocalPath] = append(repoMap[repo.Status.LocalPath], repo)
-	}
-
-	for _, repos := range repoMap {
 		// only pull once but update all api objects
 		pullRepo := repos[0]
 
+		auth, err := credentials.Auth(p.api, pullRepo)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to load credentials of repo")
+			failed = append(failed, pullRepo.GetName()+": "+err.Error())
+			continue
+		}
+
 		ctxTimeout, cancel := context.WithTimeout(ctx, 2*time.Minute)
-		localRepo, err := gitrepo.NewGitRepository(ctxTimeout, p.gitDir, pullRepo.Spec.Url, pullRepo.Spec.Branch, p.sshKeyDir)
+		localRepo, err := gitrepo.NewGitRepository(ctxTimeout, p.gitDir, pullRepo.Spec.Url, pullRepo.Spec.Branch, p.sshKeyDir,
+			gitrepo.WithRef(pullRepo.Spec.Ref),
+			gitrepo.WithAuth(auth),
+			gitrepo.WithHostKeyCallback(p.knownHosts.HostKeyCallback(pullRepo, pullRepo.Spec.HostKeys)),
+			gitrepo.WithDepth(pullRepo.Spec.Depth),
+			gitrepo.WithSparseCheckout(pullRepo.Spec.GetSparseCheckoutDirectories()))
 		if err != nil {
 			logrus.WithError(err).Warn("failed to init git repo")
+			failed = append(failed, pullRepo.GetName()+": "+err.Error())
 			cancel()
 			continue
 		}
 
 		if err := localRepo.Pull(ctxTimeout); err != nil {
 			logrus.WithError(err).Warn("failed to pull repo")
+			failed = append(failed, pullRepo.GetName()+": "+err.Error())
 			cancel()
 			continue
 		}
 
+		if len(requested) == 1 {
+			commitId = localRepo.GetCurrentCommitId()
+		}
+
 		for _, repo := range repos {
-			if repo.Status.CurrentCommitId == localRepo.GetCurrentCommitId() {
+			if repo.Status.CurrentCommitId == localRepo.GetCurrentCommitId() &&
+				repo.Status.ResolvedRef == localRepo.GetResolvedRef() &&
+				repo.Status.LocalPath == localRepo.GetLocalPath() {
 				continue
 			}
 
 			repo.Status.CurrentCommitId = localRepo.GetCurrentCommitId()
+			repo.Status.ResolvedRef = localRepo.GetResolvedRef()
+			repo.Status.LocalPath = localRepo.GetLocalPath()
 			if err := p.api.Update(repo); err != nil {
 				if errors.Is(err, store.ErrNotFound) {
 					// maybe repo has been deleted in the meantime -> remove files on disk
@@ -129,5 +176,130 @@ func (p *Puller) runOnce(ctx context.Context) error {
 		cancel()
 	}
 
-	return nil
+	for nn := range requested {
+		if found[nn] {
+			continue
+		}
+
+		repo := &repositoryv1.Repository{}
+		if err := p.api.Get(nn, repo); err == nil && repo.Spec != nil && repo.Spec.Suspend {
+			failed = append(failed, nn.Name+": repository is suspended")
+		} else {
+			failed = append(failed, nn.Name+": repository has not been cloned for a project yet")
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return commitId, errors.New("failed to pull " + strings.Join(failed, "; "))
+	}
+
+	return commitId, nil
+}
+
+// groupRepositories returns the repositories of the projects grouped by their clone; projects whose repository is
+// gone are deleted
+func (p *Puller) groupRepositories() (map[string][]*repositoryv1.Repository, error) {
+	projects, err := p.api.List(projectv1.VersionKind)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to list projects")
+	}
+
+	// maps localPath to apiRepos
+	repoMap := make(map[string][]*repositoryv1.Repository)
+	for _, rawProject := range projects {
+		project := rawProject.(*projectv1.Project)
+
+		if project.Spec == nil {
+			continue
+		}
+
+		repo := &repositoryv1.Repository{}
+		if err := p.api.Get(metav1.NamespaceName{
+			Name:      project.Spec.Repo.Name,
+			Namespace: project.Spec.Repo.Namespace,
+		}, repo); err != nil {
+			_ = p.api.Delete(projectv1.VersionKind, metav1.NamespaceName{
+				Name:      project.Name,
+				Namespace: project.Namespace,
+			})
+			continue
+		}
+
+		if repo.Status == nil || repo.Spec.Suspend {
+			continue
+		}
+
+		// repositories with the same source share their clone
+		key := strings.Join([]string{repo.Spec.Url, repo.Spec.Branch, repo.Spec.Ref.String(), strconv.Itoa(repo.Spec.Depth),
+			strings.Join(repo.Spec.GetSparseCheckoutDirectories(), ",")}, "#")
+		repoMap[key] = append(repoMap[key], repo)
+	}
+
+	return repoMap, nil
+}
+
+// untilNextPull returns the time until the interval of a repository elapses, at most the reconciliation interval
+func (p *Puller) untilNextPull(now time.Time) time.Duration {
+	next := p.reconciliationInterval
+
+	repoMap, err := p.groupRepositories()
+	if err != nil {
+		return next
+	}
+
+	for key := range p.lastPull {
+		if _, ok := repoMap[key]; !ok {
+			delete(p.lastPull, key)
+		}
+	}
+
+	for key, repos := range repoMap {
+		if wait := p.lastPulled(key).Add(interval(repos, p.reconciliationInterval)).Sub(now); wait < next {
+			next = wait
+		}
+	}
+
+	if next < minPullDelay {
+		return minPullDelay
+	}
+
+	return next
+}
+
+// lastPulled returns the time of the last pull of the group or the start of the puller if it hasn't been pulled yet
+func (p *Puller) lastPulled(key string) time.Time {
+	if last, ok := p.lastPull[key]; ok {
+		return last
+	}
+
+	return p.started
+}
+
+// interval returns the shortest interval of the repositories, which share a clone; the interval of a repository
+// defaults to the reconciliation interval, but may be longer as well
+func interval(repos []*repositoryv1.Repository, defaultInterval time.Duration) time.Duration {
+	if len(repos) == 0 {
+		return defaultInterval
+	}
+
+	shortest := repos[0].Spec.GetInterval(defaultInterval)
+	for _, repo := range repos[1:] {
+		if repoInterval := repo.Spec.GetInterval(defaultInterval); repoInterval < shortest {
+			shortest = repoInterval
+		}
+	}
+
+	return shortest
+}
+
+// containsAny tells whether one of the repositories is requested
+func containsAny(repos []*repositoryv1.Repository, requested map[metav1.NamespaceName]bool) bool {
+	for _, repo := range repos {
+		if requested[repo.GetNamespaceName()] {
+			return true
+		}
+	}
+
+	return false
 }
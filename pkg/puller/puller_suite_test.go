@@ -0,0 +1,13 @@
+package puller_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPuller(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Puller Suite")
+}
@@ -0,0 +1,101 @@
+package puller_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Puller", func() {
+	var (
+		api    *store.DefaultStore
+		cancel context.CancelFunc
+	)
+
+	// createRepo creates a remote with a single commit and the repository and project of it
+	createRepo := func(name, interval string) string {
+		remoteDir := GinkgoT().TempDir()
+		remote, err := git.PlainInit(remoteDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(remoteDir, "docker-compose.yml"), []byte("services: {}\n"), 0644)).To(Succeed())
+		worktree, err := remote.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("docker-compose.yml")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := worktree.Commit("initial", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(api.Create(&repositoryv1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: &repositoryv1.Spec{
+				ProjectName: name,
+				Url:         remoteDir,
+				Branch:      "master",
+				Path:        ".",
+				Interval:    interval,
+			},
+			Status: &repositoryv1.Status{},
+		})).To(Succeed())
+
+		Expect(api.Create(&projectv1.Project{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "project-" + name},
+			Spec: &projectv1.Spec{
+				Repo: metav1.ObjectRef{Name: name, Namespace: "default"},
+			},
+		})).To(Succeed())
+
+		return hash.String()
+	}
+
+	currentCommitId := func(name string) func() string {
+		return func() string {
+			repo := &repositoryv1.Repository{}
+			Expect(api.Get(metav1.NamespaceName{Name: name, Namespace: "default"}, repo)).To(Succeed())
+			return repo.Status.CurrentCommitId
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+		// give the puller time to stop before the store is closed
+		time.Sleep(20 * time.Millisecond)
+		Expect(api.Close()).To(Succeed())
+	})
+
+	It("should pull repositories with an interval longer than the reconciliation interval less often", func() {
+		defaultHash := createRepo("default", "")
+		createRepo("hourly", "1h")
+
+		p := puller.NewPuller(api, make(chan puller.Request), GinkgoT().TempDir(), GinkgoT().TempDir(),
+			knownhosts.New(api, false), time.Second)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() { _ = p.Run(ctx) }()
+
+		Eventually(currentCommitId("default"), 3*time.Second).Should(Equal(defaultHash))
+		Consistently(currentCommitId("hourly"), 2*time.Second).Should(BeEmpty())
+	})
+})
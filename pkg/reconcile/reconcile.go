@@ -0,0 +1,120 @@
+// Package reconcile records the progress of immediate reconcile requests, so that clients can wait for their outcome.
+package reconcile
+
+import (
+	"fmt"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// Retention is how long finished requests are kept
+const Retention = time.Hour
+
+type Tracker struct {
+	api store.GetterSetter
+}
+
+func New(api store.GetterSetter) *Tracker {
+	return &Tracker{
+		api: api,
+	}
+}
+
+// Create records a new pending request for the target and removes the requests which finished before Retention
+func (t *Tracker) Create(target, name string) (*reconcilev1.Reconcile, error) {
+	now := time.Now()
+	request := &reconcilev1.Reconcile{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%x", now.UnixNano()),
+			Namespace: reconcilev1.Namespace,
+		},
+		Spec: &reconcilev1.Spec{
+			Target: target,
+			Name:   name,
+		},
+		Status: &reconcilev1.Status{
+			Phase:     reconcilev1.PhasePending,
+			CreatedAt: now,
+		},
+	}
+
+	if err := t.api.Create(request); err != nil {
+		return nil, errors.WithMessage(err, "failed to create reconcile request")
+	}
+
+	t.prune(now)
+	return request, nil
+}
+
+// Start marks the request as running; requests without id are not tracked
+func (t *Tracker) Start(id string) {
+	t.update(id, func(status *reconcilev1.Status) {
+		status.Phase = reconcilev1.PhaseRunning
+	})
+}
+
+// Finish marks the request as failed with err or as succeeded with the pulled or deployed commit
+func (t *Tracker) Finish(id, commitId string, err error) {
+	t.update(id, func(status *reconcilev1.Status) {
+		now := time.Now()
+		status.EndTime = &now
+		status.CommitId = commitId
+		status.Phase = reconcilev1.PhaseSucceeded
+		if err != nil {
+			status.Phase = reconcilev1.PhaseFailed
+			status.Message = err.Error()
+		}
+	})
+}
+
+func (t *Tracker) update(id string, mutate func(status *reconcilev1.Status)) {
+	if id == "" {
+		return
+	}
+
+	for {
+		request := &reconcilev1.Reconcile{}
+		if err := t.api.Get(metav1.NamespaceName{Name: id, Namespace: reconcilev1.Namespace}, request); err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				logrus.WithError(err).WithField("request", id).Warn("failed to get reconcile request")
+			}
+			return
+		}
+
+		if request.IsFinished() {
+			return
+		}
+
+		if request.Status == nil {
+			request.Status = &reconcilev1.Status{}
+		}
+		mutate(request.Status)
+
+		err := t.api.Update(request)
+		if errors.Is(err, store.ErrObjectChanged) {
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("request", id).Warn("failed to update reconcile request")
+		}
+		return
+	}
+}
+
+func (t *Tracker) prune(now time.Time) {
+	list, err := t.api.List(reconcilev1.VersionKind, store.InNamespace(reconcilev1.Namespace))
+	if err != nil {
+		return
+	}
+
+	for _, el := range list {
+		request := el.(*reconcilev1.Reconcile)
+		if request.IsFinished() && request.Status.EndTime != nil && now.Sub(*request.Status.EndTime) > Retention {
+			_ = t.api.Delete(reconcilev1.VersionKind, request.GetNamespaceName())
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package refwatch pulls local repositories as soon as their refs change instead of waiting for the reconciliation
+// interval, e.g. after a push into a bare repository on an air-gapped host.
+package refwatch
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/controller/configrepo"
+	"github.com/lacodon/recoon/pkg/gitrepo"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ResyncInterval is how often the watched repositories are matched with the repository objects
+const ResyncInterval = 30 * time.Second
+
+// settleDelay collects the ref updates of a push into a single pull
+const settleDelay = 500 * time.Millisecond
+
+type Watcher struct {
+	api           store.Getter
+	enabled       bool
+	pullTrigger   chan<- puller.Request
+	configTrigger chan<- string
+
+	fsWatcher *fsnotify.Watcher
+	// maps the watched directories to the git directory they belong to
+	watched map[string]string
+}
+
+func NewWatcher(api store.Getter, enabled bool, pullTrigger chan<- puller.Request, configTrigger chan<- string) *Watcher {
+	return &Watcher{
+		api:           api,
+		enabled:       enabled,
+		pullTrigger:   pullTrigger,
+		configTrigger: configTrigger,
+		watched:       make(map[string]string),
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context) error {
+	if !w.enabled {
+		<-ctx.Done()
+		return nil
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.WithMessage(err, "failed to watch local repositories")
+	}
+	defer func() { _ = fsWatcher.Close() }()
+	w.fsWatcher = fsWatcher
+
+	resync := time.NewTicker(ResyncInterval)
+	defer resync.Stop()
+
+	settle := time.NewTimer(settleDelay)
+	settle.Stop()
+
+	changed := make(map[string]bool)
+	w.resync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resync.C:
+			w.resync()
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if gitDir := w.handleEvent(event); gitDir != "" {
+				changed[gitDir] = true
+				settle.Reset(settleDelay)
+			}
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			logrus.WithError(err).Warn("failed to watch local repositories")
+		case <-settle.C:
+			w.trigger(ctx, changed)
+			changed = make(map[string]bool)
+		}
+	}
+}
+
+// handleEvent watches new ref directories and returns the git directory whose refs changed, if any
+func (w *Watcher) handleEvent(event fsnotify.Event) string {
+	gitDir, ok := w.watched[filepath.Dir(event.Name)]
+	if !ok || strings.HasSuffix(event.Name, ".lock") {
+		return ""
+	}
+
+	// the git directory itself is watched for packed refs and HEAD but also contains the index, logs, ...
+	if filepath.Dir(event.Name) == gitDir && filepath.Base(event.Name) != "packed-refs" && filepath.Base(event.Name) != "HEAD" {
+		return ""
+	}
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// fsnotify stops watching removed directories by itself
+		if _, ok := w.watched[event.Name]; ok && event.Name != gitDir {
+			delete(w.watched, event.Name)
+		}
+	}
+
+	if event.Has(fsnotify.Create) {
+		// e.g. refs/heads/feature/ for the first branch named feature/...
+		w.watchTree(event.Name, gitDir)
+	}
+
+	return gitDir
+}
+
+// resync watches the git directories of new local repositories and stops watching the ones of deleted repositories
+func (w *Watcher) resync() {
+	gitDirs, err := w.localGitDirs()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list local repositories")
+		return
+	}
+
+	for dir, gitDir := range w.watched {
+		if _, ok := gitDirs[gitDir]; !ok {
+			_ = w.fsWatcher.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+
+	for gitDir := range gitDirs {
+		if _, ok := w.watched[gitDir]; ok {
+			continue
+		}
+
+		if err := w.fsWatcher.Add(gitDir); err != nil {
+			// e.g. the repository doesn't exist yet, which the pull reports
+			logrus.WithError(err).WithField("path", gitDir).Debug("failed to watch local repository")
+			continue
+		}
+		w.watched[gitDir] = gitDir
+		w.watchTree(filepath.Join(gitDir, "refs"), gitDir)
+	}
+}
+
+// watchTree watches dir and all directories below it
+func (w *Watcher) watchTree(dir, gitDir string) {
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+
+		if _, ok := w.watched[path]; ok {
+			return nil
+		}
+
+		if err := w.fsWatcher.Add(path); err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("failed to watch refs of local repository")
+			return nil
+		}
+		w.watched[path] = gitDir
+		return nil
+	})
+}
+
+// trigger pulls the repositories of the changed git directories
+func (w *Watcher) trigger(ctx context.Context, changed map[string]bool) {
+	gitDirs, err := w.localGitDirs()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list local repositories")
+		return
+	}
+
+	req := puller.Request{}
+	pullConfig := false
+	for gitDir := range changed {
+		for _, repo := range gitDirs[gitDir] {
+			if repo.GetName() == configrepo.ConfigRepoName {
+				pullConfig = true
+				continue
+			}
+			req.Repositories = append(req.Repositories, repo.GetNamespaceName())
+		}
+	}
+
+	if pullConfig {
+		select {
+		case w.configTrigger <- "":
+		default:
+			// a pull of the config repo is pending anyway
+		}
+	}
+
+	if len(req.Repositories) > 0 {
+		logrus.WithField("repositories", req.Repositories).Info("refs of local repositories changed")
+		select {
+		case w.pullTrigger <- req:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// localGitDirs maps the git directories of the local repositories to their repository objects
+func (w *Watcher) localGitDirs() (map[string][]*repositoryv1.Repository, error) {
+	list, err := w.api.List(repositoryv1.VersionKind)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	gitDirs := make(map[string][]*repositoryv1.Repository)
+	for _, el := range list {
+		repo := el.(*repositoryv1.Repository)
+		if repo.Spec == nil {
+			continue
+		}
+
+		localPath := gitrepo.LocalRepoPath(repo.Spec.Url)
+		if localPath == "" {
+			continue
+		}
+
+		gitDir := gitrepo.GitDir(localPath)
+		gitDirs[gitDir] = append(gitDirs[gitDir], repo)
+	}
+
+	return gitDirs, nil
+}
@@ -0,0 +1,13 @@
+package refwatch_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRefWatch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RefWatch Suite")
+}
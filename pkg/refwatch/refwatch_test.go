@@ -0,0 +1,84 @@
+package refwatch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/controller/configrepo"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/refwatch"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		pullTrigger   chan puller.Request
+		configTrigger chan string
+		bareDir       string
+		bare          *git.Repository
+		cancel        context.CancelFunc
+	)
+
+	createRepo := func(api store.GetterSetter, name, namespace, url string) {
+		Expect(api.Create(&repositoryv1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       &repositoryv1.Spec{Url: url, Branch: "main"},
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		api, err := store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+
+		bareDir = GinkgoT().TempDir()
+		bare, err = git.PlainInit(bareDir, true)
+		Expect(err).NotTo(HaveOccurred())
+
+		createRepo(api, "app", "default", "file://"+bareDir)
+		createRepo(api, "remote", "default", "https://github.com/LaCodon/app.git")
+		createRepo(api, configrepo.ConfigRepoName, "recoon-system", bareDir)
+
+		pullTrigger = make(chan puller.Request, 1)
+		configTrigger = make(chan string, 1)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		watcher := refwatch.NewWatcher(api, true, pullTrigger, configTrigger)
+		go func() {
+			defer GinkgoRecover()
+			Expect(watcher.Run(ctx)).To(Succeed())
+		}()
+		// the watcher starts watching asynchronously
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should pull the local repositories whose refs change", func() {
+		Expect(bare.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature/x",
+			plumbing.NewHash("0123456789012345678901234567890123456789")))).To(Succeed())
+
+		var req puller.Request
+		Eventually(pullTrigger, 5*time.Second).Should(Receive(&req))
+		Expect(req.Repositories).To(ConsistOf(metav1.NamespaceName{Name: "app", Namespace: "default"}))
+		Eventually(configTrigger).Should(Receive())
+	})
+
+	It("should ignore other changes of the git directory", func() {
+		Expect(os.WriteFile(filepath.Join(bareDir, "description"), []byte("app"), 0644)).To(Succeed())
+
+		Consistently(pullTrigger, time.Second).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerHub is the registry of image references without registry host
+const DockerHub = "docker.io"
+
+// Credentials are the login for a registry
+type Credentials struct {
+	ServerAddress string
+	Username      string
+	Password      string
+}
+
+// LookupCredentials returns the credentials for the registry host from the docker config file
+func LookupCredentials(host string) (Credentials, bool) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, false
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return Credentials{}, false
+	}
+
+	dockerConfig := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return Credentials{}, false
+	}
+
+	for server, entry := range dockerConfig.Auths {
+		serverHost := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+		serverHost, _, _ = strings.Cut(serverHost, "/")
+		if serverHost != host && !(host == DockerHub && serverHost == "index.docker.io") {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return Credentials{}, false
+		}
+
+		username, password, _ := strings.Cut(string(decoded), ":")
+		return Credentials{
+			ServerAddress: server,
+			Username:      username,
+			Password:      password,
+		}, true
+	}
+
+	return Credentials{}, false
+}
+
+// Host returns the registry of the image reference
+func Host(ref string) string {
+	first, _, found := strings.Cut(ref, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first
+	}
+
+	return DockerHub
+}
@@ -0,0 +1,288 @@
+// Package registry queries the tags and manifest digests of images from registries implementing the Docker Registry HTTP API V2.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// manifestMediaTypes are accepted when resolving the digest of a tag; the digest of a multi arch image is the one of its index
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// nextLinkRegex matches the Link header of paginated tag lists
+var nextLinkRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+type Client struct {
+	http     *http.Client
+	insecure map[string]bool
+}
+
+// New returns a client which talks plain HTTP to the insecure registries and loopback addresses and HTTPS to all others
+func New(insecure []string) *Client {
+	c := &Client{
+		http:     &http.Client{Timeout: 30 * time.Second},
+		insecure: make(map[string]bool, len(insecure)),
+	}
+
+	for _, host := range insecure {
+		c.insecure[host] = true
+	}
+
+	return c
+}
+
+// Tags returns all tags of the repository of the image
+func (c *Client) Tags(ctx context.Context, image reference.Named) ([]string, error) {
+	tags := make([]string, 0)
+	next := c.baseURL(image) + "/tags/list"
+
+	for next != "" {
+		resp, err := c.do(ctx, http.MethodGet, next, image, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		list := struct {
+			Tags []string `json:"tags"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to decode tag list")
+		}
+		tags = append(tags, list.Tags...)
+
+		next = ""
+		if match := nextLinkRegex.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			link, err := resp.Request.URL.Parse(match[1])
+			if err != nil {
+				return nil, errors.WithMessage(err, "invalid link to next tags")
+			}
+			next = link.String()
+		}
+	}
+
+	return tags, nil
+}
+
+// Digest returns the content digest of the manifest the tag of the image points to
+func (c *Client) Digest(ctx context.Context, image reference.NamedTagged) (string, error) {
+	manifestURL := c.baseURL(image) + "/manifests/" + image.Tag()
+	header := http.Header{"Accept": []string{strings.Join(manifestMediaTypes, ", ")}}
+
+	resp, err := c.do(ctx, http.MethodHead, manifestURL, image, header)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// the header is optional, so fall back to hashing the manifest
+	resp, err = c.do(ctx, http.MethodGet, manifestURL, image, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", errors.WithMessage(err, "failed to read manifest")
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *Client) baseURL(image reference.Named) string {
+	host := reference.Domain(image)
+	if host == DockerHub {
+		host = "registry-1.docker.io"
+	}
+
+	scheme := "https"
+	if c.isInsecure(host) {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, host, reference.Path(image))
+}
+
+func (c *Client) isInsecure(host string) bool {
+	if c.insecure[host] {
+		return true
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// do sends the request and authenticates with the challenge of the registry if it is refused
+func (c *Client) do(ctx context.Context, method, rawURL string, image reference.Named, header http.Header) (*http.Response, error) {
+	resp, err := c.send(ctx, method, rawURL, header, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge, image)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp, err = c.send(ctx, method, rawURL, header, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("registry responded to %s %s with %s", method, rawURL, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, method, rawURL string, header http.Header, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to query registry")
+	}
+
+	return resp, nil
+}
+
+// authorize returns the Authorization header answering the challenge of the registry
+func (c *Client) authorize(ctx context.Context, challenge string, image reference.Named) (string, error) {
+	credentials, hasCredentials := LookupCredentials(reference.Domain(image))
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCredentials {
+			return "", fmt.Errorf("registry %s requires credentials", reference.Domain(image))
+		}
+		req := &http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, credentials, hasCredentials, image)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, credentials Credentials, hasCredentials bool, image reference.Named) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + reference.Path(image) + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCredentials {
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to fetch registry token")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service responded with %s", resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.WithMessage(err, "failed to decode registry token")
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header like `Bearer realm="...",service="..."` into scheme and parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+
+	return scheme, params
+}
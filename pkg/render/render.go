@@ -0,0 +1,131 @@
+// Package render renders compose files as Go templates with the values of the config repo, secrets and built-in variables.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/store"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+// Data is available as dot in the templates
+type Data struct {
+	// Project is the name of the project
+	Project string
+	// Commit is the id of the deployed commit
+	Commit string
+	// Values come from the values block of the repository in the config repo
+	Values map[string]interface{}
+}
+
+type Renderer struct {
+	api  store.Getter
+	data Data
+	// preview redacts the values of secrets
+	preview bool
+}
+
+func New(api store.Getter, data Data) *Renderer {
+	if data.Values == nil {
+		data.Values = make(map[string]interface{})
+	}
+
+	return &Renderer{
+		api:  api,
+		data: data,
+	}
+}
+
+// NewPreview creates a Renderer for showing rendered files to users, which renders secrets as <redacted:name/key>
+func NewPreview(api store.Getter, data Data) *Renderer {
+	r := New(api, data)
+	r.preview = true
+
+	return r
+}
+
+// Render executes content as template; missing values are an error
+func (r *Renderer) Render(name string, content []byte) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(name)).
+		Option("missingkey=error").
+		Funcs(r.funcs()).
+		Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, r.data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *Renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		// secret returns the value of key in the secret with the given name
+		"secret": r.secret,
+		// default returns value or fallback if value is empty
+		"default": func(fallback, value interface{}) interface{} {
+			if isEmpty(value) {
+				return fallback
+			}
+			return value
+		},
+		// required fails the rendering with message if value is empty
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if isEmpty(value) {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		// quote returns value as double quoted YAML string
+		"quote": func(value interface{}) string {
+			return strconv.Quote(fmt.Sprint(value))
+		},
+	}
+}
+
+func (r *Renderer) secret(name, key string) (string, error) {
+	if r.api == nil {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+
+	secret := &secretv1.Secret{}
+	if err := r.api.Get(metav1.NamespaceName{Name: name, Namespace: secretv1.Namespace}, secret); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "", fmt.Errorf("secret %s not found", name)
+		}
+		return "", err
+	}
+
+	if secret.Spec != nil {
+		if value, ok := secret.Spec.Data[key]; ok {
+			if r.preview {
+				return fmt.Sprintf("<redacted:%s/%s>", name, key), nil
+			}
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("secret %s has no key %s", name, key)
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	default:
+		return false
+	}
+}
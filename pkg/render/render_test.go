@@ -0,0 +1,61 @@
+package render_test
+
+import (
+	"path/filepath"
+
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/initsystem"
+	"github.com/lacodon/recoon/pkg/render"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const template = `image: nginx:{{ .Values.tag }}
+project: {{ .Project }}
+password: {{ secret "db" "password" | quote }}
+`
+
+var _ = Describe("Renderer", func() {
+	var (
+		api  *store.DefaultStore
+		data = render.Data{Project: "app", Commit: "c1", Values: map[string]interface{}{"tag": "1.24"}}
+	)
+
+	BeforeEach(func() {
+		var err error
+		api, err = store.NewDefaultStore(filepath.Join(GinkgoT().TempDir(), "bbolt.db"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initsystem.InitStore(api)).To(Succeed())
+		DeferCleanup(api.Close)
+
+		Expect(api.Create(&secretv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: secretv1.Namespace},
+			Spec:       &secretv1.Spec{Data: map[string]string{"password": "s3cret"}},
+		})).To(Succeed())
+	})
+
+	It("should render values, built-ins and secrets", func() {
+		rendered, err := render.New(api, data).Render("docker-compose.yml", []byte(template))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rendered)).To(Equal("image: nginx:1.24\nproject: app\npassword: \"s3cret\"\n"))
+	})
+
+	It("should redact secrets in previews", func() {
+		rendered, err := render.NewPreview(api, data).Render("docker-compose.yml", []byte(template))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rendered)).To(Equal("image: nginx:1.24\nproject: app\npassword: \"<redacted:db/password>\"\n"))
+		Expect(string(rendered)).NotTo(ContainSubstring("s3cret"))
+	})
+
+	It("should still report missing secrets in previews", func() {
+		_, err := render.NewPreview(api, data).Render("docker-compose.yml", []byte(`password: {{ secret "db" "missing" }}`))
+		Expect(err).To(MatchError(ContainSubstring("secret db has no key missing")))
+	})
+
+	It("should fail on missing values", func() {
+		_, err := render.New(api, data).Render("docker-compose.yml", []byte(`image: {{ .Values.missing }}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
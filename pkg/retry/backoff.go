@@ -0,0 +1,136 @@
+package retry
+
+import (
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/store"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the retry state of a single object
+type State struct {
+	VersionKind   metav1.VersionKind   `json:"versionKind"`
+	NamespaceName metav1.NamespaceName `json:"namespaceName"`
+	// Attempts is the number of failed attempts since the last success
+	Attempts int `json:"attempts"`
+	// NextRetry is the time of the next attempt; zero if no retry is scheduled
+	NextRetry time.Time `json:"nextRetry,omitempty"`
+	// LastError is the error of the last failed attempt
+	LastError string `json:"lastError"`
+	// GaveUp is true if the maximal number of attempts has been reached
+	GaveUp bool `json:"gaveUp"`
+}
+
+// Backoff calculates exponential retry delays with jitter per object and keeps track of the retry states
+type Backoff struct {
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+	// jitter is the maximal relative deviation from the exponential delay
+	jitter float64
+
+	mu     sync.Mutex
+	states map[string]*State
+}
+
+// NewBackoff creates a new Backoff; maxAttempts <= 0 means retry forever
+func NewBackoff(baseDelay, maxDelay time.Duration, maxAttempts int) *Backoff {
+	if baseDelay <= 0 {
+		baseDelay = time.Second
+	}
+
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+
+	return &Backoff{
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		maxAttempts: maxAttempts,
+		jitter:      0.2,
+		states:      make(map[string]*State),
+	}
+}
+
+// When records the failure of the event and returns the delay until the next attempt; false means no more retries
+func (b *Backoff) When(event store.Event, err error) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := makeKey(event)
+	state, ok := b.states[key]
+	if !ok {
+		state = &State{
+			VersionKind:   event.ObjectVersionKind,
+			NamespaceName: event.ObjectNamespaceName,
+		}
+		b.states[key] = state
+	}
+
+	state.Attempts++
+	if err != nil {
+		state.LastError = err.Error()
+	}
+
+	if b.maxAttempts > 0 && state.Attempts >= b.maxAttempts {
+		state.GaveUp = true
+		state.NextRetry = time.Time{}
+		return 0, false
+	}
+
+	delay := b.delay(state.Attempts)
+	state.NextRetry = time.Now().Add(delay)
+
+	return delay, true
+}
+
+// Forget resets the retry state of the object, e.g. after it has been handled successfully
+func (b *Backoff) Forget(event store.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.states, makeKey(event))
+}
+
+// States returns a copy of all current retry states
+func (b *Backoff) States() []State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	states := make([]State, 0, len(b.states))
+	for _, state := range b.states {
+		states = append(states, *state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return makeStateKey(states[i]) < makeStateKey(states[j])
+	})
+
+	return states
+}
+
+func (b *Backoff) delay(attempts int) time.Duration {
+	delay := b.baseDelay
+	for i := 1; i < attempts && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+
+	// spread the retries of many failing objects
+	delay = time.Duration(float64(delay) * (1 + b.jitter*(2*rand.Float64()-1)))
+
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+
+	return delay
+}
+
+func makeKey(event store.Event) string {
+	return event.ObjectVersionKind.String() + "/" + event.ObjectNamespaceName.String()
+}
+
+func makeStateKey(state State) string {
+	return state.VersionKind.String() + "/" + state.NamespaceName.String()
+}
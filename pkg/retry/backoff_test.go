@@ -0,0 +1,91 @@
+package retry_test
+
+import (
+	"errors"
+	"time"
+
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/retry"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backoff", func() {
+	event := store.Event{
+		Type:                store.EventTypeUpdate,
+		ObjectVersionKind:   metav1.VersionKind{Version: "v1", Kind: "Project"},
+		ObjectNamespaceName: metav1.NamespaceName{Name: "test", Namespace: "project-test"},
+	}
+	errFailed := errors.New("failed")
+
+	It("should increase the delay exponentially within the jitter", func() {
+		backoff := retry.NewBackoff(time.Second, time.Hour, 0)
+
+		expected := time.Second
+		for i := 0; i < 5; i++ {
+			delay, ok := backoff.When(event, errFailed)
+			Expect(ok).To(BeTrue())
+			Expect(delay).To(BeNumerically(">=", time.Duration(float64(expected)*0.8)))
+			Expect(delay).To(BeNumerically("<=", time.Duration(float64(expected)*1.2)))
+			expected *= 2
+		}
+	})
+
+	It("should never exceed the max delay", func() {
+		backoff := retry.NewBackoff(time.Second, 10*time.Second, 0)
+
+		for i := 0; i < 20; i++ {
+			delay, _ := backoff.When(event, errFailed)
+			Expect(delay).To(BeNumerically("<=", 10*time.Second))
+		}
+	})
+
+	It("should give up after the max attempts", func() {
+		backoff := retry.NewBackoff(time.Second, time.Minute, 3)
+
+		_, ok := backoff.When(event, errFailed)
+		Expect(ok).To(BeTrue())
+		_, ok = backoff.When(event, errFailed)
+		Expect(ok).To(BeTrue())
+		_, ok = backoff.When(event, errFailed)
+		Expect(ok).To(BeFalse())
+
+		states := backoff.States()
+		Expect(states).To(HaveLen(1))
+		Expect(states[0].GaveUp).To(BeTrue())
+		Expect(states[0].Attempts).To(Equal(3))
+		Expect(states[0].LastError).To(Equal("failed"))
+		Expect(states[0].NamespaceName).To(Equal(event.ObjectNamespaceName))
+	})
+
+	It("should reset the state on forget", func() {
+		backoff := retry.NewBackoff(time.Second, time.Minute, 0)
+
+		_, _ = backoff.When(event, errFailed)
+		_, _ = backoff.When(event, errFailed)
+		Expect(backoff.States()).To(HaveLen(1))
+
+		backoff.Forget(event)
+		Expect(backoff.States()).To(BeEmpty())
+
+		delay, _ := backoff.When(event, errFailed)
+		Expect(delay).To(BeNumerically("<=", 1200*time.Millisecond))
+	})
+
+	It("should track objects independently", func() {
+		backoff := retry.NewBackoff(time.Second, time.Minute, 0)
+		other := event
+		other.ObjectNamespaceName.Name = "other"
+
+		_, _ = backoff.When(event, errFailed)
+		_, _ = backoff.When(event, errFailed)
+		_, _ = backoff.When(other, errFailed)
+
+		states := backoff.States()
+		Expect(states).To(HaveLen(2))
+		Expect(states[0].NamespaceName.Name).To(Equal("other"))
+		Expect(states[0].Attempts).To(Equal(1))
+		Expect(states[1].Attempts).To(Equal(2))
+	})
+})
@@ -4,40 +4,87 @@ import (
 	"context"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/sirupsen/logrus"
+	"sync"
 	"time"
 )
 
 type Retryable func(ctx context.Context, event store.Event) error
 
+// GiveUpHandler is called once an event failed more often than allowed
+type GiveUpHandler func(ctx context.Context, event store.Event, err error)
+
 type Retryer interface {
 	RetryOnError(ctx context.Context, event store.Event, handler Retryable)
 }
 
 type defaultRetryer struct {
 	eventChan chan store.Event
+	backoff   *Backoff
+	onGiveUp  GiveUpHandler
+
+	mu sync.Mutex
+	// scheduled is the event which is retried next per object
+	scheduled map[string]store.Event
 }
 
-func New(eventChan chan store.Event) Retryer {
+func New(eventChan chan store.Event, backoff *Backoff, onGiveUp GiveUpHandler) Retryer {
 	return &defaultRetryer{
 		eventChan: eventChan,
+		backoff:   backoff,
+		onGiveUp:  onGiveUp,
+		scheduled: make(map[string]store.Event),
 	}
 }
 
 func (d *defaultRetryer) RetryOnError(ctx context.Context, event store.Event, handler Retryable) {
 	err := handler(ctx, event.DeepCopy())
 	if err == nil {
+		d.backoff.Forget(event)
 		return
 	}
 
-	logrus.WithError(err).Warn("failed to handle event")
+	logger := logrus.WithField("type", event.Type).WithField("nn", event.ObjectNamespaceName)
+	logger.WithError(err).Warn("failed to handle event")
+
+	delay, retry := d.backoff.When(event, err)
+	if !retry {
+		logger.Error("giving up on event after too many failed attempts")
+		if d.onGiveUp != nil {
+			d.onGiveUp(ctx, event, err)
+		}
+		return
+	}
+
+	// there is no need for a second retry if one is already scheduled for this object, but a delete replaces the
+	// retry of an update so that the object is cleaned up
+	key := makeKey(event)
+	d.mu.Lock()
+	if pending, ok := d.scheduled[key]; ok {
+		if event.Type == store.EventTypeDelete && pending.Type != store.EventTypeDelete {
+			d.scheduled[key] = event
+		}
+		d.mu.Unlock()
+		return
+	}
+	d.scheduled[key] = event
+	d.mu.Unlock()
 
 	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(5 * time.Second):
-			logrus.WithField("type", event.Type).WithField("nn", event.ObjectNamespaceName).Debug("retrying event...")
-			d.eventChan <- event
+		case <-timer.C:
 		}
+
+		d.mu.Lock()
+		event := d.scheduled[key]
+		delete(d.scheduled, key)
+		d.mu.Unlock()
+
+		logger.WithField("type", event.Type).Debug("retrying event...")
+		d.eventChan <- event
 	}()
 }
@@ -0,0 +1,58 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/retry"
+	"github.com/lacodon/recoon/pkg/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retryer", func() {
+	var (
+		events  chan store.Event
+		retryer retry.Retryer
+		ctx     context.Context
+		cancel  context.CancelFunc
+		update  = store.Event{
+			Type:                store.EventTypeUpdate,
+			ObjectVersionKind:   metav1.VersionKind{Version: "v1", Kind: "Repository"},
+			ObjectNamespaceName: metav1.NamespaceName{Name: "app", Namespace: "default"},
+		}
+		failing = func(context.Context, store.Event) error { return errors.New("failed") }
+	)
+
+	BeforeEach(func() {
+		events = make(chan store.Event, 4)
+		retryer = retry.New(events, retry.NewBackoff(20*time.Millisecond, 20*time.Millisecond, 0), nil)
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should retry a failed event once per object", func() {
+		retryer.RetryOnError(ctx, update, failing)
+		retryer.RetryOnError(ctx, update, failing)
+
+		Eventually(events).Should(Receive(HaveField("Type", store.EventTypeUpdate)))
+		Consistently(events, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should retry a failed delete instead of the pending update", func() {
+		del := update
+		del.Type = store.EventTypeDelete
+
+		retryer.RetryOnError(ctx, update, failing)
+		retryer.RetryOnError(ctx, del, failing)
+		retryer.RetryOnError(ctx, update, failing)
+
+		Eventually(events).Should(Receive(HaveField("Type", store.EventTypeDelete)))
+		Consistently(events, 50*time.Millisecond).ShouldNot(Receive())
+	})
+})
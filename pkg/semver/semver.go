@@ -0,0 +1,305 @@
+// Package semver parses semantic versions and npm style ranges of them.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version; build metadata is ignored
+type Version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// Parse parses tags like 1.2.3, v1.2.3 or 1.2.3-rc.1
+func Parse(s string) (Version, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+
+	core, pre, hasPre := strings.Cut(s, "-")
+	if hasPre && pre == "" {
+		return Version{}, false
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return Version{}, false
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, ok := parseNumber(part)
+		if !ok {
+			return Version{}, false
+		}
+		numbers[i] = n
+	}
+
+	return Version{major: numbers[0], minor: numbers[1], patch: numbers[2], pre: pre}, true
+}
+
+func parseNumber(s string) (int, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 0
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		s += "-" + v.pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or higher than o
+func (v Version) Compare(o Version) int {
+	for _, diff := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+
+	return comparePrerelease(v.pre, o.pre)
+}
+
+// comparePrerelease compares the dot separated identifiers; a release is higher than any of its pre-releases
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNumber, aIsNumber := parseNumber(aParts[i])
+		bNumber, bIsNumber := parseNumber(bParts[i])
+
+		switch {
+		case aIsNumber && bIsNumber:
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+		case aIsNumber:
+			return -1
+		case bIsNumber:
+			return 1
+		default:
+			if c := strings.Compare(aParts[i], bParts[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// bound is a single comparison like >=1.2.3
+type bound struct {
+	op      string
+	version Version
+}
+
+func (b bound) matches(v Version) bool {
+	c := v.Compare(b.version)
+	switch b.op {
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	default:
+		return c == 0
+	}
+}
+
+// Range is a disjunction of conjunctions of bounds
+type Range [][]bound
+
+// ParseRange parses ranges like ">=1.2.0 <2.0.0", "^1.2", "~1.2.3", "1.x" or "1.2.3 || >=2.1.0".
+// Comparators of a conjunction are separated by spaces or commas.
+func ParseRange(s string) (Range, error) {
+	r := make(Range, 0)
+
+	for _, alternative := range strings.Split(s, "||") {
+		bounds := make([]bound, 0)
+
+		fields := strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' })
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// allow a space between operator and version, e.g. ">= 1.2.0"
+			if strings.Trim(field, "<>=~^") == "" && i+1 < len(fields) {
+				field += fields[i+1]
+				i++
+			}
+
+			expanded, err := expandComparator(field)
+			if err != nil {
+				return nil, err
+			}
+			bounds = append(bounds, expanded...)
+		}
+
+		r = append(r, bounds)
+	}
+
+	return r, nil
+}
+
+// expandComparator translates a comparator which may contain a partial version into bounds on full versions
+func expandComparator(comparator string) ([]bound, error) {
+	versionStart := strings.IndexFunc(comparator, func(r rune) bool { return !strings.ContainsRune("<>=~^", r) })
+	if versionStart < 0 {
+		return nil, fmt.Errorf("missing version in %q", comparator)
+	}
+	op := comparator[:versionStart]
+
+	partial, count, err := parsePartial(comparator[versionStart:])
+	if err != nil {
+		return nil, err
+	}
+
+	// next returns the lowest version above all versions matching the given number of components of partial
+	next := func(components int) Version {
+		switch components {
+		case 1:
+			return Version{major: partial.major + 1, pre: "0"}
+		case 2:
+			return Version{major: partial.major, minor: partial.minor + 1, pre: "0"}
+		default:
+			return Version{major: partial.major, minor: partial.minor, patch: partial.patch + 1, pre: "0"}
+		}
+	}
+
+	if count == 0 {
+		if op == "<" || op == ">" {
+			// nothing is lower or higher than any version
+			return []bound{{op: "<", version: Version{pre: "0"}}}, nil
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "", "=":
+		if count == 3 {
+			return []bound{{op: "=", version: partial}}, nil
+		}
+		return []bound{{op: ">=", version: partial}, {op: "<", version: next(count)}}, nil
+	case ">=", "<":
+		return []bound{{op: op, version: partial}}, nil
+	case ">":
+		if count == 3 {
+			return []bound{{op: ">", version: partial}}, nil
+		}
+		return []bound{{op: ">=", version: next(count)}}, nil
+	case "<=":
+		if count == 3 {
+			return []bound{{op: "<=", version: partial}}, nil
+		}
+		return []bound{{op: "<", version: next(count)}}, nil
+	case "~":
+		if count == 1 {
+			return []bound{{op: ">=", version: partial}, {op: "<", version: next(1)}}, nil
+		}
+		return []bound{{op: ">=", version: partial}, {op: "<", version: next(2)}}, nil
+	case "^":
+		// the first non zero component must not change
+		components := 1
+		if partial.major == 0 && count > 1 {
+			components = 2
+			if partial.minor == 0 && count > 2 {
+				components = 3
+			}
+		}
+		return []bound{{op: ">=", version: partial}, {op: "<", version: next(components)}}, nil
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+}
+
+// parsePartial parses versions like 1, 1.2, 1.2.x or 1.2.3-rc.1 and returns how many components are set
+func parsePartial(s string) (Version, int, error) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(s, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+
+	numbers := make([]int, 3)
+	count := 0
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+
+		n, ok := parseNumber(part)
+		if !ok {
+			return Version{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		numbers[count] = n
+		count++
+	}
+
+	if pre != "" && count < 3 {
+		return Version{}, 0, fmt.Errorf("pre-release of partial version %q", s)
+	}
+
+	return Version{major: numbers[0], minor: numbers[1], patch: numbers[2], pre: pre}, count, nil
+}
+
+// Matches reports whether v is in the range. Like npm, pre-releases only match if a comparator of the same
+// conjunction is a pre-release of the same major, minor and patch version.
+func (r Range) Matches(v Version) bool {
+	for _, bounds := range r {
+		if matchesAll(bounds, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesAll(bounds []bound, v Version) bool {
+	allowPre := v.pre == ""
+	for _, b := range bounds {
+		if !b.matches(v) {
+			return false
+		}
+
+		if b.version.pre != "" && b.version.pre != "0" &&
+			b.version.major == v.major && b.version.minor == v.minor && b.version.patch == v.patch {
+			allowPre = true
+		}
+	}
+
+	return allowPre
+}
@@ -0,0 +1,115 @@
+package semver_test
+
+import (
+	"github.com/lacodon/recoon/pkg/semver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func mustParse(s string) semver.Version {
+	v, ok := semver.Parse(s)
+	ExpectWithOffset(1, ok).To(BeTrue(), s)
+	return v
+}
+
+var _ = Describe("Parse", func() {
+	DescribeTable("valid versions",
+		func(tag, expected string) {
+			Expect(mustParse(tag).String()).To(Equal(expected))
+		},
+		Entry("release", "1.2.3", "1.2.3"),
+		Entry("v prefix", "v1.2.3", "1.2.3"),
+		Entry("pre-release", "1.2.3-rc.1", "1.2.3-rc.1"),
+		Entry("v prefix and pre-release", "v0.1.0-alpha", "0.1.0-alpha"),
+		Entry("build metadata", "1.2.3+build.5", "1.2.3"),
+		Entry("pre-release with build metadata", "1.2.3-beta.2+sha.abc", "1.2.3-beta.2"),
+	)
+
+	DescribeTable("invalid versions",
+		func(tag string) {
+			_, ok := semver.Parse(tag)
+			Expect(ok).To(BeFalse())
+		},
+		Entry("partial", "1.2"),
+		Entry("too many components", "1.2.3.4"),
+		Entry("leading zero", "1.02.3"),
+		Entry("empty pre-release", "1.2.3-"),
+		Entry("word", "latest"),
+		Entry("negative", "1.-2.3"),
+		Entry("empty", ""),
+	)
+})
+
+var _ = Describe("Version", func() {
+	DescribeTable("Compare",
+		func(a, b string, expected int) {
+			Expect(mustParse(a).Compare(mustParse(b))).To(Equal(expected))
+			Expect(mustParse(b).Compare(mustParse(a))).To(Equal(-expected))
+		},
+		Entry("equal", "1.2.3", "v1.2.3", 0),
+		Entry("major", "2.0.0", "1.9.9", 1),
+		Entry("minor", "1.10.0", "1.9.0", 1),
+		Entry("patch", "1.2.10", "1.2.9", 1),
+		Entry("release above pre-release", "1.2.3", "1.2.3-rc.1", 1),
+		Entry("numeric pre-release identifiers", "1.2.3-rc.10", "1.2.3-rc.2", 1),
+		Entry("alphanumeric above numeric identifiers", "1.2.3-rc", "1.2.3-1", 1),
+		Entry("alphanumeric identifiers", "1.2.3-beta", "1.2.3-alpha", 1),
+		Entry("more identifiers", "1.2.3-alpha.1", "1.2.3-alpha", 1),
+		Entry("build metadata is ignored", "1.2.3+a", "1.2.3+b", 0),
+	)
+})
+
+var _ = Describe("Range", func() {
+	DescribeTable("Matches",
+		func(r, version string, expected bool) {
+			parsed, err := semver.ParseRange(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Matches(mustParse(version))).To(Equal(expected))
+		},
+		Entry("exact", "1.2.3", "1.2.3", true),
+		Entry("exact with v prefix", "v1.2.3", "1.2.3", true),
+		Entry("exact mismatch", "=1.2.3", "1.2.4", false),
+		Entry("partial", "1.2", "1.2.9", true),
+		Entry("partial mismatch", "1.2", "1.3.0", false),
+		Entry("x range", "1.x", "1.9.0", true),
+		Entry("x range mismatch", "1.x", "2.0.0", false),
+		Entry("any", "*", "3.4.5", true),
+		Entry("greater than partial", ">1.2", "1.3.0", true),
+		Entry("greater than partial excludes minor", ">1.2", "1.2.9", false),
+		Entry("less or equal partial", "<=1.2", "1.2.9", true),
+		Entry("caret", "^1.2.3", "1.9.0", true),
+		Entry("caret excludes next major", "^1.2.3", "2.0.0", false),
+		Entry("caret excludes lower", "^1.2.3", "1.2.2", false),
+		Entry("caret below 1.0 keeps minor", "^0.2.3", "0.2.9", true),
+		Entry("caret below 1.0 excludes next minor", "^0.2.3", "0.3.0", false),
+		Entry("caret below 0.1 keeps patch", "^0.0.3", "0.0.4", false),
+		Entry("tilde", "~1.2.3", "1.2.9", true),
+		Entry("tilde excludes next minor", "~1.2.3", "1.3.0", false),
+		Entry("tilde major", "~1", "1.9.0", true),
+		Entry("compound", ">=1.2.0 <2.0.0", "1.9.9", true),
+		Entry("compound upper bound", ">=1.2.0 <2.0.0", "2.0.0", false),
+		Entry("compound with commas", ">=1.2.0, <1.5", "1.4.0", true),
+		Entry("compound with space after operator", ">= 1.2.0 < 1.5", "1.5.0", false),
+		Entry("alternatives", "1.2.3 || >=2.1.0", "2.5.0", true),
+		Entry("first alternative", "1.2.3 || >=2.1.0", "1.2.3", true),
+		Entry("no alternative", "1.2.3 || >=2.1.0", "2.0.0", false),
+		Entry("pre-release excluded by release range", "^1.2.0", "1.3.0-rc.1", false),
+		Entry("pre-release excluded by upper bound", "<2.0.0", "2.0.0-rc.1", false),
+		Entry("pre-release of the same version", ">=1.3.0-rc.1 <2.0.0", "1.3.0-rc.2", true),
+		Entry("pre-release of another version", ">=1.3.0-rc.1 <2.0.0", "1.4.0-rc.1", false),
+		Entry("release above pre-release bound", ">=1.3.0-rc.1", "1.3.0", true),
+		Entry("caret with pre-release", "^1.3.0-beta", "1.3.0-beta.2", true),
+	)
+
+	DescribeTable("invalid ranges",
+		func(r string) {
+			_, err := semver.ParseRange(r)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("word", "latest"),
+		Entry("too many components", "1.2.3.4"),
+		Entry("unknown operator", "!1.2.3"),
+		Entry("pre-release of partial version", "1.2-rc.1"),
+		Entry("missing version", ">="),
+	)
+})
@@ -0,0 +1,113 @@
+// Package snapshot archives the named volumes of projects into a local directory through a helper container and restores them.
+package snapshot
+
+import (
+	"context"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
+	"github.com/lacodon/recoon/pkg/compose"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+// mount points of the helper container
+const (
+	volumeMount = "/volume"
+	backupMount = "/backup"
+)
+
+type Store struct {
+	dir         string
+	helperImage string
+	runtime     compose.ContainerRuntime
+}
+
+// New returns a store which keeps the archives in dir; since the helper container mounts dir, it has to be
+// the same path on the docker host if recoon runs in a container itself
+func New(dir, helperImage string, runtime compose.ContainerRuntime) *Store {
+	return &Store{
+		dir:         dir,
+		helperImage: helperImage,
+		runtime:     runtime,
+	}
+}
+
+// Create archives the docker volumes into the directory of the snapshot with the given id
+func (s *Store) Create(ctx context.Context, projectName, id string, volumes []string) ([]snapshotv1.Volume, error) {
+	dir, err := s.snapshotDir(projectName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WithMessage(err, "failed to create snapshot directory")
+	}
+
+	archives := make([]snapshotv1.Volume, 0, len(volumes))
+	for _, volume := range volumes {
+		file := volume + ".tar.gz"
+		output, err := s.runtime.RunHelper(ctx, s.helperImage,
+			[]string{"tar", "-czf", backupMount + "/" + file, "-C", volumeMount, "."},
+			[]string{volume + ":" + volumeMount + ":ro", dir + ":" + backupMount})
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, errors.WithMessagef(err, "failed to archive volume %s: %s", volume, output)
+		}
+
+		archive := snapshotv1.Volume{Name: volume, File: file}
+		if info, err := os.Stat(filepath.Join(dir, file)); err == nil {
+			archive.Size = info.Size()
+		}
+		archives = append(archives, archive)
+	}
+
+	return archives, nil
+}
+
+// Restore replaces the content of the volumes by their archives; the volumes must not be in use
+func (s *Store) Restore(ctx context.Context, projectName, id string, volumes []snapshotv1.Volume) error {
+	dir, err := s.snapshotDir(projectName, id)
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range volumes {
+		if filepath.Base(volume.File) != volume.File {
+			return errors.Errorf("invalid archive %s", volume.File)
+		}
+
+		// find also removes hidden files, which a shell glob would miss
+		output, err := s.runtime.RunHelper(ctx, s.helperImage,
+			[]string{"sh", "-c", `find "$1" -mindepth 1 -delete && tar -xzf "$2" -C "$1"`, "restore",
+				volumeMount, backupMount + "/" + volume.File},
+			[]string{volume.Name + ":" + volumeMount, dir + ":" + backupMount + ":ro"})
+		if err != nil {
+			return errors.WithMessagef(err, "failed to restore volume %s: %s", volume.Name, output)
+		}
+	}
+
+	return nil
+}
+
+// Remove deletes the archives of the snapshot
+func (s *Store) Remove(projectName, id string) error {
+	dir, err := s.snapshotDir(projectName, id)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (s *Store) snapshotDir(projectName, id string) (string, error) {
+	if filepath.Base(projectName) != projectName || filepath.Base(id) != id {
+		return "", errors.Errorf("invalid snapshot %s of project %s", id, projectName)
+	}
+
+	dir, err := filepath.Abs(filepath.Join(s.dir, projectName, id))
+	if err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
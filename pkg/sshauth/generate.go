@@ -1,6 +1,7 @@
 package sshauth
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -55,6 +56,16 @@ func CreateKeypairIfNotExists(privKeyFilePath, pubKeyFilePath string, force bool
 	return generateKeyPair(privFile, pubFile)
 }
 
+// GenerateDeployKey returns a new PEM encoded SSH private key for the deploy key of a single repository
+func GenerateDeployKey() ([]byte, error) {
+	privKey := &bytes.Buffer{}
+	if err := generateKeyPair(privKey, io.Discard); err != nil {
+		return nil, err
+	}
+
+	return privKey.Bytes(), nil
+}
+
 // CreateCertFilesIfNotExist creates client and server TLS certificates if none could be found at the given path or if force is true
 func CreateCertFilesIfNotExist(host string, path string, force bool) error {
 	serverCertFilePath := filepath.Join(path, ServerCertFile)
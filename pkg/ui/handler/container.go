@@ -7,6 +7,7 @@ import (
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
 	"github.com/lacodon/recoon/pkg/compose"
+	projectcontroller "github.com/lacodon/recoon/pkg/controller/project"
 	"github.com/lacodon/recoon/pkg/store"
 	"net/http"
 	"strconv"
@@ -41,7 +42,7 @@ func ContainerList(api store.Getter) echo.HandlerFunc {
 			return err
 		}
 
-		containers, err := compose.Status(c.Request().Context(), project.GetName())
+		containers, err := compose.Status(c.Request().Context(), projectcontroller.ComposeProjectName(project))
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	deploymentv1 "github.com/lacodon/recoon/pkg/api/v1/deployment"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/deploylog"
+	"github.com/lacodon/recoon/pkg/store"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+)
+
+type DeploymentLog struct {
+	Content string
+	// Offset is the position to continue reading the log from
+	Offset int64
+	// Finished is true if the deployment is done and no further output will be appended
+	Finished bool
+}
+
+func DeploymentList(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := api.List(deploymentv1.VersionKind,
+			store.InNamespace("project-"+c.Param("project")),
+			store.WithNamePrefix(c.Param("project")+"."))
+		if err != nil {
+			return err
+		}
+
+		resp := make([]*deploymentv1.Deployment, 0, len(list))
+		for _, el := range list {
+			resp = append(resp, el.(*deploymentv1.Deployment))
+		}
+
+		sort.Slice(resp, func(i, j int) bool {
+			return resp[i].Spec.Revision < resp[j].Spec.Revision
+		})
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+func DeploymentGetLog(api store.Getter, deployLogs *deploylog.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		projectName := c.Param("project")
+
+		revision, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			return c.String(http.StatusBadRequest, "invalid revision")
+		}
+
+		offset, _ := strconv.ParseInt(c.QueryParam("offset"), 10, 64)
+
+		deployment := &deploymentv1.Deployment{}
+		if err := api.Get(metav1.NamespaceName{
+			Name:      deploymentv1.MakeName(projectName, revision),
+			Namespace: "project-" + projectName,
+		}, deployment); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "not found")
+			}
+			return err
+		}
+
+		content, offset, err := deployLogs.Read(projectName, revision, offset)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, DeploymentLog{
+			Content:  string(content),
+			Offset:   offset,
+			Finished: deployment.IsFinished(),
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	eventv1 "github.com/lacodon/recoon/pkg/api/v1/event"
+	"github.com/lacodon/recoon/pkg/store"
+	"net/http"
+	"sort"
+)
+
+func EventList(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var opts []store.ListOption
+		if c.Param("namespace") != "" {
+			opts = append(opts, store.InNamespace(c.Param("namespace")))
+		}
+
+		list, err := api.List(eventv1.VersionKind, opts...)
+		if err != nil {
+			return err
+		}
+
+		resp := make([]*eventv1.Event, 0, len(list))
+		for _, el := range list {
+			resp = append(resp, el.(*eventv1.Event))
+		}
+
+		sort.Slice(resp, func(i, j int) bool {
+			return resp[i].Timestamp.Before(resp[j].Timestamp)
+		})
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/lacodon/recoon/pkg/gc"
+	"net/http"
+)
+
+// GarbageCollect returns what the garbage collection would remove or runs it right away if dryRun is false
+func GarbageCollect(collector *gc.Collector, dryRun bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report, err := collector.Collect(c.Request().Context(), dryRun)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, report)
+	}
+}
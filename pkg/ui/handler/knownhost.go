@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	knownhostv1 "github.com/lacodon/recoon/pkg/api/v1/knownhost"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/knownhosts"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+func KnownHostList(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := api.List(knownhostv1.VersionKind, store.InNamespace(knownhostv1.Namespace))
+		if err != nil {
+			return err
+		}
+
+		resp := make([]*knownhostv1.KnownHost, 0, len(list))
+		for _, el := range list {
+			resp = append(resp, el.(*knownhostv1.KnownHost))
+		}
+
+		sort.Slice(resp, func(i, j int) bool {
+			return resp[i].GetName() < resp[j].GetName()
+		})
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// KnownHostSet replaces the keys of the host with the keys in the body; without keys, the host gets scanned
+func KnownHostSet(api store.GetterSetter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		host, err := url.PathUnescape(c.Param("host"))
+		if err != nil || host == "" {
+			return c.String(http.StatusBadRequest, "invalid host")
+		}
+
+		keys := make([]string, 0)
+		if err := c.Bind(&keys); err != nil {
+			return c.String(http.StatusBadRequest, "invalid host keys")
+		}
+
+		for i, key := range keys {
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+			if err != nil {
+				return c.String(http.StatusBadRequest, "invalid host key "+key)
+			}
+			keys[i] = knownhosts.MarshalKey(parsed)
+		}
+
+		if len(keys) == 0 {
+			scanned, err := knownhosts.Scan(host)
+			if err != nil {
+				return c.String(http.StatusBadGateway, err.Error())
+			}
+
+			for _, key := range scanned {
+				keys = append(keys, knownhosts.MarshalKey(key))
+			}
+		}
+
+		nn := metav1.NamespaceName{Name: knownhosts.Name(host), Namespace: knownhostv1.Namespace}
+
+		knownHost := &knownhostv1.KnownHost{}
+		err = api.Get(nn, knownHost)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			knownHost = &knownhostv1.KnownHost{
+				TypeMeta: metav1.TypeMeta{
+					Version: knownhostv1.VersionKind.Version,
+					Kind:    knownhostv1.VersionKind.Kind,
+				},
+				ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+				Spec:       &knownhostv1.Spec{Keys: keys},
+			}
+			err = api.Create(knownHost)
+		case err == nil:
+			knownHost.Spec = &knownhostv1.Spec{Keys: keys}
+			err = api.Update(knownHost)
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, knownHost)
+	}
+}
+
+func KnownHostDelete(api store.GetterSetter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		host, err := url.PathUnescape(c.Param("host"))
+		if err != nil || host == "" {
+			return c.String(http.StatusBadRequest, "invalid host")
+		}
+
+		err = api.Delete(knownhostv1.VersionKind, metav1.NamespaceName{Name: knownhosts.Name(host), Namespace: knownhostv1.Namespace})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "not found")
+			}
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	}
+}
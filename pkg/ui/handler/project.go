@@ -4,6 +4,8 @@ import (
 	"github.com/labstack/echo/v4"
 	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
 	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	"github.com/lacodon/recoon/pkg/compose"
+	projectcontroller "github.com/lacodon/recoon/pkg/controller/project"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/pkg/errors"
 	"net/http"
@@ -45,3 +47,42 @@ func ProjectGet(api store.Getter) echo.HandlerFunc {
 		return c.JSON(http.StatusOK, project)
 	}
 }
+
+// ProjectRender returns the compose project of the current commit with all files, patches and templates applied; the
+// values of secrets are redacted
+func ProjectRender(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		project := &projectv1.Project{}
+		if err := api.Get(metav1.NamespaceName{
+			Name:      c.Param("name"),
+			Namespace: c.Param("namespace"),
+		}, project); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "not found")
+			}
+
+			return err
+		}
+
+		if project.Spec == nil {
+			return c.String(http.StatusNotFound, "project has no spec")
+		}
+
+		opts, err := projectcontroller.PreviewComposeOptions(api, project, project.Spec.LocalPath, project.Spec.CommitId)
+		if err != nil {
+			return c.String(http.StatusUnprocessableEntity, err.Error())
+		}
+
+		composeProject, err := compose.LoadProject(opts)
+		if err != nil {
+			return c.String(http.StatusUnprocessableEntity, err.Error())
+		}
+
+		data, err := composeProject.MarshalYAML()
+		if err != nil {
+			return err
+		}
+
+		return c.Blob(http.StatusOK, "application/yaml", data)
+	}
+}
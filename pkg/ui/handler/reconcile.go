@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	reconcilev1 "github.com/lacodon/recoon/pkg/api/v1/reconcile"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/reconcile"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// Reconcile triggers an immediate reconciliation of the target in the body and returns the request, whose id can be
+// polled with ReconcileGet. Without body all app repositories are pulled.
+func Reconcile(api store.GetterSetter, repoReconcileTrigger chan<- puller.Request, configReconcileTrigger chan<- string) echo.HandlerFunc {
+	tracker := reconcile.New(api)
+
+	return func(c echo.Context) error {
+		spec := &reconcilev1.Spec{}
+		if err := c.Bind(spec); err != nil {
+			return c.String(http.StatusBadRequest, "invalid reconcile request")
+		}
+
+		switch spec.Target {
+		case reconcilev1.TargetAll, reconcilev1.TargetConfig:
+		case reconcilev1.TargetRepository:
+			if err := api.Get(metav1.NamespaceName{Name: spec.Name, Namespace: "default"}, &repositoryv1.Repository{}); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					return c.String(http.StatusNotFound, "repository not found")
+				}
+				return err
+			}
+		case reconcilev1.TargetProject:
+			if err := api.Get(metav1.NamespaceName{Name: spec.Name, Namespace: "project-" + spec.Name}, &projectv1.Project{}); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					return c.String(http.StatusNotFound, "project not found")
+				}
+				return err
+			}
+		default:
+			return c.String(http.StatusBadRequest, "unknown target "+spec.Target)
+		}
+
+		request, err := tracker.Create(spec.Target, spec.Name)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+		switch spec.Target {
+		case reconcilev1.TargetConfig:
+			select {
+			case configReconcileTrigger <- request.Name:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		case reconcilev1.TargetProject:
+			err = requestProjectReconcile(api, tracker, spec.Name, request.Name)
+		default:
+			req := puller.Request{ID: request.Name}
+			if spec.Target == reconcilev1.TargetRepository {
+				req.Repositories = []metav1.NamespaceName{{Name: spec.Name, Namespace: "default"}}
+			}
+
+			select {
+			case repoReconcileTrigger <- req:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+
+		if err != nil {
+			tracker.Finish(request.Name, "", err)
+			return err
+		}
+
+		return c.JSON(http.StatusOK, request)
+	}
+}
+
+// ReconcileAll pulls all app repositories right away without tracking the progress, like a POST without body; it
+// keeps the PUT endpoint of older clients working
+func ReconcileAll(repoReconcileTrigger chan<- puller.Request) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		select {
+		case repoReconcileTrigger <- puller.Request{}:
+		case <-c.Request().Context().Done():
+			return c.Request().Context().Err()
+		}
+
+		return c.JSON(http.StatusOK, nil)
+	}
+}
+
+// requestProjectReconcile asks the project controller to redeploy the project; a pending request of the project
+// is superseded
+func requestProjectReconcile(api store.GetterSetter, tracker *reconcile.Tracker, projectName, requestId string) error {
+	for {
+		project := &projectv1.Project{}
+		if err := api.Get(metav1.NamespaceName{Name: projectName, Namespace: "project-" + projectName}, project); err != nil {
+			return err
+		}
+
+		if project.Spec == nil {
+			return errors.New("project has no spec")
+		}
+
+		previous := project.Spec.ReconcileRequest
+		project.Spec.ReconcileRequest = requestId
+		err := api.Update(project)
+		if errors.Is(err, store.ErrObjectChanged) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if previous != "" {
+			tracker.Finish(previous, "", errors.New("superseded by request "+requestId))
+		}
+
+		return nil
+	}
+}
+
+func ReconcileGet(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := &reconcilev1.Reconcile{}
+		if err := api.Get(metav1.NamespaceName{
+			Name:      c.Param("id"),
+			Namespace: reconcilev1.Namespace,
+		}, request); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "not found")
+			}
+
+			return err
+		}
+
+		return c.JSON(http.StatusOK, request)
+	}
+}
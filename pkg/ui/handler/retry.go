@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/lacodon/recoon/pkg/retry"
+	"net/http"
+)
+
+func RetryList(backoff *retry.Backoff) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, backoff.States())
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+)
+
+// SecretInfo describes a secret without revealing its values
+type SecretInfo struct {
+	Name string
+	Keys []string
+}
+
+func SecretList(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := api.List(secretv1.VersionKind, store.InNamespace(secretv1.Namespace))
+		if err != nil {
+			return err
+		}
+
+		resp := make([]SecretInfo, 0, len(list))
+		for _, el := range list {
+			secret := el.(*secretv1.Secret)
+			resp = append(resp, SecretInfo{Name: secret.GetName(), Keys: secret.Keys()})
+		}
+
+		sort.Slice(resp, func(i, j int) bool {
+			return resp[i].Name < resp[j].Name
+		})
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// SecretSet creates the secret or sets the given keys of an existing one
+func SecretSet(api store.GetterSetter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		data := make(map[string]string)
+		if err := c.Bind(&data); err != nil {
+			return c.String(http.StatusBadRequest, "invalid secret data")
+		}
+
+		nn := metav1.NamespaceName{Name: c.Param("name"), Namespace: secretv1.Namespace}
+
+		secret := &secretv1.Secret{}
+		err := api.Get(nn, secret)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			secret = &secretv1.Secret{
+				TypeMeta: metav1.TypeMeta{
+					Version: secretv1.VersionKind.Version,
+					Kind:    secretv1.VersionKind.Kind,
+				},
+				ObjectMeta: metav1.ObjectMeta{Name: nn.Name, Namespace: nn.Namespace},
+				Spec:       &secretv1.Spec{Data: data},
+			}
+			err = api.Create(secret)
+		case err == nil:
+			if secret.Spec == nil {
+				secret.Spec = &secretv1.Spec{}
+			}
+			if secret.Spec.Data == nil {
+				secret.Spec.Data = make(map[string]string)
+			}
+			for key, value := range data {
+				secret.Spec.Data[key] = value
+			}
+			err = api.Update(secret)
+		}
+		if err != nil {
+			return err
+		}
+
+		triggerTemplatedProjects(api)
+		return c.JSON(http.StatusOK, SecretInfo{Name: secret.GetName(), Keys: secret.Keys()})
+	}
+}
+
+func SecretDelete(api store.GetterSetter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := api.Delete(secretv1.VersionKind, metav1.NamespaceName{Name: c.Param("name"), Namespace: secretv1.Namespace})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "not found")
+			}
+			return err
+		}
+
+		triggerTemplatedProjects(api)
+		return c.JSON(http.StatusOK, nil)
+	}
+}
+
+// triggerTemplatedProjects reconciles all projects with rendered compose files, so that they pick up changed secrets
+func triggerTemplatedProjects(api store.GetterSetter) {
+	list, err := api.List(projectv1.VersionKind)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list projects")
+		return
+	}
+
+	for _, el := range list {
+		project := el.(*projectv1.Project)
+		if project.Spec == nil || project.Spec.Compose == nil || !project.Spec.Compose.Template {
+			continue
+		}
+
+		if err := api.Update(project); err != nil {
+			logrus.WithError(err).WithField("project", project.GetName()).Warn("failed to trigger project reconciliation")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	projectv1 "github.com/lacodon/recoon/pkg/api/v1/project"
+	snapshotv1 "github.com/lacodon/recoon/pkg/api/v1/snapshot"
+	projectcontroller "github.com/lacodon/recoon/pkg/controller/project"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+func SnapshotList(api store.Getter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		snapshots, err := projectcontroller.ListSnapshots(api, c.Param("project"))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, snapshots)
+	}
+}
+
+// SnapshotRestore requests the project controller to stop the project, restore the volumes of the snapshot and redeploy
+func SnapshotRestore(api store.GetterSetter) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		projectName := c.Param("project")
+		nn := metav1.NamespaceName{Name: projectName, Namespace: "project-" + projectName}
+
+		if err := api.Get(metav1.NamespaceName{
+			Name:      snapshotv1.MakeName(projectName, c.Param("id")),
+			Namespace: nn.Namespace,
+		}, &snapshotv1.Snapshot{}); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.String(http.StatusNotFound, "snapshot not found")
+			}
+			return err
+		}
+
+		for {
+			project := &projectv1.Project{}
+			if err := api.Get(nn, project); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					return c.String(http.StatusNotFound, "project not found")
+				}
+				return err
+			}
+
+			if project.Spec == nil {
+				return c.String(http.StatusUnprocessableEntity, "project has no spec")
+			}
+
+			project.Spec.RestoreSnapshot = c.Param("id")
+			err := api.Update(project)
+			if errors.Is(err, store.ErrObjectChanged) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(http.StatusOK, project)
+		}
+	}
+}
@@ -13,7 +13,13 @@ func (u *UI) setupRoutes(e *echo.Echo) {
 
 	apiGroup := e.Group("/api/v1")
 
-	apiGroup.PUT("/reconcile", handler.RepositoryReconcile(u.repoReconcileTrigger))
+	apiGroup.POST("/reconcile", handler.Reconcile(u.api, u.repoReconcileTrigger, u.configReconcileTrigger))
+	// deprecated alias of a POST without body
+	apiGroup.PUT("/reconcile", handler.ReconcileAll(u.repoReconcileTrigger))
+	apiGroup.GET("/reconcile/:id", handler.ReconcileGet(u.api))
+	apiGroup.GET("/retry", handler.RetryList(u.backoff))
+	apiGroup.GET("/gc", handler.GarbageCollect(u.collector, true))
+	apiGroup.POST("/gc", handler.GarbageCollect(u.collector, false))
 
 	repoGroup := apiGroup.Group("/repository")
 	repoGroup.GET("", handler.RepositoryList(u.api))
@@ -24,9 +30,32 @@ func (u *UI) setupRoutes(e *echo.Echo) {
 	projectGroup.GET("", handler.ProjectList(u.api))
 	projectGroup.GET("/:namespace", handler.ProjectList(u.api))
 	projectGroup.GET("/:namespace/:name", handler.ProjectGet(u.api))
+	projectGroup.GET("/:namespace/:name/render", handler.ProjectRender(u.api))
+
+	eventGroup := apiGroup.Group("/event")
+	eventGroup.GET("", handler.EventList(u.api))
+	eventGroup.GET("/:namespace", handler.EventList(u.api))
 
 	containerGroup := apiGroup.Group("/container")
 	containerGroup.GET("", handler.ContainerList(u.api))
 	containerGroup.GET("/:project", handler.ContainerList(u.api))
 	containerGroup.GET("/logs/:container", handler.ContainerGetLogs(u.api))
+
+	secretGroup := apiGroup.Group("/secret")
+	secretGroup.GET("", handler.SecretList(u.api))
+	secretGroup.PUT("/:name", handler.SecretSet(u.api))
+	secretGroup.DELETE("/:name", handler.SecretDelete(u.api))
+
+	knownHostGroup := apiGroup.Group("/knownhost")
+	knownHostGroup.GET("", handler.KnownHostList(u.api))
+	knownHostGroup.PUT("/:host", handler.KnownHostSet(u.api))
+	knownHostGroup.DELETE("/:host", handler.KnownHostDelete(u.api))
+
+	deploymentGroup := apiGroup.Group("/deployment")
+	deploymentGroup.GET("/:project", handler.DeploymentList(u.api))
+	deploymentGroup.GET("/:project/:revision/log", handler.DeploymentGetLog(u.api, u.deployLogs))
+
+	snapshotGroup := apiGroup.Group("/snapshot")
+	snapshotGroup.GET("/:project", handler.SnapshotList(u.api))
+	snapshotGroup.POST("/:project/:id/restore", handler.SnapshotRestore(u.api))
 }
@@ -6,6 +6,10 @@ import (
 	"crypto/x509"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/lacodon/recoon/pkg/deploylog"
+	"github.com/lacodon/recoon/pkg/gc"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/retry"
 	"github.com/lacodon/recoon/pkg/sshauth"
 	"github.com/lacodon/recoon/pkg/store"
 	"github.com/sirupsen/logrus"
@@ -15,18 +19,26 @@ import (
 )
 
 type UI struct {
-	api                  store.Getter
-	port                 int
-	sshKeyDir            string
-	repoReconcileTrigger chan<- bool
+	api                    store.GetterSetter
+	port                   int
+	sshKeyDir              string
+	repoReconcileTrigger   chan<- puller.Request
+	configReconcileTrigger chan<- string
+	backoff                *retry.Backoff
+	deployLogs             *deploylog.Store
+	collector              *gc.Collector
 }
 
-func New(api store.Getter, repoReconcileTrigger chan<- bool, port int, sshKeyDir string) *UI {
+func New(api store.GetterSetter, repoReconcileTrigger chan<- puller.Request, configReconcileTrigger chan<- string, port int, sshKeyDir string, backoff *retry.Backoff, deployLogs *deploylog.Store, collector *gc.Collector) *UI {
 	return &UI{
-		api:                  api,
-		port:                 port,
-		sshKeyDir:            sshKeyDir,
-		repoReconcileTrigger: repoReconcileTrigger,
+		api:                    api,
+		port:                   port,
+		sshKeyDir:              sshKeyDir,
+		repoReconcileTrigger:   repoReconcileTrigger,
+		configReconcileTrigger: configReconcileTrigger,
+		backoff:                backoff,
+		deployLogs:             deployLogs,
+		collector:              collector,
 	}
 }
 
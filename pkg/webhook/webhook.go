@@ -0,0 +1,334 @@
+// Package webhook receives the push webhooks of GitHub, GitLab and Gitea and pulls the pushed repositories immediately.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	repositoryv1 "github.com/lacodon/recoon/pkg/api/v1/repository"
+	secretv1 "github.com/lacodon/recoon/pkg/api/v1/secret"
+	"github.com/lacodon/recoon/pkg/controller/configrepo"
+	"github.com/lacodon/recoon/pkg/puller"
+	"github.com/lacodon/recoon/pkg/semver"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxPayloadSize limits the size of the accepted payloads
+const maxPayloadSize = 5 * 1024 * 1024
+
+// git providers of the webhooks
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// Response lists the repositories whose pull got triggered
+type Response struct {
+	Repositories []string `json:"repositories"`
+}
+
+// Receiver serves the webhooks on a plain HTTP listener since git providers can't authenticate with client certificates
+type Receiver struct {
+	api           store.Getter
+	port          int
+	pullTrigger   chan<- puller.Request
+	configTrigger chan<- string
+}
+
+func NewReceiver(api store.Getter, port int, pullTrigger chan<- puller.Request, configTrigger chan<- string) *Receiver {
+	return &Receiver{
+		api:           api,
+		port:          port,
+		pullTrigger:   pullTrigger,
+		configTrigger: configTrigger,
+	}
+}
+
+func (r *Receiver) Run(ctx context.Context) error {
+	if r.port <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	s := http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", r.port),
+		Handler: r.Handler(),
+	}
+
+	go func() {
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Error("failed to serve webhooks")
+		}
+	}()
+
+	<-ctx.Done()
+	return s.Shutdown(context.Background())
+}
+
+// Handler returns the HTTP handler of the webhook endpoint
+func (r *Receiver) Handler() http.Handler {
+	e := echo.New()
+	e.HideBanner = true
+	e.POST("/webhook", r.handle)
+
+	return e
+}
+
+// push contains the fields of the push payloads of all providers which identify the repository and ref
+type push struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		SSHURL     string `json:"ssh_url"`
+		HTMLURL    string `json:"html_url"`
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+	} `json:"repository"`
+	Project struct {
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+		WebURL     string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (p push) urls() []string {
+	return []string{
+		p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL,
+		p.Repository.GitHTTPURL, p.Repository.GitSSHURL,
+		p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL,
+	}
+}
+
+func (r *Receiver) handle(c echo.Context) error {
+	provider, event := detectProvider(c.Request().Header)
+	if provider == "" {
+		return c.String(http.StatusBadRequest, "unknown webhook provider")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPayloadSize))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "failed to read payload")
+	}
+
+	if !isPush(provider, event) {
+		// e.g. the ping of GitHub when a webhook gets created
+		return c.JSON(http.StatusOK, Response{Repositories: []string{}})
+	}
+
+	payload := push{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return c.String(http.StatusBadRequest, "invalid payload")
+	}
+
+	if !strings.HasPrefix(payload.Ref, "refs/heads/") && !strings.HasPrefix(payload.Ref, "refs/tags/") {
+		return c.JSON(http.StatusOK, Response{Repositories: []string{}})
+	}
+
+	repos, err := r.matchRepositories(payload.urls(), payload.Ref)
+	if err != nil {
+		return err
+	}
+
+	if len(repos) == 0 {
+		return c.String(http.StatusNotFound, "no repository matches the push")
+	}
+
+	verified := make([]*repositoryv1.Repository, 0, len(repos))
+	for _, repo := range repos {
+		if r.verify(provider, c.Request().Header, body, repo) {
+			verified = append(verified, repo)
+		}
+	}
+
+	if len(verified) == 0 {
+		logrus.WithField("provider", provider).WithField("ref", payload.Ref).Warn("rejected webhook with invalid signature")
+		return c.String(http.StatusUnauthorized, "invalid signature")
+	}
+
+	resp := Response{Repositories: make([]string, 0, len(verified))}
+	req := puller.Request{}
+	pullConfig := false
+	for _, repo := range verified {
+		resp.Repositories = append(resp.Repositories, repo.GetName())
+		if repo.GetName() == configrepo.ConfigRepoName {
+			pullConfig = true
+			continue
+		}
+		req.Repositories = append(req.Repositories, repo.GetNamespaceName())
+	}
+
+	ctx := c.Request().Context()
+	if pullConfig {
+		select {
+		case r.configTrigger <- "":
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if len(req.Repositories) > 0 {
+		select {
+		case r.pullTrigger <- req:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	logrus.WithField("provider", provider).WithField("repositories", resp.Repositories).Info("received push webhook")
+	return c.JSON(http.StatusAccepted, resp)
+}
+
+// matchRepositories returns the repositories with one of the urls which deploy the pushed ref
+func (r *Receiver) matchRepositories(urls []string, ref string) ([]*repositoryv1.Repository, error) {
+	normalized := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if url != "" {
+			normalized[NormalizeURL(url)] = true
+		}
+	}
+
+	list, err := r.api.List(repositoryv1.VersionKind)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]*repositoryv1.Repository, 0)
+	for _, el := range list {
+		repo := el.(*repositoryv1.Repository)
+		if repo.Spec == nil || !selectsRef(repo.Spec, ref) || !normalized[NormalizeURL(repo.Spec.Url)] {
+			continue
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, nil
+}
+
+// selectsRef tells whether the repository deploys the pushed ref, i.e. its branch or a tag which its tag or semver
+// selector selects
+func selectsRef(spec *repositoryv1.Spec, ref string) bool {
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return spec.Branch == strings.TrimPrefix(ref, "refs/heads/")
+	}
+
+	tag := strings.TrimPrefix(ref, "refs/tags/")
+	switch {
+	case spec.Ref == nil:
+		return false
+	case spec.Ref.Tag != "":
+		return spec.Ref.Tag == tag
+	case spec.Ref.Semver != "":
+		semverRange, err := semver.ParseRange(spec.Ref.Semver)
+		if err != nil {
+			return false
+		}
+		version, ok := semver.Parse(tag)
+		return ok && semverRange.Matches(version)
+	default:
+		return false
+	}
+}
+
+// verify checks the signature or token of the request with the webhook secret of the repository
+func (r *Receiver) verify(provider string, header http.Header, body []byte, repo *repositoryv1.Repository) bool {
+	ref := repo.Spec.WebhookSecret
+	if ref == nil {
+		return false
+	}
+
+	secret := &secretv1.Secret{}
+	if err := r.api.Get(metav1.NamespaceName{Name: ref.Name, Namespace: secretv1.Namespace}, secret); err != nil {
+		logrus.WithError(err).WithField("repository", repo.GetName()).Warn("failed to get webhook secret")
+		return false
+	}
+
+	key, ok := secret.Value(ref.GetKey())
+	if !ok || key == "" {
+		return false
+	}
+
+	switch provider {
+	case ProviderGitHub:
+		signature := header.Get("X-Hub-Signature-256")
+		return strings.HasPrefix(signature, "sha256=") && validHMAC(strings.TrimPrefix(signature, "sha256="), key, body)
+	case ProviderGitea:
+		return validHMAC(header.Get("X-Gitea-Signature"), key, body)
+	case ProviderGitLab:
+		return subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(key)) == 1
+	default:
+		return false
+	}
+}
+
+// validHMAC compares the hex encoded signature with the HMAC-SHA256 of the body
+func validHMAC(signature, key string, body []byte) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
+
+// detectProvider returns the provider and the event type of the webhook from its headers
+func detectProvider(header http.Header) (string, string) {
+	// Gitea also sends the GitHub headers, so it is checked first
+	if event := header.Get("X-Gitea-Event"); event != "" {
+		return ProviderGitea, event
+	}
+	if event := header.Get("X-GitHub-Event"); event != "" {
+		return ProviderGitHub, event
+	}
+	if event := header.Get("X-Gitlab-Event"); event != "" {
+		return ProviderGitLab, event
+	}
+
+	return "", ""
+}
+
+func isPush(provider, event string) bool {
+	if provider == ProviderGitLab {
+		return event == "Push Hook" || event == "Tag Push Hook"
+	}
+
+	return event == "push"
+}
+
+// NormalizeURL reduces the clone url to its lower case host and path, so that the https and ssh urls of a repository
+// are equal; the git providers treat paths case-insensitively as well
+func NormalizeURL(url string) string {
+	url = strings.TrimSpace(url)
+
+	if scheme, rest, ok := strings.Cut(url, "://"); ok && scheme != "" {
+		url = rest
+		// user info
+		if at := strings.Index(url, "@"); at >= 0 && at < strings.IndexAny(url+"/", "/") {
+			url = url[at+1:]
+		}
+		host, path, _ := strings.Cut(url, "/")
+		// ports differ between https and ssh
+		host, _, _ = strings.Cut(host, ":")
+		url = host + "/" + path
+	} else if host, path, ok := strings.Cut(url, ":"); ok {
+		// scp-like syntax user@host:path
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		url = host + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git"))
+}
@@ -0,0 +1,279 @@
+package workqueue
+
+import (
+	"context"
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Handler processes a single event
+type Handler func(ctx context.Context, event store.Event) error
+
+// GiveUpHandler is called once the RateLimiter doesn't allow further retries of a failed event
+type GiveUpHandler func(ctx context.Context, event store.Event, err error)
+
+// RateLimiter decides how long a failed event has to wait before it gets processed again
+type RateLimiter interface {
+	// When records the failure of the event and returns the delay until the next attempt; false means no more retries
+	When(event store.Event, err error) (time.Duration, bool)
+	// Forget resets the failures of the event
+	Forget(event store.Event)
+}
+
+type fixedRateLimiter struct {
+	delay time.Duration
+}
+
+// NewFixedRateLimiter returns a RateLimiter which always waits for the given delay
+func NewFixedRateLimiter(delay time.Duration) RateLimiter {
+	return &fixedRateLimiter{
+		delay: delay,
+	}
+}
+
+func (f *fixedRateLimiter) When(store.Event, error) (time.Duration, bool) {
+	return f.delay, true
+}
+
+func (f *fixedRateLimiter) Forget(store.Event) {}
+
+// Queue is a work queue keyed by the NamespaceName of the events. Pending events with the same key are
+// deduplicated (the latest event wins, but an update never replaces a delete) and events with the same key are
+// never processed concurrently. Retries of failed events are dropped if a newer event has been added meanwhile.
+type Queue struct {
+	rateLimiter RateLimiter
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// keys holds the order of the pending events
+	keys []metav1.NamespaceName
+	// pending holds the latest event for each queued key
+	pending map[metav1.NamespaceName]item
+	// processing holds the sequence number of the event which is currently handled by a worker for each key
+	processing map[metav1.NamespaceName]uint64
+	// latest holds the latest added event for each key which is pending, processed or may still be retried
+	latest       map[metav1.NamespaceName]item
+	sequence     uint64
+	shuttingDown bool
+}
+
+// item is a queued event with the sequence number it was added with
+type item struct {
+	event    store.Event
+	sequence uint64
+}
+
+func New(rateLimiter RateLimiter) *Queue {
+	q := &Queue{
+		rateLimiter: rateLimiter,
+		keys:        make([]metav1.NamespaceName, 0),
+		pending:     make(map[metav1.NamespaceName]item),
+		processing:  make(map[metav1.NamespaceName]uint64),
+		latest:      make(map[metav1.NamespaceName]item),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// Add queues the event; if there already is a pending event with the same key, it gets replaced. Updates are dropped
+// while a delete of the same key is pending, processed or retried.
+func (q *Queue) Add(event store.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sequence++
+	q.add(event, q.sequence)
+}
+
+// AddAfter queues the event after the given delay
+func (q *Queue) AddAfter(event store.Event, delay time.Duration) {
+	if delay <= 0 {
+		q.Add(event)
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		q.Add(event)
+	})
+}
+
+// AddRateLimited queues the failed event after the delay of the rate limiter; returns false if the rate limiter gave up.
+// The retry is dropped if a newer event with the same key gets added before the delay is over.
+func (q *Queue) AddRateLimited(event store.Event, err error) bool {
+	delay, retry := q.rateLimiter.When(event, err)
+	if !retry {
+		return false
+	}
+
+	key := event.ObjectNamespaceName
+	q.mu.Lock()
+	sequence, ok := q.processing[key]
+	if !ok {
+		q.sequence++
+		sequence = q.sequence
+		q.latest[key] = item{event: event, sequence: sequence}
+	}
+	q.mu.Unlock()
+
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		if latest, ok := q.latest[key]; !ok || latest.sequence != sequence {
+			// a newer event has been added meanwhile, which replaces the retry
+			return
+		}
+		q.add(event, sequence)
+	})
+	return true
+}
+
+func (q *Queue) add(event store.Event, sequence uint64) {
+	if q.shuttingDown {
+		return
+	}
+
+	key := event.ObjectNamespaceName
+	if latest, ok := q.latest[key]; ok && latest.sequence != sequence &&
+		latest.event.Type == store.EventTypeDelete && event.Type == store.EventTypeUpdate {
+		// the object is gone, so the update must not keep the delete from being handled
+		return
+	}
+
+	_, alreadyPending := q.pending[key]
+	q.pending[key] = item{event: event, sequence: sequence}
+	q.latest[key] = item{event: event, sequence: sequence}
+
+	// processing keys get queued again by Done
+	_, processing := q.processing[key]
+	if alreadyPending || processing {
+		return
+	}
+
+	q.keys = append(q.keys, key)
+	q.cond.Signal()
+}
+
+// Forget resets the rate limiter for the event
+func (q *Queue) Forget(event store.Event) {
+	q.rateLimiter.Forget(event)
+	q.release(event)
+}
+
+// release drops the latest event of the key if it is the processed one, which won't be retried
+func (q *Queue) release(event store.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := event.ObjectNamespaceName
+	if sequence, ok := q.processing[key]; ok && q.latest[key].sequence == sequence {
+		delete(q.latest, key)
+	}
+}
+
+// Get blocks until an event can be processed; the second return value is true if the queue shuts down
+func (q *Queue) Get() (store.Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.keys) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+
+	if len(q.keys) == 0 {
+		return store.Event{}, true
+	}
+
+	key := q.keys[0]
+	q.keys = q.keys[1:]
+
+	pending := q.pending[key]
+	delete(q.pending, key)
+	q.processing[key] = pending.sequence
+
+	return pending.event, false
+}
+
+// Done marks the event as processed; has to be called for every event returned by Get
+func (q *Queue) Done(event store.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := event.ObjectNamespaceName
+	delete(q.processing, key)
+
+	if _, ok := q.pending[key]; ok && !q.shuttingDown {
+		q.keys = append(q.keys, key)
+		q.cond.Signal()
+	}
+}
+
+// Len returns the number of pending events
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.keys)
+}
+
+// ShutDown lets Get return for all waiting workers; pending events are dropped
+func (q *Queue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.shuttingDown = true
+	q.keys = q.keys[:0]
+	q.pending = make(map[metav1.NamespaceName]item)
+	q.cond.Broadcast()
+}
+
+// Run processes the queued events with the given number of workers until ctx is done. Failed events are
+// queued again with the delay of the rate limiter; onGiveUp is called if the rate limiter gives up.
+func (q *Queue) Run(ctx context.Context, workers int, handler Handler, onGiveUp GiveUpHandler) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q.processNext(ctx, handler, onGiveUp) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	q.ShutDown()
+	wg.Wait()
+}
+
+func (q *Queue) processNext(ctx context.Context, handler Handler, onGiveUp GiveUpHandler) bool {
+	event, shutdown := q.Get()
+	if shutdown {
+		return false
+	}
+	defer q.Done(event)
+
+	if err := handler(ctx, event.DeepCopy()); err != nil {
+		logger := logrus.WithError(err).WithField("nn", event.ObjectNamespaceName)
+		logger.Warn("failed to handle event")
+
+		if !q.AddRateLimited(event, err) {
+			q.release(event)
+			logger.Error("giving up on event after too many failed attempts")
+			if onGiveUp != nil {
+				onGiveUp(ctx, event, err)
+			}
+		}
+		return true
+	}
+
+	q.Forget(event)
+	return true
+}
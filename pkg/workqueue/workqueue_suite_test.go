@@ -0,0 +1,13 @@
+package workqueue_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorkQueue(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "WorkQueue Suite")
+}
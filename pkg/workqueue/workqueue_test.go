@@ -0,0 +1,172 @@
+package workqueue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "github.com/lacodon/recoon/pkg/api/v1/meta"
+	"github.com/lacodon/recoon/pkg/store"
+	"github.com/lacodon/recoon/pkg/workqueue"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func makeEvent(name, typ string) store.Event {
+	return store.Event{
+		Type: typ,
+		ObjectNamespaceName: metav1.NamespaceName{
+			Name:      name,
+			Namespace: "test",
+		},
+	}
+}
+
+var _ = Describe("Queue", func() {
+	var queue *workqueue.Queue
+
+	BeforeEach(func() {
+		queue = workqueue.New(workqueue.NewFixedRateLimiter(10 * time.Millisecond))
+	})
+
+	It("should deduplicate pending events with the same key", func() {
+		queue.Add(makeEvent("a", store.EventTypeAdd))
+		queue.Add(makeEvent("b", store.EventTypeAdd))
+		queue.Add(makeEvent("a", store.EventTypeUpdate))
+
+		Expect(queue.Len()).To(Equal(2))
+
+		event, shutdown := queue.Get()
+		Expect(shutdown).To(BeFalse())
+		Expect(event.ObjectNamespaceName.Name).To(Equal("a"))
+		Expect(event.Type).To(Equal(store.EventTypeUpdate))
+		queue.Done(event)
+	})
+
+	It("should not hand out a key which is being processed", func() {
+		queue.Add(makeEvent("a", store.EventTypeAdd))
+
+		event, _ := queue.Get()
+		queue.Add(makeEvent("a", store.EventTypeUpdate))
+		Expect(queue.Len()).To(Equal(0))
+
+		queue.Done(event)
+		Expect(queue.Len()).To(Equal(1))
+
+		event, _ = queue.Get()
+		Expect(event.Type).To(Equal(store.EventTypeUpdate))
+		queue.Done(event)
+	})
+
+	It("should not replace a pending delete with an update", func() {
+		queue.Add(makeEvent("a", store.EventTypeDelete))
+		queue.Add(makeEvent("a", store.EventTypeUpdate))
+
+		event, _ := queue.Get()
+		Expect(event.Type).To(Equal(store.EventTypeDelete))
+		queue.Done(event)
+		Expect(queue.Len()).To(BeZero())
+	})
+
+	It("should drop the retry of a failed event once a newer event has been added", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		queue = workqueue.New(workqueue.NewFixedRateLimiter(50 * time.Millisecond))
+
+		var mu sync.Mutex
+		handled := make([]string, 0)
+		failed := make(chan struct{})
+		go queue.Run(ctx, 1, func(ctx context.Context, event store.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handled = append(handled, event.Type)
+			if len(handled) == 1 {
+				close(failed)
+				return errors.New("failed")
+			}
+			return nil
+		}, nil)
+
+		queue.Add(makeEvent("a", store.EventTypeUpdate))
+		Eventually(failed).Should(BeClosed())
+		// the delete arrives while the update waits for its retry
+		queue.Add(makeEvent("a", store.EventTypeDelete))
+
+		getHandled := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string{}, handled...)
+		}
+		Eventually(getHandled).Should(Equal([]string{store.EventTypeUpdate, store.EventTypeDelete}))
+		Consistently(getHandled, 150*time.Millisecond).Should(Equal([]string{store.EventTypeUpdate, store.EventTypeDelete}))
+	})
+
+	It("should release waiting workers on shutdown", func() {
+		done := make(chan bool)
+		go func() {
+			_, shutdown := queue.Get()
+			done <- shutdown
+		}()
+
+		queue.ShutDown()
+		Eventually(done).Should(Receive(BeTrue()))
+	})
+
+	It("should never process the same key concurrently", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var mu sync.Mutex
+		active := make(map[string]bool)
+		var overlaps, processed int32
+
+		go queue.Run(ctx, 4, func(ctx context.Context, event store.Event) error {
+			mu.Lock()
+			if active[event.ObjectNamespaceName.Name] {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			active[event.ObjectNamespaceName.Name] = true
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active[event.ObjectNamespaceName.Name] = false
+			mu.Unlock()
+
+			atomic.AddInt32(&processed, 1)
+			return nil
+		}, nil)
+
+		for i := 0; i < 20; i++ {
+			queue.Add(makeEvent("a", store.EventTypeUpdate))
+			queue.Add(makeEvent("b", store.EventTypeUpdate))
+			time.Sleep(time.Millisecond)
+		}
+
+		Eventually(queue.Len).Should(BeZero())
+		Eventually(func() int32 { return atomic.LoadInt32(&processed) }).Should(BeNumerically(">=", 2))
+		Expect(atomic.LoadInt32(&overlaps)).To(BeZero())
+	})
+
+	It("should retry failed events after the rate limit delay", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var calls int32
+		go queue.Run(ctx, 1, func(ctx context.Context, event store.Event) error {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return errors.New("failed")
+			}
+			return nil
+		}, nil)
+
+		queue.Add(makeEvent("a", store.EventTypeAdd))
+		Eventually(func() int32 { return atomic.LoadInt32(&calls) }).Should(Equal(int32(3)))
+		Consistently(func() int32 { return atomic.LoadInt32(&calls) }, 50*time.Millisecond).Should(Equal(int32(3)))
+	})
+})